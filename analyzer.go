@@ -0,0 +1,115 @@
+package goextract
+
+import (
+	"fmt"
+	"go/token"
+
+	"golang.org/x/tools/go/analysis"
+)
+
+// Analyzer reports the extraction candidates of goextract suggest as
+// diagnostics whose suggested fixes perform the extraction.
+var Analyzer = &analysis.Analyzer{
+	Name: "goextract",
+	Doc: `find code to extract from too long or too deeply nested functions
+
+Each diagnostic proposes a run of statements to extract into a function of
+its own and carries the extraction as suggested fix.`,
+	Run: runAnalyzer,
+}
+
+var analyzerOptions = DefaultSuggestOptions
+
+func init() {
+	Analyzer.Flags.IntVar(&analyzerOptions.MaxLines, "max-lines", analyzerOptions.MaxLines, "number of lines from which on a function is too long")
+	Analyzer.Flags.IntVar(&analyzerOptions.MaxNesting, "max-nesting", analyzerOptions.MaxNesting, "depth of nested control statements from which on a function is too deeply nested")
+	Analyzer.Flags.IntVar(&analyzerOptions.MaxParams, "max-params", analyzerOptions.MaxParams, "maximum number of parameters of a suggested function")
+}
+
+func runAnalyzer(pass *analysis.Pass) (interface{}, error) {
+	overlay, canExtract := overlayOf(pass)
+	// All extractions of the pass see the same files, so they share the
+	// type-checked dependencies.
+	options := Options{UniqueName: true, Overlay: overlay, importer: newSourceImporter(token.NewFileSet(), overlay)}
+	for _, file := range pass.Files {
+		for _, suggestion := range suggestionsIn(pass.Fset, file, pass.TypesInfo, pass.Pkg, analyzerOptions) {
+			tokenFile := pass.Fset.File(file.Pos())
+			diagnostic := analysis.Diagnostic{
+				Pos: tokenFile.LineStart(suggestion.Selection.Begin.Line) + token.Pos(suggestion.Selection.Begin.Column-1),
+				End: tokenFile.LineStart(suggestion.Selection.End.Line) + token.Pos(suggestion.Selection.End.Column-1),
+				Message: fmt.Sprintf("%v has %v lines and nesting depth %v: extract this as %v%v to remove complexity %v",
+					suggestion.Function, suggestion.Lines, suggestion.Nesting, suggestion.Name, suggestion.Signature, suggestion.Complexity),
+			}
+			if canExtract {
+				if fix, ok := suggestedFixFor(pass, suggestion, options); ok {
+					diagnostic.SuggestedFixes = []analysis.SuggestedFix{fix}
+				}
+			}
+			pass.Report(diagnostic)
+		}
+	}
+	return nil, nil
+}
+
+// overlayOf returns the contents of the files as read by the driver. The
+// files on disk may differ from what the driver parsed, so the extractions
+// only see these contents, and there are none if the driver cannot provide them.
+func overlayOf(pass *analysis.Pass) (overlay Overlay, ok bool) {
+	if pass.ReadFile == nil {
+		return
+	}
+	overlay = make(Overlay)
+	for _, file := range pass.Files {
+		tokenFile := pass.Fset.File(file.Pos())
+		content, err := pass.ReadFile(tokenFile.Name())
+		if err != nil || len(content) != tokenFile.Size() {
+			return nil, false
+		}
+		overlay[absPath(tokenFile.Name())] = string(content)
+	}
+	return overlay, true
+}
+
+// suggestedFixFor runs the extraction of suggestion with options.
+// Suggestions the extraction engine cannot handle get no fix. Panics of the
+// engine count as errors, so that a single suggestion does not abort the
+// analysis of the whole package.
+func suggestedFixFor(pass *analysis.Pass, suggestion Suggestion, options Options) (fix analysis.SuggestedFix, ok bool) {
+	result, err := extractionFor(suggestion, options)
+	if err != nil {
+		return
+	}
+	fix.Message = "Extract function " + result.Function.Name
+	for _, change := range result.Changes {
+		tokenFile := tokenFileNamed(pass, change.Filename)
+		if tokenFile == nil {
+			return
+		}
+		for _, edit := range TextEditsFrom(change.Original, change.Modified) {
+			fix.TextEdits = append(fix.TextEdits, analysis.TextEdit{
+				Pos:     tokenFile.Pos(edit.Start.Offset),
+				End:     tokenFile.Pos(edit.End.Offset),
+				NewText: []byte(edit.NewText),
+			})
+		}
+	}
+	return fix, true
+}
+
+func extractionFor(suggestion Suggestion, options Options) (result *Result, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	return ExtractSource(suggestion.Filename, options.Overlay.ReadFile(suggestion.Filename), suggestion.Selection, suggestion.Name, options)
+}
+
+func tokenFileNamed(pass *analysis.Pass, filename string) *token.File {
+	for _, file := range pass.Files {
+		if tokenFile := pass.Fset.File(file.Pos()); tokenFile.Name() == filename {
+			return tokenFile
+		}
+	}
+	return nil
+}
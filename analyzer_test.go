@@ -0,0 +1,140 @@
+package goextract_test
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io/ioutil"
+	"sort"
+
+	. "github.com/petergtz/goextract"
+	"golang.org/x/tools/go/analysis"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Analyzer", func() {
+	pkg := newTempPackage("goextract-analyzer", map[string]string{
+		"a.go": `package a
+
+func nested(items [][]int, limit int) int {
+	total := 0
+	for _, row := range items {
+		for _, item := range row {
+			if item > limit {
+				if item%2 == 0 {
+					println(item)
+				}
+			}
+		}
+	}
+	return total
+}
+`,
+	})
+
+	var (
+		filename    string
+		diagnostics []analysis.Diagnostic
+		fileSet     *token.FileSet
+		readFile    func(filename string) ([]byte, error)
+	)
+
+	BeforeEach(func() {
+		filename = pkg.path("a.go")
+		readFile = ioutil.ReadFile
+	})
+
+	JustBeforeEach(func() {
+		fileSet = token.NewFileSet()
+		astFile, err := parser.ParseFile(fileSet, filename, nil, parser.ParseComments)
+		Expect(err).NotTo(HaveOccurred())
+		info := &types.Info{
+			Types:      make(map[ast.Expr]types.TypeAndValue),
+			Defs:       make(map[*ast.Ident]types.Object),
+			Uses:       make(map[*ast.Ident]types.Object),
+			Implicits:  make(map[ast.Node]types.Object),
+			Scopes:     make(map[ast.Node]*types.Scope),
+			Selections: make(map[*ast.SelectorExpr]*types.Selection),
+		}
+		typesPkg, err := (&types.Config{Importer: importer.Default()}).Check("a", fileSet, []*ast.File{astFile}, info)
+		Expect(err).NotTo(HaveOccurred())
+
+		diagnostics = nil
+		_, err = Analyzer.Run(&analysis.Pass{
+			Analyzer:  Analyzer,
+			Fset:      fileSet,
+			Files:     []*ast.File{astFile},
+			Pkg:       typesPkg,
+			TypesInfo: info,
+			ReadFile:  readFile,
+			Report:    func(diagnostic analysis.Diagnostic) { diagnostics = append(diagnostics, diagnostic) },
+		})
+		Expect(err).NotTo(HaveOccurred())
+	})
+
+	It("reports the extraction candidates", func() {
+		Expect(diagnostics).NotTo(BeEmpty())
+		Expect(fileSet.Position(diagnostics[0].Pos).Line).To(Equal(4))
+		Expect(fileSet.Position(diagnostics[0].End).Line).To(Equal(13))
+		Expect(diagnostics[0].Message).To(ContainSubstring("computeTotal(items [][]int, limit int) int"))
+	})
+
+	It("offers the extraction as suggested fix", func() {
+		Expect(diagnostics[0].SuggestedFixes).To(HaveLen(1))
+		fix := diagnostics[0].SuggestedFixes[0]
+		Expect(fix.Message).To(Equal("Extract function computeTotal"))
+
+		src, err := ioutil.ReadFile(filename)
+		Expect(err).NotTo(HaveOccurred())
+		edits := fix.TextEdits
+		sort.Slice(edits, func(i, j int) bool { return edits[i].Pos > edits[j].Pos })
+		for _, edit := range edits {
+			begin, end := fileSet.Position(edit.Pos).Offset, fileSet.Position(edit.End).Offset
+			src = append(src[:begin], append(append([]byte{}, edit.NewText...), src[end:]...)...)
+		}
+		Expect(string(src)).To(ContainSubstring("total := computeTotal(items, limit)"))
+		Expect(string(src)).To(ContainSubstring("func computeTotal(items [][]int, limit int) int {"))
+	})
+
+	Context("when the extraction engine cannot handle a candidate", func() {
+		BeforeEach(func() {
+			pkg.writeFile("loops.go", `package a
+
+func loops(items [][]int, limit int) int {
+	total := 0
+	for i := 0; i < len(items); i++ {
+		for j := 0; j < len(items[i]); j++ {
+			if items[i][j] > limit {
+				if items[i][j]%2 == 0 {
+					total += items[i][j]
+				}
+			}
+		}
+	}
+	return total
+}
+`)
+			filename = pkg.path("loops.go")
+		})
+
+		It("reports the candidates without fixes", func() {
+			Expect(diagnostics).NotTo(BeEmpty())
+			Expect(diagnostics[0].SuggestedFixes).To(BeEmpty())
+		})
+	})
+
+	Context("when the file differs from what the driver parsed", func() {
+		BeforeEach(func() {
+			readFile = func(string) ([]byte, error) { return []byte("package a\n"), nil }
+		})
+
+		It("reports the candidates without fixes", func() {
+			Expect(diagnostics).NotTo(BeEmpty())
+			Expect(diagnostics[0].SuggestedFixes).To(BeEmpty())
+		})
+	})
+})
@@ -1,4 +1,4 @@
-package main
+package goextract
 
 import (
 	"bytes"
@@ -11,20 +11,52 @@ import (
 	"github.com/petergtz/goextract/util"
 )
 
-func astFromFile(filename string) (*token.FileSet, *ast.File) {
-	fileSet := token.NewFileSet()
-	astFile, err := parser.ParseFile(fileSet, filename, nil, parser.ParseComments)
-	util.PanicOnError(err)
-
-	return fileSet, astFile
+func astFromInput(input string) (*token.FileSet, *ast.File, error) {
+	return astFromSource("", input)
 }
 
-func astFromInput(input string) (*token.FileSet, *ast.File) {
+func astFromSource(filename string, src string) (*token.FileSet, *ast.File, error) {
 	fileSet := token.NewFileSet()
-	astFile, err := parser.ParseFile(fileSet, "", input, parser.ParseComments)
-	util.PanicOnError(err)
+	astFile, err := parser.ParseFile(fileSet, filename, src, parser.ParseComments)
+	if err != nil {
+		return nil, nil, err
+	}
+	bindTypeSwitchVars(astFile)
 
-	return fileSet, astFile
+	return fileSet, astFile, nil
+}
+
+// bindTypeSwitchVars gives the variable of each type switch guard in astFile
+// an object of its own in every case clause, like the implicit objects of the
+// type checker. Its Decl is the guard and its Data the clause, so that the
+// variable gets the type of the clause.
+func bindTypeSwitchVars(astFile *ast.File) {
+	ast.Inspect(astFile, func(node ast.Node) bool {
+		typeSwitch, isTypeSwitch := node.(*ast.TypeSwitchStmt)
+		if !isTypeSwitch {
+			return true
+		}
+		assign, isAssign := typeSwitch.Assign.(*ast.AssignStmt)
+		if !isAssign {
+			return true
+		}
+		guardVar := assign.Lhs[0].(*ast.Ident)
+		for _, stmt := range typeSwitch.Body.List {
+			clause := stmt.(*ast.CaseClause)
+			clauseVar := ast.NewObj(ast.Var, guardVar.Name)
+			clauseVar.Decl = assign
+			clauseVar.Data = clause
+			for _, bodyStmt := range clause.Body {
+				ast.Inspect(bodyStmt, func(node ast.Node) bool {
+					if ident, isIdent := node.(*ast.Ident); isIdent && ident.Obj != nil && ident.Obj == guardVar.Obj {
+						ident.Obj = clauseVar
+					}
+					return true
+				})
+			}
+		}
+		return true
+	})
 }
 
 func createAstFileDump(filename string, fileSet *token.FileSet, astFile *ast.File) {
@@ -40,3 +72,24 @@ func stringFrom(fileSet *token.FileSet, astFile *ast.File) string {
 	util.PanicOnError(err)
 	return buf.String()
 }
+
+// pathTo returns all nodes from root down to node, including both.
+func pathTo(root ast.Node, node ast.Node) (path []ast.Node) {
+	var stack []ast.Node
+	ast.Inspect(root, func(current ast.Node) bool {
+		if path != nil {
+			return false
+		}
+		if current == nil {
+			stack = stack[:len(stack)-1]
+			return true
+		}
+		stack = append(stack, current)
+		if current == node {
+			path = append([]ast.Node{}, stack...)
+			return false
+		}
+		return true
+	})
+	return
+}
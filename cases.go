@@ -0,0 +1,214 @@
+package goextract
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/petergtz/goextract/util"
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// DefaultCaseNamePattern is the template for the names of the functions
+// extracted by ExtractCases. Its data is the value of the case as Case, e.g.
+// Circle for case *shapes.Circle or AddItem for case "add-item".
+const DefaultCaseNamePattern = "handle{{.Case}}"
+
+// ExtractCases extracts the body of each case clause of the switch or type
+// switch statement at position into a function of its own, named by the
+// text/template namePattern. If cases is not empty, only the clauses whose
+// values, as written in the source and separated by ", ", or default are
+// given are extracted. The variable of a type switch guard gets the type of
+// each clause. Either all clauses are extracted or none, and Function
+// describes the function of the first one.
+func ExtractCases(filename string, src string, position Position, cases []string, namePattern string, options Options) (*Result, error) {
+	if options.Placement == PlaceInFile {
+		return &Result{}, errors.New("Extracting cases into another file is not supported")
+	}
+	tmpl, err := template.New("name").Parse(namePattern)
+	if err != nil {
+		return &Result{}, err
+	}
+	formatted, err := format.Source([]byte(src))
+	if err != nil {
+		return &Result{}, err
+	}
+	modified := string(formatted)
+	fileSet := token.NewFileSet()
+	astFile, err := parser.ParseFile(fileSet, filename, modified, parser.ParseComments)
+	util.PanicOnError(err)
+	funcDecl, clauses := switchAt(fileSet, astFile, position)
+	if funcDecl == nil {
+		return &Result{}, fmt.Errorf("There is no switch statement in a function at %v:%v", position.Line, position.Column)
+	}
+
+	selected := make(map[string]bool)
+	for _, value := range cases {
+		selected[value] = true
+	}
+	var parts []Selection
+	var names []string
+	var problems []Problem
+	for _, clause := range clauses {
+		value := caseValueOf(modified, fileSet, clause)
+		if len(cases) != 0 && !selected[value] {
+			continue
+		}
+		delete(selected, value)
+		if !worthExtracting(clause.Body) {
+			if len(cases) != 0 {
+				return &Result{}, fmt.Errorf("The body of case %v is not worth extracting", value)
+			}
+			continue
+		}
+		var name bytes.Buffer
+		err := tmpl.Execute(&name, struct{ Case string }{caseNameOf(clause)})
+		if err != nil {
+			return &Result{}, err
+		}
+		if !token.IsIdentifier(name.String()) {
+			return &Result{}, fmt.Errorf("The name %q for case %v is not an identifier", name.String(), value)
+		}
+		parts = append(parts, selectionOf(fileSet, clause.Body[0].Pos(), clause.Body[len(clause.Body)-1].End()))
+		names = append(names, name.String())
+		problems = append(problems, outerAssignmentsIn(fileSet, funcDecl, clause, "case", "cases")...)
+	}
+	for _, value := range cases {
+		if selected[value] {
+			return &Result{}, fmt.Errorf("The switch statement has no case %v", value)
+		}
+	}
+	if len(problems) != 0 {
+		return &Result{}, &ValidationError{Problems: problems}
+	}
+	if len(parts) == 0 {
+		return &Result{}, errors.New("The switch statement has no cases worth extracting")
+	}
+
+	options.UniqueName = true
+	modified, funcName, warnings, err := extractParts(filename, modified, qualifiedNameOf(funcDecl), parts, names, options)
+	if err != nil {
+		return &Result{Warnings: warnings}, err
+	}
+	return &Result{
+		Changes:  []FileChange{{Filename: filename, Original: src, Modified: modified}},
+		Warnings: warnings,
+		Function: functionInfoFrom(filename, modified, funcName),
+	}, nil
+}
+
+// switchAt returns the function declaring the innermost switch or type
+// switch statement containing position, and the clauses of the statement.
+func switchAt(fileSet *token.FileSet, astFile *ast.File, position Position) (*ast.FuncDecl, []*ast.CaseClause) {
+	tokenFile := fileSet.File(astFile.Pos())
+	if position.Line < 1 || position.Line > tokenFile.LineCount() {
+		return nil, nil
+	}
+	pos := tokenFile.LineStart(position.Line) + token.Pos(position.Column-1)
+	path, _ := astutil.PathEnclosingInterval(astFile, pos, pos)
+	var body *ast.BlockStmt
+	for _, node := range path {
+		switch typedNode := node.(type) {
+		case *ast.SwitchStmt:
+			if body == nil {
+				body = typedNode.Body
+			}
+		case *ast.TypeSwitchStmt:
+			if body == nil {
+				body = typedNode.Body
+			}
+		case *ast.FuncLit:
+			if body != nil {
+				return nil, nil
+			}
+		case *ast.FuncDecl:
+			if body == nil {
+				return nil, nil
+			}
+			var clauses []*ast.CaseClause
+			for _, stmt := range body.List {
+				clauses = append(clauses, stmt.(*ast.CaseClause))
+			}
+			return typedNode, clauses
+		}
+	}
+	return nil, nil
+}
+
+// worthExtracting tells whether stmts are more than a single expression
+// statement, which usually is a call already.
+func worthExtracting(stmts []ast.Stmt) bool {
+	if len(stmts) == 0 {
+		return false
+	}
+	_, isExprStmt := stmts[0].(*ast.ExprStmt)
+	return !isExprStmt || len(stmts) > 1
+}
+
+// caseValueOf returns the values of clause as written in src, separated by
+// ", ", or default.
+func caseValueOf(src string, fileSet *token.FileSet, clause *ast.CaseClause) string {
+	if clause.List == nil {
+		return "default"
+	}
+	var values []string
+	for _, expr := range clause.List {
+		values = append(values, src[fileSet.Position(expr.Pos()).Offset:fileSet.Position(expr.End()).Offset])
+	}
+	return strings.Join(values, ", ")
+}
+
+// caseNameOf returns the values of clause turned into an exported
+// identifier, Default for the default clause. Values without a name are
+// left out.
+func caseNameOf(clause *ast.CaseClause) string {
+	if clause.List == nil {
+		return "Default"
+	}
+	var name string
+	for _, expr := range clause.List {
+		if identifier := identifierFor(expr); identifier != "" {
+			name += exported(identifier)
+		}
+	}
+	return name
+}
+
+// identifierFor returns the name of the type or value expr, or the words of
+// a string literal joined in camel case.
+func identifierFor(expr ast.Expr) string {
+	switch typedExpr := expr.(type) {
+	case *ast.Ident:
+		return typedExpr.Name
+	case *ast.SelectorExpr:
+		return typedExpr.Sel.Name
+	case *ast.StarExpr:
+		return identifierFor(typedExpr.X)
+	case *ast.ParenExpr:
+		return identifierFor(typedExpr.X)
+	case *ast.ArrayType:
+		return identifierFor(typedExpr.Elt) + "s"
+	case *ast.BasicLit:
+		value := typedExpr.Value
+		if typedExpr.Kind == token.STRING || typedExpr.Kind == token.CHAR {
+			if unquoted, err := strconv.Unquote(value); err == nil {
+				value = unquoted
+			}
+		}
+		var name string
+		for _, word := range strings.FieldsFunc(value, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) }) {
+			name += exported(word)
+		}
+		return name
+	default:
+		return ""
+	}
+}
@@ -0,0 +1,102 @@
+package goextract_test
+
+import (
+	. "github.com/petergtz/goextract"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ExtractCases", func() {
+	src := `package p
+
+type circle struct{ r int }
+type square struct{ a int }
+
+func describe(shape interface{}) {
+	switch s := shape.(type) {
+	case circle:
+		r := s.r
+		println(3 * r * r)
+	case *square:
+		a := s.a
+		println(a * a)
+	case nil, int:
+		println("nothing")
+		println(s)
+	default:
+		println("unknown")
+	}
+}
+
+func command(name string, count int) {
+	switch name {
+	case "add-item":
+		total := count + 1
+		println(total)
+	case "remove":
+		println("removing")
+		println(count)
+	}
+}
+`
+
+	It("extracts every case of a type switch with the type of the clause", func() {
+		result, err := ExtractCases("", src, Position{7, 3}, nil, DefaultCaseNamePattern, Options{})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Function.Name).To(Equal("handleCircle"))
+		Expect(result.Changes[0].Modified).To(ContainSubstring(`	switch s := shape.(type) {
+	case circle:
+		handleCircle(s)
+	case *square:
+		handleSquare(s)
+	case nil, int:
+		handleNilInt(s)
+	default:
+		println("unknown")
+	}
+`))
+		Expect(result.Changes[0].Modified).To(ContainSubstring(`func handleCircle(s circle) {
+	r := s.r
+	println(3 * r * r)
+}
+
+func handleSquare(s *square) {
+	a := s.a
+	println(a * a)
+}
+
+func handleNilInt(s interface{}) {
+	println("nothing")
+	println(s)
+}
+`))
+	})
+
+	It("extracts only the given cases with names from the pattern", func() {
+		result, err := ExtractCases("", src, Position{24, 3}, []string{`"add-item"`}, "do{{.Case}}", Options{})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Changes[0].Modified).To(ContainSubstring(`	switch name {
+	case "add-item":
+		doAddItem(count)
+	case "remove":
+		println("removing")
+		println(count)
+	}
+}
+
+func doAddItem(count int) {
+	total := count + 1
+	println(total)
+}
+`))
+	})
+
+	It("reports cases the switch does not have", func() {
+		_, err := ExtractCases("", src, Position{24, 3}, []string{`"rename"`}, DefaultCaseNamePattern, Options{})
+
+		Expect(err).To(MatchError(`The switch statement has no case "rename"`))
+	})
+})
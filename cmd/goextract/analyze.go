@@ -0,0 +1,26 @@
+package main
+
+import (
+	"os"
+	"strings"
+
+	"github.com/petergtz/goextract"
+	"golang.org/x/tools/go/analysis/singlechecker"
+	"golang.org/x/tools/go/analysis/unitchecker"
+)
+
+// runAnalyzerIfRequested runs goextract.Analyzer instead of the usual
+// commands when goextract is called by go vet -vettool or as
+// "goextract analyze".
+func runAnalyzerIfRequested(args []string) {
+	if len(args) > 1 && args[1] == "analyze" {
+		os.Args = append([]string{args[0]}, args[2:]...)
+		singlechecker.Main(goextract.Analyzer)
+	}
+	// go vet asks for the version and the flags first and then passes the
+	// configuration of every package in a *.cfg file as last argument.
+	last := args[len(args)-1]
+	if len(args) > 1 && (strings.HasPrefix(last, "-V=") || last == "-flags" || strings.HasSuffix(last, ".cfg")) {
+		unitchecker.Main(goextract.Analyzer)
+	}
+}
@@ -0,0 +1,494 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/petergtz/goextract"
+	"github.com/petergtz/goextract/util"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	extractCommand = kingpin.Command("extract", "Extract the selection into a function").Default()
+	inputFilename  = extractCommand.Arg("input", "Input filename. Reads from stdin and writes to stdout if omitted").String()
+	selection      = extractCommand.Flag("selection", "begin_line:begin_column-end_line:end_column").Short('s').Required().String()
+	funcName       = extractCommand.Flag("function", "Name of extracted function. Suggested from the extracted code if omitted").Short('f').String()
+	outputFilename = extractCommand.Flag("output", "Output filename").Short('o').String()
+	warnOnly       = extractCommand.Flag("warn", "Only warn about violations of this validation rule instead of refusing the extraction (repeatable)").PlaceHolder("RULE").Enums(goextract.ValidationRuleNames()...)
+	force          = extractCommand.Flag("force", "Write the result even if it does not type-check").Bool()
+	diff           = extractCommand.Flag("diff", "Only print a unified diff of all affected files. Exits with 1 if there are changes").Short('d').Bool()
+	jsonOutput     = extractCommand.Flag("json", "Only print the edits of all affected files and information about the extracted function as JSON").Bool()
+	placement      = extractCommand.Flag("placement", "Where to declare the extracted function: after or before the enclosing declaration, at the end of the file, or in the given file of the same package").Default("end").PlaceHolder("after|before|end|FILE").String()
+	exportedName   = extractCommand.Flag("exported", "Make the suggested function name exported").Bool()
+	uniqueName     = extractCommand.Flag("unique-name", "Append a number to the function name if it collides with another declaration instead of refusing the extraction").Bool()
+	paramOrder     = extractCommand.Flag("param-order", "Order of the parameters of the extracted function: alphabetical, by first use in the selection or by declaration in the enclosing function").Default("alphabetical").Enum("alphabetical", "first-use", "declaration")
+	namedResults   = extractCommand.Flag("named-results", "Name the results of the extracted function like the variables it returns").Bool()
+	doc            = extractCommand.Flag("doc", "Generate a doc comment for the extracted function").Bool()
+	docTemplate    = extractCommand.Flag("doc-template", "text/template for the generated doc comment with the fields .Name, .Params, .Results and .Enclosing and the function join. Implies --doc").PlaceHolder("TEMPLATE").String()
+	duplicates     = extractCommand.Flag("duplicates", "List the duplicates of the extracted code in the enclosing function, the file or the package instead of extracting").PlaceHolder("function|file|package").Enum("function", "file", "package")
+	replaceDups    = extractCommand.Flag("replace-duplicates", "Extract and replace the duplicates listed by --duplicates with calls of the function").Bool()
+	wrapErrors     = extractCommand.Flag("wrap-errors", "Wrap the errors returned by error guards in the extracted code with fmt.Errorf and the function name").Bool()
+	paramObject    = extractCommand.Flag("param-object", "Bundle the parameters of the extracted function into a struct if it would have more than N of them").PlaceHolder("N").Int()
+	modified       = extractCommand.Flag("modified", "Read an archive of modified files from stdin, each given as filename, size in bytes and content, and use them instead of the files on disk").Bool()
+
+	suggestCommand  = kingpin.Command("suggest", "Find extraction candidates in too long or too deeply nested functions")
+	suggestPatterns = suggestCommand.Arg("packages", "Directories, directories followed by /... for all packages below them, or Go files").Default("./...").Strings()
+	suggestFormat   = suggestCommand.Flag("format", "Output format").Default("human").Enum("human", "json", "sarif")
+	maxLines        = suggestCommand.Flag("max-lines", "Number of lines from which on a function is too long").Default("40").Int()
+	maxNesting      = suggestCommand.Flag("max-nesting", "Depth of nested control statements from which on a function is too deeply nested").Default("3").Int()
+	maxParams       = suggestCommand.Flag("max-params", "Maximum number of parameters of a suggested function").Default("4").Int()
+
+	sliceCommand   = kingpin.Command("slice", "Extract the statements computing the value of a variable into a function returning it")
+	sliceInput     = sliceCommand.Arg("input", "Input filename").Required().String()
+	slicePosition  = sliceCommand.Flag("position", "Position of the variable whose value to compute").Short('p').PlaceHolder("LINE:COLUMN").Required().String()
+	sliceFuncName  = sliceCommand.Flag("function", "Name of extracted function. Defaults to compute followed by the variable name").Short('f').String()
+	sliceOutput    = sliceCommand.Flag("output", "Output filename").Short('o').String()
+	sliceDiff      = sliceCommand.Flag("diff", "Only print a unified diff. Exits with 1 if there are changes").Short('d').Bool()
+	sliceJSON      = sliceCommand.Flag("json", "Only print the edits and information about the extracted function as JSON").Bool()
+	slicePlacement = sliceCommand.Flag("placement", "Where to declare the extracted function: after or before the enclosing declaration or at the end of the file").Default("end").Enum("after", "before", "end")
+
+	decomposeCommand   = kingpin.Command("decompose", "Extract the conditions of an if-else chain into predicate functions and its branches into functions")
+	decomposeInput     = decomposeCommand.Arg("input", "Input filename").Required().String()
+	decomposePosition  = decomposeCommand.Flag("position", "Position within the if statement").Short('p').PlaceHolder("LINE:COLUMN").Required().String()
+	decomposeOutput    = decomposeCommand.Flag("output", "Output filename").Short('o').String()
+	decomposeDiff      = decomposeCommand.Flag("diff", "Only print a unified diff. Exits with 1 if there are changes").Short('d').Bool()
+	decomposeJSON      = decomposeCommand.Flag("json", "Only print the edits and information about the predicate of the first condition as JSON").Bool()
+	decomposePlacement = decomposeCommand.Flag("placement", "Where to declare the extracted functions: after or before the enclosing declaration or at the end of the file").Default("end").Enum("after", "before", "end")
+
+	casesCommand     = kingpin.Command("cases", "Extract the body of each case of a switch or type switch statement into a function")
+	casesInput       = casesCommand.Arg("input", "Input filename").Required().String()
+	casesPosition    = casesCommand.Flag("position", "Position within the switch statement").Short('p').PlaceHolder("LINE:COLUMN").Required().String()
+	casesCases       = casesCommand.Flag("case", "Value of a case to extract as written in the source, values separated by \", \", or default. Defaults to all cases (repeatable)").Short('c').PlaceHolder("VALUE").Strings()
+	casesNamePattern = casesCommand.Flag("name", "Template for the function names, with the case value as {{.Case}}").Short('n').Default(goextract.DefaultCaseNamePattern).String()
+	casesOutput      = casesCommand.Flag("output", "Output filename").Short('o').String()
+	casesDiff        = casesCommand.Flag("diff", "Only print a unified diff. Exits with 1 if there are changes").Short('d').Bool()
+	casesJSON        = casesCommand.Flag("json", "Only print the edits and information about the function of the first case as JSON").Bool()
+	casesPlacement   = casesCommand.Flag("placement", "Where to declare the extracted functions: after or before the enclosing declaration or at the end of the file").Default("end").Enum("after", "before", "end")
+
+	paramObjectCommand  = kingpin.Command("param-object", "Bundle the parameters of a function into a struct and update all calls in the package")
+	paramObjectInput    = paramObjectCommand.Arg("input", "Filename of the function").Required().String()
+	paramObjectFuncName = paramObjectCommand.Flag("function", "Name of the function, Type.Method for methods").Short('f').Required().String()
+	paramObjectType     = paramObjectCommand.Flag("type", "Name of the new struct type. Defaults to the function name followed by Params").Short('t').String()
+	paramObjectDiff     = paramObjectCommand.Flag("diff", "Only print a unified diff of all affected files. Exits with 1 if there are changes").Short('d').Bool()
+	paramObjectJSON     = paramObjectCommand.Flag("json", "Only print the edits of all affected files as JSON").Bool()
+	paramObjectForce    = paramObjectCommand.Flag("force", "Write the result even if it does not type-check").Bool()
+
+	signatureCommand  = kingpin.Command("signature", "Change the parameters of a function and update all its uses in the package")
+	signatureInput    = signatureCommand.Arg("input", "Filename of the function").Required().String()
+	signatureFuncName = signatureCommand.Flag("function", "Name of the function, Type.Method for methods").Short('f').Required().String()
+	signatureParams   = signatureCommand.Flag("param", "Parameter of the new signature, in order: NAME to keep a parameter, OLD:NEW to rename it, or \"+NAME TYPE=DEFAULT\" to add one. Parameters not given are removed (repeatable)").PlaceHolder("PARAM").Strings()
+	signatureForce    = signatureCommand.Flag("force", "Write the result even if it does not type-check").Bool()
+	signatureDiff     = signatureCommand.Flag("diff", "Only print a unified diff of all affected files. Exits with 1 if there are changes").Short('d').Bool()
+	signatureJSON     = signatureCommand.Flag("json", "Only print the edits of all affected files as JSON").Bool()
+
+	toMethodCommand  = kingpin.Command("to-method", "Turn a function into a method on the type of its first parameter and update all its uses in the package")
+	toMethodInput    = toMethodCommand.Arg("input", "Filename of the function").Required().String()
+	toMethodFuncName = toMethodCommand.Flag("function", "Name of the function").Short('f').Required().String()
+	toMethodForce    = toMethodCommand.Flag("force", "Write the result even if it does not type-check").Bool()
+	toMethodDiff     = toMethodCommand.Flag("diff", "Only print a unified diff of all affected files. Exits with 1 if there are changes").Short('d').Bool()
+	toMethodJSON     = toMethodCommand.Flag("json", "Only print the edits of all affected files as JSON").Bool()
+
+	toFunctionCommand    = kingpin.Command("to-function", "Turn a method into a function taking the receiver as first parameter and update all its uses in the package")
+	toFunctionInput      = toFunctionCommand.Arg("input", "Filename of the method").Required().String()
+	toFunctionMethodName = toFunctionCommand.Flag("method", "Name of the method as Type.Method").Short('m').Required().String()
+	toFunctionForce      = toFunctionCommand.Flag("force", "Write the result even if it does not type-check").Bool()
+	toFunctionDiff       = toFunctionCommand.Flag("diff", "Only print a unified diff of all affected files. Exits with 1 if there are changes").Short('d').Bool()
+	toFunctionJSON       = toFunctionCommand.Flag("json", "Only print the edits of all affected files as JSON").Bool()
+
+	interfaceCommand    = kingpin.Command("interface", "Declare an interface with the methods a function calls on a parameter and use it as the parameter's type")
+	interfaceInput      = interfaceCommand.Arg("input", "Filename of the function").Required().String()
+	interfaceFuncName   = interfaceCommand.Flag("function", "Name of the function, Type.Method for methods").Short('f').Required().String()
+	interfaceParam      = interfaceCommand.Flag("param", "Name of the parameter").Short('p').Required().String()
+	interfaceName       = interfaceCommand.Flag("name", "Name of the interface. Defaults to the name of the only method followed by er, or the type name followed by Interface").Short('n').String()
+	interfaceBesideType = interfaceCommand.Flag("beside-type", "Declare the interface after the parameter's type, possibly in another package, instead of before the function").Bool()
+	interfaceForce      = interfaceCommand.Flag("force", "Write the result even if it does not type-check").Bool()
+	interfaceDiff       = interfaceCommand.Flag("diff", "Only print a unified diff of all affected files. Exits with 1 if there are changes").Short('d').Bool()
+	interfaceJSON       = interfaceCommand.Flag("json", "Only print the edits of all affected files as JSON").Bool()
+
+	moveCommand = kingpin.Command("move", "Move a top-level declaration to another file or package and update all its uses in the package")
+	moveInput   = moveCommand.Arg("input", "Filename of the declaration").Required().String()
+	moveName    = moveCommand.Flag("name", "Name of the function, type, var or const, Type.Method for methods").Short('n').Required().String()
+	moveTarget  = moveCommand.Flag("to", "Filename to move the declaration to. If it is in another directory, the declaration is exported").Short('t').Required().String()
+	moveForce   = moveCommand.Flag("force", "Write the result even if it does not type-check").Bool()
+	moveDiff    = moveCommand.Flag("diff", "Only print a unified diff of all affected files. Exits with 1 if there are changes").Short('d').Bool()
+	moveJSON    = moveCommand.Flag("json", "Only print the edits of all affected files as JSON").Bool()
+
+	serverCommand = kingpin.Command("lsp", "Run a Language Server Protocol server on stdin/stdout offering extractions as code actions")
+)
+
+func main() {
+	runAnalyzerIfRequested(os.Args)
+	switch kingpin.Parse() {
+	case serverCommand.FullCommand():
+		kingpin.FatalIfError(goextract.ServeLSP(os.Stdin, os.Stdout), "")
+	case suggestCommand.FullCommand():
+		suggest()
+	case sliceCommand.FullCommand():
+		slice()
+	case decomposeCommand.FullCommand():
+		decompose()
+	case casesCommand.FullCommand():
+		extractCases()
+	case paramObjectCommand.FullCommand():
+		introduceParamObjectCommand()
+	case signatureCommand.FullCommand():
+		changeSignature()
+	case toMethodCommand.FullCommand():
+		functionToMethod()
+	case toFunctionCommand.FullCommand():
+		methodToFunction()
+	case interfaceCommand.FullCommand():
+		extractInterface()
+	case moveCommand.FullCommand():
+		move()
+	case extractCommand.FullCommand():
+		extract()
+	}
+}
+
+func extract() {
+	options := goextract.Options{WarnOnly: make(map[string]bool), Force: *force, UniqueName: *uniqueName, ExportSuggestedName: *exportedName}
+	for _, rule := range *warnOnly {
+		options.WarnOnly[rule] = true
+	}
+	switch *placement {
+	case "end":
+		options.Placement = goextract.PlaceAtEndOfFile
+	case "after":
+		options.Placement = goextract.PlaceAfterEnclosingDecl
+	case "before":
+		options.Placement = goextract.PlaceBeforeEnclosingDecl
+	default:
+		options.Placement = goextract.PlaceInFile
+		options.PlacementFile = *placement
+	}
+	options.NamedResults = *namedResults
+	if *doc {
+		options.DocTemplate = goextract.DefaultDocTemplate
+	}
+	if *docTemplate != "" {
+		options.DocTemplate = *docTemplate
+	}
+	switch *paramOrder {
+	case "first-use":
+		options.ParamOrder = goextract.ParamOrderFirstUse
+	case "declaration":
+		options.ParamOrder = goextract.ParamOrderDeclaration
+	}
+	switch *duplicates {
+	case "function":
+		options.Duplicates = goextract.DuplicatesInFunction
+	case "file":
+		options.Duplicates = goextract.DuplicatesInFile
+	case "package":
+		options.Duplicates = goextract.DuplicatesInPackage
+	}
+	options.ReplaceDuplicates = *replaceDups
+	options.WrapErrors = *wrapErrors
+	options.ParamObjectThreshold = *paramObject
+	if options.ReplaceDuplicates && options.Duplicates == goextract.NoDuplicates {
+		kingpin.Fatalf("--replace-duplicates requires --duplicates")
+	}
+	if *modified {
+		if *inputFilename == "" {
+			kingpin.Fatalf("--modified requires an input filename")
+		}
+		overlay, err := goextract.ParseOverlay(os.Stdin)
+		kingpin.FatalIfError(err, "")
+		options.Overlay = overlay
+	}
+	if *inputFilename == "" {
+		filter(options)
+		return
+	}
+	adjustedSelection := goextract.ShrinkToNonWhiteSpace(selectionFromString(*selection), options.Overlay.ReadFile(*inputFilename))
+	if *jsonOutput {
+		os.Exit(printJSON(goextract.ExtractFile(*inputFilename, adjustedSelection, *funcName, options)))
+	}
+	if *diff {
+		os.Exit(printDiff(goextract.ExtractFile(*inputFilename, adjustedSelection, *funcName, options)))
+	}
+	if options.Duplicates != goextract.NoDuplicates && !options.ReplaceDuplicates {
+		result, err := goextract.ExtractFile(*inputFilename, adjustedSelection, *funcName, options)
+		kingpin.FatalIfError(err, "")
+		printDuplicates(result.Duplicates)
+		return
+	}
+	if options.Placement == goextract.PlaceInFile || (options.Duplicates == goextract.DuplicatesInPackage && options.ReplaceDuplicates) {
+		if *outputFilename != "" {
+			kingpin.Fatalf("--output cannot be used when placing the function in another file or replacing duplicates in the package")
+		}
+		// Several files change, so they are written in place.
+		result, err := goextract.ExtractFile(*inputFilename, adjustedSelection, *funcName, options)
+		printWarnings(result.Warnings)
+		kingpin.FatalIfError(err, "")
+		for _, change := range result.Changes {
+			util.WriteFileAsStringOrPanic(change.Filename, change.Modified)
+		}
+		return
+	}
+	if *outputFilename == "" {
+		output, warnings, err := goextract.ExtractFileToString(*inputFilename, adjustedSelection, *funcName, options, false)
+		printWarnings(warnings)
+		kingpin.FatalIfError(err, "")
+		fmt.Print(output)
+	} else {
+		warnings, err := goextract.ExtractFileToFile(*inputFilename, adjustedSelection, *funcName, options, *outputFilename, false)
+		printWarnings(warnings)
+		kingpin.FatalIfError(err, "")
+	}
+}
+
+func suggest() {
+	suggestions, err := goextract.Suggest(*suggestPatterns, goextract.SuggestOptions{MaxLines: *maxLines, MaxNesting: *maxNesting, MaxParams: *maxParams})
+	kingpin.FatalIfError(err, "")
+	switch *suggestFormat {
+	case "json":
+		fmt.Println(string(goextract.JSONFromSuggestions(suggestions)))
+	case "sarif":
+		fmt.Println(string(goextract.SARIFFromSuggestions(suggestions, ".")))
+	default:
+		for _, suggestion := range suggestions {
+			fmt.Println(suggestion)
+		}
+	}
+}
+
+func slice() {
+	options := goextract.Options{}
+	switch *slicePlacement {
+	case "after":
+		options.Placement = goextract.PlaceAfterEnclosingDecl
+	case "before":
+		options.Placement = goextract.PlaceBeforeEnclosingDecl
+	}
+	position := selectionFromString(*slicePosition + "-" + *slicePosition).Begin
+	src := util.ReadFileAsStringOrPanic(*sliceInput)
+	if *sliceJSON {
+		os.Exit(printJSON(goextract.ExtractSlice(*sliceInput, src, position, *sliceFuncName, options)))
+	}
+	if *sliceDiff {
+		os.Exit(printDiff(goextract.ExtractSlice(*sliceInput, src, position, *sliceFuncName, options)))
+	}
+	result, err := goextract.ExtractSlice(*sliceInput, src, position, *sliceFuncName, options)
+	printWarnings(result.Warnings)
+	kingpin.FatalIfError(err, "")
+	if *sliceOutput == "" {
+		fmt.Print(result.Changes[0].Modified)
+	} else {
+		util.WriteFileAsStringOrPanic(*sliceOutput, result.Changes[0].Modified)
+	}
+}
+
+func decompose() {
+	options := goextract.Options{}
+	switch *decomposePlacement {
+	case "after":
+		options.Placement = goextract.PlaceAfterEnclosingDecl
+	case "before":
+		options.Placement = goextract.PlaceBeforeEnclosingDecl
+	}
+	position := selectionFromString(*decomposePosition + "-" + *decomposePosition).Begin
+	src := util.ReadFileAsStringOrPanic(*decomposeInput)
+	if *decomposeJSON {
+		os.Exit(printJSON(goextract.DecomposeConditional(*decomposeInput, src, position, options)))
+	}
+	if *decomposeDiff {
+		os.Exit(printDiff(goextract.DecomposeConditional(*decomposeInput, src, position, options)))
+	}
+	result, err := goextract.DecomposeConditional(*decomposeInput, src, position, options)
+	printWarnings(result.Warnings)
+	kingpin.FatalIfError(err, "")
+	if *decomposeOutput == "" {
+		fmt.Print(result.Changes[0].Modified)
+	} else {
+		util.WriteFileAsStringOrPanic(*decomposeOutput, result.Changes[0].Modified)
+	}
+}
+
+func extractCases() {
+	options := goextract.Options{}
+	switch *casesPlacement {
+	case "after":
+		options.Placement = goextract.PlaceAfterEnclosingDecl
+	case "before":
+		options.Placement = goextract.PlaceBeforeEnclosingDecl
+	}
+	position := selectionFromString(*casesPosition + "-" + *casesPosition).Begin
+	src := util.ReadFileAsStringOrPanic(*casesInput)
+	if *casesJSON {
+		os.Exit(printJSON(goextract.ExtractCases(*casesInput, src, position, *casesCases, *casesNamePattern, options)))
+	}
+	if *casesDiff {
+		os.Exit(printDiff(goextract.ExtractCases(*casesInput, src, position, *casesCases, *casesNamePattern, options)))
+	}
+	result, err := goextract.ExtractCases(*casesInput, src, position, *casesCases, *casesNamePattern, options)
+	printWarnings(result.Warnings)
+	kingpin.FatalIfError(err, "")
+	if *casesOutput == "" {
+		fmt.Print(result.Changes[0].Modified)
+	} else {
+		util.WriteFileAsStringOrPanic(*casesOutput, result.Changes[0].Modified)
+	}
+}
+
+func introduceParamObjectCommand() {
+	result, err := goextract.IntroduceParamObject(*paramObjectInput, *paramObjectFuncName, *paramObjectType, goextract.Options{Force: *paramObjectForce})
+	writeChanges(result, err, *paramObjectDiff, *paramObjectJSON)
+}
+
+func changeSignature() {
+	var params []goextract.ParamChange
+	for _, spec := range *signatureParams {
+		param, err := parseParamChange(spec)
+		kingpin.FatalIfError(err, "")
+		params = append(params, param)
+	}
+	result, err := goextract.ChangeSignature(*signatureInput, *signatureFuncName, params, goextract.Options{Force: *signatureForce})
+	writeChanges(result, err, *signatureDiff, *signatureJSON)
+}
+
+func functionToMethod() {
+	result, err := goextract.FunctionToMethod(*toMethodInput, *toMethodFuncName, goextract.Options{Force: *toMethodForce})
+	writeChanges(result, err, *toMethodDiff, *toMethodJSON)
+}
+
+func methodToFunction() {
+	result, err := goextract.MethodToFunction(*toFunctionInput, *toFunctionMethodName, goextract.Options{Force: *toFunctionForce})
+	writeChanges(result, err, *toFunctionDiff, *toFunctionJSON)
+}
+
+func extractInterface() {
+	result, err := goextract.ExtractInterface(*interfaceInput, *interfaceFuncName, *interfaceParam, *interfaceName, *interfaceBesideType, goextract.Options{Force: *interfaceForce})
+	writeChanges(result, err, *interfaceDiff, *interfaceJSON)
+}
+
+func move() {
+	result, err := goextract.Move(*moveInput, *moveName, *moveTarget, goextract.Options{Force: *moveForce})
+	writeChanges(result, err, *moveDiff, *moveJSON)
+}
+
+// parseParamChange parses "name" to keep a parameter, "old:new" to rename it
+// and "+name type=default" to add a new one.
+func parseParamChange(spec string) (goextract.ParamChange, error) {
+	if strings.HasPrefix(spec, "+") {
+		nameAndType := strings.SplitN(strings.TrimSpace(spec[1:]), " ", 2)
+		if len(nameAndType) != 2 || !strings.Contains(nameAndType[1], "=") {
+			return goextract.ParamChange{}, fmt.Errorf("New parameters must be given as +name type=default, not %v", spec)
+		}
+		typeAndDefault := strings.SplitN(nameAndType[1], "=", 2)
+		return goextract.ParamChange{Name: nameAndType[0], Type: strings.TrimSpace(typeAndDefault[0]), Default: strings.TrimSpace(typeAndDefault[1])}, nil
+	}
+	fromAndName := strings.SplitN(spec, ":", 2)
+	change := goextract.ParamChange{From: strings.TrimSpace(fromAndName[0])}
+	if len(fromAndName) == 2 {
+		change.Name = strings.TrimSpace(fromAndName[1])
+	}
+	return change, nil
+}
+
+// writeChanges writes the changes of a refactoring of calls in several files
+// in place, or only prints them as diff or as JSON.
+func writeChanges(result *goextract.Result, err error, diff bool, json bool) {
+	if json {
+		os.Exit(printJSON(result, err))
+	}
+	if diff {
+		os.Exit(printDiff(result, err))
+	}
+	printWarnings(result.Warnings)
+	kingpin.FatalIfError(err, "")
+	for _, change := range result.Changes {
+		util.WriteFileAsStringOrPanic(change.Filename, change.Modified)
+	}
+}
+
+// filter extracts from the source on stdin, like gofmt without arguments.
+func filter(options goextract.Options) {
+	input, err := ioutil.ReadAll(os.Stdin)
+	kingpin.FatalIfError(err, "")
+	adjustedSelection := goextract.ShrinkToNonWhiteSpace(selectionFromString(*selection), string(input))
+	if *jsonOutput {
+		os.Exit(printJSON(goextract.ExtractSource("", string(input), adjustedSelection, *funcName, options)))
+	}
+	if *diff {
+		os.Exit(printDiff(goextract.ExtractSource("", string(input), adjustedSelection, *funcName, options)))
+	}
+	if options.Duplicates != goextract.NoDuplicates && !options.ReplaceDuplicates {
+		result, err := goextract.ExtractSource("", string(input), adjustedSelection, *funcName, options)
+		kingpin.FatalIfError(err, "")
+		printDuplicates(result.Duplicates)
+		return
+	}
+	output, warnings, err := goextract.ExtractStringToString(string(input), adjustedSelection, *funcName, options)
+	printWarnings(warnings)
+	kingpin.FatalIfError(err, "")
+	if *outputFilename == "" {
+		fmt.Print(output)
+	} else {
+		util.WriteFileAsStringOrPanic(*outputFilename, output)
+	}
+}
+
+func printDuplicates(duplicates []goextract.Duplicate) {
+	for _, duplicate := range duplicates {
+		fmt.Println(duplicate)
+	}
+}
+
+func printWarnings(warnings []goextract.Problem) {
+	for _, warning := range warnings {
+		fmt.Fprintln(os.Stderr, "warning:", warning)
+	}
+}
+
+// printDiff prints the changes of the extraction and returns the exit status:
+// 0 if nothing changes, 1 if something changes, 2 if the extraction failed.
+func printDiff(result *goextract.Result, err error) int {
+	printWarnings(result.Warnings)
+	if err != nil {
+		kingpin.Errorf("%v", err)
+		return 2
+	}
+	exitStatus := 0
+	for _, change := range result.Changes {
+		if change.Original != change.Modified {
+			filename := change.Filename
+			if filename == "" {
+				filename = "<standard input>"
+			}
+			fmt.Print(goextract.UnifiedDiff(filename, change.Original, change.Modified))
+			exitStatus = 1
+		}
+	}
+	return exitStatus
+}
+
+// printJSON prints the outcome of the extraction as JSON and returns the exit status.
+func printJSON(result *goextract.Result, err error) int {
+	os.Stdout.Write(goextract.JSONFrom(result, err))
+	fmt.Println()
+	if err != nil {
+		return 1
+	}
+	return 0
+}
+
+// TODO: error handling. Do this with regex
+func selectionFromString(s string) goextract.Selection {
+	s = strings.Replace(s, " ", "", -1)
+	beginEnd := strings.Split(s, "-")
+	beginString := beginEnd[0]
+	endString := beginEnd[1]
+	begin := strings.Split(beginString, ":")
+	end := strings.Split(endString, ":")
+
+	return goextract.Selection{
+		Begin: goextract.Position{Line: util.ToInt(begin[0]), Column: util.ToInt(begin[1])},
+		End:   goextract.Position{Line: util.ToInt(end[0]), Column: util.ToInt(end[1])},
+	}
+}
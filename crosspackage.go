@@ -0,0 +1,192 @@
+package goextract
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/petergtz/goextract/util"
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// targetPackage is the package that receives the extracted function when it
+// is placed in a file of another directory.
+type targetPackage struct {
+	name       string
+	importPath string
+}
+
+// otherPackageTarget determines the package in dir and makes sure the
+// extracted function named funcName in src can be moved there.
+func otherPackageTarget(inputFileName string, original string, src string, funcName string, dir string, selection Selection, overlay Overlay) (*targetPackage, error) {
+	importPath, err := importPathOf(dir, overlay)
+	if err != nil {
+		return nil, err
+	}
+	originalImportPath, err := importPathOf(filepath.Dir(inputFileName), overlay)
+	if err != nil {
+		return nil, err
+	}
+	target := &targetPackage{name: packageNameIn(dir, overlay), importPath: importPath}
+	if target.name == "main" {
+		return nil, fmt.Errorf("Cannot place the function in %v, package main cannot be imported", dir)
+	}
+	if importsTransitively(dir, originalImportPath, overlay, make(map[string]bool)) {
+		return nil, fmt.Errorf("Cannot place the function in %v, it would create an import cycle with %v", importPath, originalImportPath)
+	}
+	if problems := packageDependenciesOf(inputFileName, original, src, funcName, selection, overlay); len(problems) != 0 {
+		return nil, &ValidationError{Problems: problems}
+	}
+	return target, nil
+}
+
+// packageNameIn returns the name of the package in dir, or guesses it from dir
+// if there is no package yet.
+func packageNameIn(dir string, overlay Overlay) string {
+	buildPackage, err := overlay.buildContext().ImportDir(dir, 0)
+	if err == nil {
+		return buildPackage.Name
+	}
+	return assumedPackageName(filepath.Base(dir))
+}
+
+// importsTransitively reports whether the package in dir imports the package
+// with importPath, directly or indirectly. Standard library packages are not
+// followed.
+func importsTransitively(dir string, importPath string, overlay Overlay, visited map[string]bool) bool {
+	buildPackage, err := overlay.buildContext().ImportDir(dir, 0)
+	if err != nil {
+		return false
+	}
+	for _, path := range buildPackage.Imports {
+		if path == importPath {
+			return true
+		}
+		importedDir, err := dirOfImportPath(path, dir, overlay)
+		if err != nil || visited[importedDir] || strings.HasPrefix(importedDir, filepath.Join(build.Default.GOROOT, "src")) {
+			continue
+		}
+		visited[importedDir] = true
+		if importsTransitively(importedDir, importPath, overlay, visited) {
+			return true
+		}
+	}
+	return false
+}
+
+// packageDependenciesOf finds the package level identifiers of its own package
+// the function funcName in src uses. Unexported ones cannot be accessed from
+// another package, and exported ones would require an import cycle.
+func packageDependenciesOf(filename string, original string, src string, funcName string, selection Selection, overlay Overlay) (problems []Problem) {
+	fileSet := token.NewFileSet()
+	astFile, err := parser.ParseFile(fileSet, filename, src, 0)
+	util.PanicOnError(err)
+	info := &types.Info{Uses: make(map[*ast.Ident]types.Object)}
+	config := types.Config{Importer: newSourceImporter(fileSet, overlay), Error: func(error) {}}
+	pkg, _ := config.Check(astFile.Name.Name, fileSet, append([]*ast.File{astFile}, siblingFilesOf(fileSet, filename, src, overlay)...), info)
+
+	mapper := newPositionMapper(original, src, selection)
+	reported := make(map[types.Object]bool)
+	ast.Inspect(funcDeclNamed(astFile, funcName), func(node ast.Node) bool {
+		ident, isIdent := node.(*ast.Ident)
+		if !isIdent {
+			return true
+		}
+		object := info.Uses[ident]
+		if object == nil || object.Pkg() != pkg || reported[object] || !isPackageLevelOrMember(object, pkg) {
+			return true
+		}
+		reported[object] = true
+		message := fmt.Sprintf("%v is exported, but using it from another package would create an import cycle", object.Name())
+		if !object.Exported() {
+			message = fmt.Sprintf("%v is not exported", object.Name())
+		}
+		problems = append(problems, mapper.mapToOriginal(Problem{Rule: "package", Position: fileSet.Position(ident.Pos()), Message: message}))
+		return true
+	})
+	return
+}
+
+func isPackageLevelOrMember(object types.Object, pkg *types.Package) bool {
+	if object.Parent() == pkg.Scope() {
+		return true
+	}
+	switch typedObject := object.(type) {
+	case *types.Var:
+		return typedObject.IsField()
+	case *types.Func:
+		return typedObject.Type().(*types.Signature).Recv() != nil
+	}
+	return false
+}
+
+func funcDeclNamed(astFile *ast.File, name string) *ast.FuncDecl {
+	for _, decl := range astFile.Decls {
+		if funcDecl, isFuncDecl := decl.(*ast.FuncDecl); isFuncDecl && funcDecl.Recv == nil && funcDecl.Name.Name == name {
+			return funcDecl
+		}
+	}
+	panic("Unexpected: function " + name + " not found")
+}
+
+func exported(name string) string {
+	r, size := utf8.DecodeRuneInString(name)
+	return string(unicode.ToUpper(r)) + name[size:]
+}
+
+func unexported(name string) string {
+	r, size := utf8.DecodeRuneInString(name)
+	return string(unicode.ToLower(r)) + name[size:]
+}
+
+// callOtherPackage qualifies all calls of funcName in astFile with the package
+// of target and imports that package.
+func callOtherPackage(fileSet *token.FileSet, astFile *ast.File, funcName string, exportedName string, target *targetPackage) {
+	packageName := packageNameFor(astFile, target)
+	astutil.Apply(astFile, func(cursor *astutil.Cursor) bool {
+		if ident, isIdent := cursor.Node().(*ast.Ident); isIdent && ident.Name == funcName && ident.Obj == nil {
+			if _, isSelector := cursor.Parent().(*ast.SelectorExpr); !isSelector {
+				cursor.Replace(&ast.SelectorExpr{X: ast.NewIdent(packageName), Sel: ast.NewIdent(exportedName)})
+			}
+		}
+		return true
+	}, nil)
+	explicitName := ""
+	if packageName != assumedPackageName(target.importPath) {
+		explicitName = packageName
+	}
+	astutil.AddNamedImport(fileSet, astFile, explicitName, target.importPath)
+}
+
+// packageNameFor returns the name under which astFile can refer to target:
+// the name of an existing import of it, its package name, or, if that is
+// already taken, its package name with a number appended.
+func packageNameFor(astFile *ast.File, target *targetPackage) string {
+	taken := make(map[string]bool)
+	for _, importSpec := range astFile.Imports {
+		path, name := importPathAndName(importSpec)
+		if path == target.importPath {
+			return name
+		}
+		taken[name] = true
+	}
+	ast.Inspect(astFile, func(node ast.Node) bool {
+		if ident, isIdent := node.(*ast.Ident); isIdent {
+			taken[ident.Name] = true
+		}
+		return true
+	})
+	name := target.name
+	for i := 2; taken[name]; i++ {
+		name = target.name + strconv.Itoa(i)
+	}
+	return name
+}
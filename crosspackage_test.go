@@ -0,0 +1,122 @@
+package goextract_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/petergtz/goextract"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Placement in another package", func() {
+	var dir string
+
+	writeFile := func(filename string, content string) {
+		Expect(os.MkdirAll(filepath.Dir(filepath.Join(dir, filename)), 0755)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(dir, filename), []byte(content), 0644)).To(Succeed())
+	}
+
+	extractInto := func(targetFileName string) (*Result, error) {
+		return ExtractFile(filepath.Join(dir, "a.go"), Selection{Position{11, 2}, Position{12, 33}}, "printCases",
+			Options{Placement: PlaceInFile, PlacementFile: filepath.Join(dir, targetFileName)})
+	}
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "goextract-package")
+		Expect(err).NotTo(HaveOccurred())
+		writeFile("go.mod", "module example.com/m\n")
+		writeFile("a.go", `package m
+
+import (
+	"fmt"
+	"strings"
+)
+
+var prefix = "> "
+
+func f(s string) {
+	fmt.Println(strings.ToUpper(s))
+	fmt.Println(strings.ToLower(s))
+	fmt.Println(prefix + s)
+}
+`)
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("exports the function and calls it through an import", func() {
+		result, err := extractInto("helpers/cases.go")
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Changes[0].Modified).To(Equal(`package m
+
+import (
+	"example.com/m/helpers"
+	"fmt"
+)
+
+var prefix = "> "
+
+func f(s string) {
+	helpers.PrintCases(s)
+	fmt.Println(prefix + s)
+}
+`))
+		Expect(result.Changes[1].Modified).To(Equal(`package helpers
+
+import (
+	"fmt"
+	"strings"
+)
+
+func PrintCases(s string) {
+	fmt.Println(strings.ToUpper(s))
+	fmt.Println(strings.ToLower(s))
+}
+`))
+		Expect(result.Function.Name).To(Equal("PrintCases"))
+	})
+
+	It("imports packages whose name differs from their directory with an alias", func() {
+		writeFile("helpers/doc.go", "package util\n")
+
+		result, err := extractInto("helpers/cases.go")
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Changes[0].Modified).To(ContainSubstring(`util "example.com/m/helpers"`))
+		Expect(result.Changes[0].Modified).To(ContainSubstring("util.PrintCases(s)"))
+	})
+
+	It("refuses functions that depend on unexported identifiers", func() {
+		_, err := ExtractFile(filepath.Join(dir, "a.go"), Selection{Position{12, 2}, Position{13, 25}}, "printWithPrefix",
+			Options{Placement: PlaceInFile, PlacementFile: filepath.Join(dir, "helpers", "cases.go")})
+
+		Expect(err).To(MatchError(ContainSubstring("a.go:13:14: prefix is not exported (package)")))
+	})
+
+	It("refuses names already declared in the other package unless asked for a unique one", func() {
+		writeFile("helpers/cases.go", "package helpers\n\nfunc PrintCases() {}\n")
+
+		_, err := extractInto("helpers/cases.go")
+		Expect(err).To(MatchError("PrintCases is already declared in package example.com/m/helpers"))
+
+		result, err := ExtractFile(filepath.Join(dir, "a.go"), Selection{Position{11, 2}, Position{12, 33}}, "printCases",
+			Options{Placement: PlaceInFile, PlacementFile: filepath.Join(dir, "helpers", "cases.go"), UniqueName: true})
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Changes[0].Modified).To(ContainSubstring("helpers.PrintCases2(s)"))
+	})
+
+	It("refuses packages that would create an import cycle", func() {
+		writeFile("helpers/m.go", "package helpers\n\nimport _ \"example.com/m\"\n")
+
+		_, err := extractInto("helpers/cases.go")
+
+		Expect(err).To(MatchError(ContainSubstring("import cycle")))
+	})
+})
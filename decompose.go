@@ -0,0 +1,221 @@
+package goextract
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"sort"
+
+	"github.com/petergtz/goextract/util"
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// DecomposeConditional extracts the condition of the if statement at
+// position, and of all else ifs chained to it, into predicate functions and
+// the body of each branch into a function of its own. The functions get
+// suggested names. Either all parts are extracted or none, and Function
+// describes the predicate of the first condition.
+func DecomposeConditional(filename string, src string, position Position, options Options) (*Result, error) {
+	if options.Placement == PlaceInFile {
+		return &Result{}, errors.New("Decomposing a conditional into another file is not supported")
+	}
+	formatted, err := format.Source([]byte(src))
+	if err != nil {
+		return &Result{}, err
+	}
+	modified := string(formatted)
+	fileSet := token.NewFileSet()
+	astFile, err := parser.ParseFile(fileSet, filename, modified, parser.ParseComments)
+	util.PanicOnError(err)
+	funcDecl, ifStmt := ifChainAt(fileSet, astFile, position)
+	if ifStmt == nil {
+		return &Result{}, fmt.Errorf("There is no if statement in a function at %v:%v", position.Line, position.Column)
+	}
+	parts, problems := conditionalParts(fileSet, funcDecl, ifStmt)
+	if len(problems) != 0 {
+		return &Result{}, &ValidationError{Problems: problems}
+	}
+	if len(parts) == 0 {
+		return &Result{}, errors.New("The conditional has no conditions or branches worth extracting")
+	}
+
+	options.UniqueName = true
+	modified, funcName, warnings, err := extractParts(filename, modified, qualifiedNameOf(funcDecl), parts, make([]string, len(parts)), options)
+	if err != nil {
+		return &Result{Warnings: warnings}, err
+	}
+	return &Result{
+		Changes:  []FileChange{{Filename: filename, Original: src, Modified: modified}},
+		Warnings: warnings,
+		Function: functionInfoFrom(filename, modified, funcName),
+	}, nil
+}
+
+// extractParts extracts each of parts of the function enclosingName in src,
+// given as Type.Method, into a function named like the corresponding entry
+// of names, or a suggested name if that is empty. The functions are declared
+// in the order of the parts. It returns the resulting source and the name of
+// the function extracted from the first part.
+func extractParts(filename string, src string, enclosingName string, parts []Selection, names []string, options Options) (modified string, funcName string, warnings []Problem, err error) {
+	options.Duplicates = NoDuplicates
+	options.ReplaceDuplicates = false
+	modified = src
+	lineShift := 0
+	funcNames := make([]string, len(parts))
+	// Extracting from the end keeps the positions of the parts before
+	// valid, except for declarations inserted before the enclosing function.
+	for i := len(parts) - 1; i >= 0; i-- {
+		selection := parts[i]
+		selection.Begin.Line += lineShift
+		selection.End.Line += lineShift
+		enclosingLine := declLineOf(modified, enclosingName)
+		result, err := ExtractSource(filename, modified, selection, names[i], options)
+		warnings = append(warnings, result.Warnings...)
+		if err != nil {
+			return "", "", warnings, err
+		}
+		modified = result.Changes[0].Modified
+		lineShift += declLineOf(modified, enclosingName) - enclosingLine
+		funcNames[i] = result.Function.Name
+	}
+	return inSourceOrder(modified, funcNames), funcNames[0], warnings, nil
+}
+
+// inSourceOrder rearranges the declarations of the functions funcNames in src
+// so that they appear in the order of funcNames, at the places the
+// declarations occupy.
+func inSourceOrder(src string, funcNames []string) string {
+	fileSet := token.NewFileSet()
+	astFile, err := parser.ParseFile(fileSet, "", src, parser.ParseComments)
+	util.PanicOnError(err)
+	var texts []string
+	var places []textEdit
+	for _, funcName := range funcNames {
+		funcDecl := funcDeclNamed(astFile, funcName)
+		begin, end := fileSet.Position(declPos(funcDecl)).Offset, fileSet.Position(funcDecl.End()).Offset
+		texts = append(texts, src[begin:end])
+		places = append(places, textEdit{begin: begin, end: end})
+	}
+	sort.Slice(places, func(i, j int) bool { return places[i].begin < places[j].begin })
+	for i := range places {
+		places[i].text = texts[i]
+	}
+	return applyTextEdits(src, places)
+}
+
+// ifChainAt returns the first if statement of the chain of else ifs that
+// contains position, and the function declaring it.
+func ifChainAt(fileSet *token.FileSet, astFile *ast.File, position Position) (*ast.FuncDecl, *ast.IfStmt) {
+	tokenFile := fileSet.File(astFile.Pos())
+	if position.Line < 1 || position.Line > tokenFile.LineCount() {
+		return nil, nil
+	}
+	pos := tokenFile.LineStart(position.Line) + token.Pos(position.Column-1)
+	path, _ := astutil.PathEnclosingInterval(astFile, pos, pos)
+	var ifStmt *ast.IfStmt
+	for i, node := range path {
+		switch typedNode := node.(type) {
+		case *ast.IfStmt:
+			if ifStmt == nil {
+				ifStmt = typedNode
+			} else if typedNode.Else == path[i-1] {
+				ifStmt = typedNode
+			}
+		case *ast.FuncLit:
+			if ifStmt != nil {
+				return nil, nil
+			}
+		case *ast.FuncDecl:
+			if ifStmt == nil {
+				return nil, nil
+			}
+			return typedNode, ifStmt
+		}
+	}
+	return nil, nil
+}
+
+// conditionalParts returns the selections of the conditions and the bodies
+// of ifStmt and the else ifs chained to it, in source order. Conditions that
+// are single identifiers and bodies that are empty or a single expression
+// statement are left alone. Bodies assigning to local variables of funcDecl
+// declared outside of them are reported.
+func conditionalParts(fileSet *token.FileSet, funcDecl *ast.FuncDecl, ifStmt *ast.IfStmt) (parts []Selection, problems []Problem) {
+	addBody := func(body *ast.BlockStmt) {
+		if !worthExtracting(body.List) {
+			return
+		}
+		parts = append(parts, selectionOf(fileSet, body.List[0].Pos(), body.List[len(body.List)-1].End()))
+		problems = append(problems, outerAssignmentsIn(fileSet, funcDecl, body, "branch", "decompose")...)
+	}
+	for {
+		if _, isIdent := ifStmt.Cond.(*ast.Ident); !isIdent {
+			parts = append(parts, selectionOf(fileSet, ifStmt.Cond.Pos(), ifStmt.Cond.End()))
+		}
+		addBody(ifStmt.Body)
+		switch elseStmt := ifStmt.Else.(type) {
+		case *ast.IfStmt:
+			ifStmt = elseStmt
+			continue
+		case *ast.BlockStmt:
+			addBody(elseStmt)
+		}
+		return
+	}
+}
+
+func selectionOf(fileSet *token.FileSet, begin token.Pos, end token.Pos) Selection {
+	beginPosition, endPosition := fileSet.Position(begin), fileSet.Position(end)
+	return Selection{Position{beginPosition.Line, beginPosition.Column}, Position{endPosition.Line, endPosition.Column}}
+}
+
+// outerAssignmentsIn reports the assignments in node to local variables of
+// funcDecl declared outside of node. A function extracted from node would
+// only change its copies of them.
+func outerAssignmentsIn(fileSet *token.FileSet, funcDecl *ast.FuncDecl, node ast.Node, what string, rule string) (problems []Problem) {
+	for _, ident := range assignedIdentsIn(node) {
+		if ident.Obj == nil || ident.Obj.Decl == nil {
+			continue
+		}
+		declPos := ident.Obj.Decl.(ast.Node).Pos()
+		if funcDecl.Pos() <= declPos && declPos < funcDecl.End() && (declPos < node.Pos() || declPos >= node.End()) {
+			problems = append(problems, Problem{Rule: rule, Position: fileSet.Position(ident.Pos()), Message: fmt.Sprintf("The %v assigns to %v, which is declared outside of it", what, ident.Name)})
+		}
+	}
+	return
+}
+
+// declLineOf returns the line of the function or method declaration name,
+// given as Type.Method, in src.
+func declLineOf(src string, name string) int {
+	fileSet := token.NewFileSet()
+	astFile, err := parser.ParseFile(fileSet, "", src, 0)
+	util.PanicOnError(err)
+	return fileSet.Position(funcOrMethodDeclNamed(astFile, name).Pos()).Line
+}
+
+// assignedIdentsIn returns the identifiers that node assigns to without
+// declaring them.
+func assignedIdentsIn(node ast.Node) (idents []*ast.Ident) {
+	ast.Inspect(node, func(node ast.Node) bool {
+		switch stmt := node.(type) {
+		case *ast.AssignStmt:
+			if stmt.Tok != token.DEFINE {
+				for _, lhs := range stmt.Lhs {
+					if ident, isIdent := lhs.(*ast.Ident); isIdent {
+						idents = append(idents, ident)
+					}
+				}
+			}
+		case *ast.IncDecStmt:
+			if ident, isIdent := stmt.X.(*ast.Ident); isIdent {
+				idents = append(idents, ident)
+			}
+		}
+		return true
+	})
+	return
+}
@@ -0,0 +1,94 @@
+package goextract_test
+
+import (
+	. "github.com/petergtz/goextract"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("DecomposeConditional", func() {
+	It("extracts the conditions and branches of an if else chain", func() {
+		result, err := DecomposeConditional("", `package p
+
+func charge(count int, member bool, price int) int {
+	if count > 10 && member {
+		discount := price / 10
+		println(count*price - discount)
+	} else if count > 10 {
+		total := count * price
+		println(total)
+	} else {
+		println(count * price)
+	}
+	return count
+}
+`, Position{4, 5}, Options{})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Function.Name).To(Equal("checkCountMember"))
+		Expect(result.Changes[0].Modified).To(Equal(`package p
+
+func charge(count int, member bool, price int) int {
+	if checkCountMember(count, member) {
+		doPrintln2(count, price)
+	} else if checkCount(count) {
+		doPrintln(count, price)
+	} else {
+		println(count * price)
+	}
+	return count
+}
+
+func checkCountMember(count int, member bool) bool {
+	return count > 10 && member
+}
+
+func doPrintln2(count, price int) {
+	discount := price / 10
+	println(count*price - discount)
+}
+
+func checkCount(count int) bool {
+	return count > 10
+}
+
+func doPrintln(count, price int) {
+	total := count * price
+	println(total)
+}
+`))
+	})
+
+	It("refuses branches assigning to variables declared outside of them", func() {
+		_, err := DecomposeConditional("", `package p
+
+func sum(items []int) int {
+	total := 0
+	if len(items) > 3 {
+		total = items[0]
+		println(total)
+	}
+	return total
+}
+`, Position{5, 5}, Options{})
+
+		Expect(err).To(MatchError(ContainSubstring("The branch assigns to total, which is declared outside of it")))
+	})
+
+	It("changes nothing if one of the parts cannot be extracted", func() {
+		result, err := DecomposeConditional("", `package p
+
+func charge(count int, price int) int {
+	if count > 10 {
+		discount := price / 10
+		return count*price - discount
+	}
+	return count * price
+}
+`, Position{4, 5}, Options{})
+
+		Expect(err).To(HaveOccurred())
+		Expect(result.Changes).To(BeEmpty())
+	})
+})
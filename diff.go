@@ -0,0 +1,197 @@
+package goextract
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+type lineOp int
+
+const (
+	lineEqual lineOp = iota
+	lineDeleted
+	lineInserted
+)
+
+// lineEdit is one line of a line based diff. oldLine and newLine are zero based
+// indices into the old and new lines; the one that does not apply is -1.
+type lineEdit struct {
+	op               lineOp
+	oldLine, newLine int
+}
+
+func splitLines(s string) []string {
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// lineDiff computes a shortest edit script from oldLines to newLines using
+// Myers' algorithm.
+func lineDiff(oldLines, newLines []string) []lineEdit {
+	n, m := len(oldLines), len(newLines)
+	max := n + m
+	v := make([]int, 2*max+2)
+	var trace [][]int
+	for d := 0; d <= max; d++ {
+		vCopy := make([]int, len(v))
+		copy(vCopy, v)
+		trace = append(trace, vCopy)
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[max+k-1] < v[max+k+1]) {
+				x = v[max+k+1]
+			} else {
+				x = v[max+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && oldLines[x] == newLines[y] {
+				x++
+				y++
+			}
+			v[max+k] = x
+			if x >= n && y >= m {
+				return backtrack(trace, n, m, max)
+			}
+		}
+	}
+	panic("Unexpected: no edit script found")
+}
+
+func backtrack(trace [][]int, n, m, max int) []lineEdit {
+	var reversed []lineEdit
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[max+k-1] < v[max+k+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[max+prevK]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			x--
+			y--
+			reversed = append(reversed, lineEdit{lineEqual, x, y})
+		}
+		if d > 0 {
+			if x == prevX {
+				y--
+				reversed = append(reversed, lineEdit{lineInserted, -1, y})
+			} else {
+				x--
+				reversed = append(reversed, lineEdit{lineDeleted, x, -1})
+			}
+		}
+	}
+	edits := make([]lineEdit, len(reversed))
+	for i, edit := range reversed {
+		edits[len(reversed)-1-i] = edit
+	}
+	return edits
+}
+
+const diffContextLines = 3
+
+// UnifiedDiff returns the changes between original and modified in unified
+// diff format, like diff -u does. It returns an empty string if there are none.
+func UnifiedDiff(filename string, original string, modified string) string {
+	if original == modified {
+		return ""
+	}
+	oldLines, newLines := diffLinesOf(original), diffLinesOf(modified)
+	edits := lineDiff(oldLines, newLines)
+	buf := new(bytes.Buffer)
+	fmt.Fprintf(buf, "--- %v.orig\n+++ %v\n", filename, filename)
+	for _, hunk := range hunksFrom(edits) {
+		writeHunk(buf, edits, hunk, oldLines, newLines)
+	}
+	return buf.String()
+}
+
+// diffLinesOf splits s into lines, marking a missing newline at the end of s
+// the same way diff does.
+func diffLinesOf(s string) []string {
+	if s == "" {
+		return nil
+	}
+	lines := splitLines(s)
+	if !strings.HasSuffix(s, "\n") {
+		lines[len(lines)-1] += "\n\\ No newline at end of file"
+	}
+	return lines
+}
+
+type hunk struct {
+	begin, end int
+}
+
+// hunksFrom groups the changes in edits together with their surrounding
+// context lines. Hunks whose context would overlap are merged.
+func hunksFrom(edits []lineEdit) (hunks []hunk) {
+	for i, edit := range edits {
+		if edit.op == lineEqual {
+			continue
+		}
+		begin, end := i-diffContextLines, i+1+diffContextLines
+		if begin < 0 {
+			begin = 0
+		}
+		if end > len(edits) {
+			end = len(edits)
+		}
+		if len(hunks) != 0 && begin <= hunks[len(hunks)-1].end {
+			hunks[len(hunks)-1].end = end
+		} else {
+			hunks = append(hunks, hunk{begin, end})
+		}
+	}
+	return
+}
+
+func writeHunk(buf *bytes.Buffer, edits []lineEdit, hunk hunk, oldLines, newLines []string) {
+	oldStart, newStart := 0, 0
+	for _, edit := range edits[:hunk.begin] {
+		if edit.op != lineInserted {
+			oldStart++
+		}
+		if edit.op != lineDeleted {
+			newStart++
+		}
+	}
+	oldCount, newCount := 0, 0
+	for _, edit := range edits[hunk.begin:hunk.end] {
+		if edit.op != lineInserted {
+			oldCount++
+		}
+		if edit.op != lineDeleted {
+			newCount++
+		}
+	}
+	fmt.Fprintf(buf, "@@ -%v +%v @@\n", hunkRange(oldStart, oldCount), hunkRange(newStart, newCount))
+	for _, edit := range edits[hunk.begin:hunk.end] {
+		switch edit.op {
+		case lineEqual:
+			fmt.Fprintf(buf, " %v\n", oldLines[edit.oldLine])
+		case lineDeleted:
+			fmt.Fprintf(buf, "-%v\n", oldLines[edit.oldLine])
+		case lineInserted:
+			fmt.Fprintf(buf, "+%v\n", newLines[edit.newLine])
+		}
+	}
+}
+
+// hunkRange formats the line range of a hunk. An empty range refers to the line
+// before the hunk, as diff -u does it.
+func hunkRange(start int, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%v,0", start)
+	case 1:
+		return fmt.Sprintf("%v", start+1)
+	default:
+		return fmt.Sprintf("%v,%v", start+1, count)
+	}
+}
@@ -0,0 +1,83 @@
+package goextract_test
+
+import (
+	. "github.com/petergtz/goextract"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Diff", func() {
+	It("is empty without changes", func() {
+		Expect(UnifiedDiff("a.go", "a\nb\n", "a\nb\n")).To(BeEmpty())
+	})
+
+	It("shows changes with three lines of context", func() {
+		Expect(UnifiedDiff("a.go", "1\n2\n3\n4\n5\n6\n7\n8\n9\n", "1\n2\n3\n4\nfive\n6\n7\n8\n9\n")).To(Equal(
+			`--- a.go.orig
++++ a.go
+@@ -2,7 +2,7 @@
+ 2
+ 3
+ 4
+-5
++five
+ 6
+ 7
+ 8
+`))
+	})
+
+	It("splits distant changes into several hunks", func() {
+		Expect(UnifiedDiff("a.go", "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n", "one\n2\n3\n4\n5\n6\n7\n8\n9\n")).To(Equal(
+			`--- a.go.orig
++++ a.go
+@@ -1,4 +1,4 @@
+-1
++one
+ 2
+ 3
+ 4
+@@ -7,4 +7,3 @@
+ 7
+ 8
+ 9
+-10
+`))
+	})
+
+	It("marks a missing newline at the end of a file", func() {
+		Expect(UnifiedDiff("a.go", "a\nb", "a\nb\n")).To(Equal(
+			`--- a.go.orig
++++ a.go
+@@ -1,2 +1,2 @@
+ a
+-b
+\ No newline at end of file
++b
+`))
+	})
+
+	It("shows the changes of an extraction", func() {
+		result, err := ExtractFile("test_data/one_simple_statement.go.input", Selection{Position{9, 2}, Position{9, 5}}, "MyExtractedFunc", Options{})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(result.Changes).To(HaveLen(1))
+		change := result.Changes[0]
+		Expect(UnifiedDiff(change.Filename, change.Original, change.Modified)).To(Equal(
+			"--- test_data/one_simple_statement.go.input.orig\n" +
+				"+++ test_data/one_simple_statement.go.input\n" +
+				"@@ -6,6 +6,10 @@\n" +
+				" \n" +
+				" func f() {\n" +
+				" \tg()\n" +
+				"-\th()\n" +
+				"+\tMyExtractedFunc()\n" +
+				" \ti()\n" +
+				" }\n" +
+				"+\n" +
+				"+func MyExtractedFunc() {\n" +
+				"+\th()\n" +
+				"+}\n"))
+	})
+})
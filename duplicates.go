@@ -0,0 +1,432 @@
+package goextract
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/token"
+	"go/types"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/petergtz/goextract/util"
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// DuplicateScope determines where to look for duplicates of the extracted code.
+type DuplicateScope int
+
+const (
+	NoDuplicates DuplicateScope = iota
+	DuplicatesInFunction
+	DuplicatesInFile
+	DuplicatesInPackage
+)
+
+// Duplicate is a fragment of code that is structurally equivalent to the
+// extracted code, up to the names of local variables, and can be replaced by
+// Call.
+type Duplicate struct {
+	Position token.Position
+	Call     string
+}
+
+func (duplicate Duplicate) String() string {
+	return fmt.Sprintf("%v: can be replaced by %v", duplicate.Position, duplicate.Call)
+}
+
+type duplicate struct {
+	Duplicate
+	begin, end int
+}
+
+// duplicateFinder matches fragments against the body of the extracted function.
+type duplicateFinder struct {
+	fileSet  *token.FileSet
+	info     *types.Info
+	pkg      *types.Package
+	funcDecl *ast.FuncDecl
+	params   []types.Object
+	// pattern is the extracted statements, or a single expression.
+	pattern []ast.Node
+	results []types.Object
+
+	// assigned holds the expressions that are assigned to, which cannot be
+	// replaced by a call.
+	assigned map[ast.Node]bool
+
+	fragmentBegin, fragmentEnd token.Pos
+	mapping                    map[types.Object]types.Object
+	mapped                     map[types.Object]bool
+}
+
+// findDuplicates looks for duplicates of the extracted function funcName in
+// src and, with DuplicatesInPackage, in the other files of its package.
+// The result maps filenames to the duplicates in them.
+func findDuplicates(checker *packageChecker, src string, funcName string, scope DuplicateScope) map[string][]duplicate {
+	checked := checker.check(src, 0)
+	fileSet, astFile, files, pkg, info := checked.fileSet, checked.astFile, checked.files, checked.pkg, checked.info
+
+	finder := &duplicateFinder{
+		fileSet:  fileSet,
+		info:     info,
+		pkg:      pkg,
+		funcDecl: funcDeclNamed(astFile, funcName),
+		assigned: make(map[ast.Node]bool),
+	}
+	if !finder.preparePattern() {
+		return nil
+	}
+	searched := []ast.Node{astFile}
+	switch scope {
+	case DuplicatesInFunction:
+		searched = nil
+		if call := callOf(astFile, finder.funcDecl, funcName); call != nil {
+			for _, decl := range astFile.Decls {
+				if decl.Pos() <= call.Pos() && call.End() <= decl.End() {
+					searched = []ast.Node{decl}
+				}
+			}
+		}
+	case DuplicatesInPackage:
+		for _, file := range files[1:] {
+			searched = append(searched, file)
+		}
+	}
+	for _, node := range searched {
+		ast.Inspect(node, func(node ast.Node) bool {
+			switch typedNode := node.(type) {
+			case *ast.AssignStmt:
+				for _, lhs := range typedNode.Lhs {
+					finder.assigned[lhs] = true
+				}
+			case *ast.IncDecStmt:
+				finder.assigned[typedNode.X] = true
+			case *ast.UnaryExpr:
+				if typedNode.Op == token.AND {
+					finder.assigned[typedNode.X] = true
+				}
+			}
+			return true
+		})
+	}
+	duplicates := make(map[string][]duplicate)
+	for _, node := range searched {
+		ast.Inspect(node, func(node ast.Node) bool {
+			if node == finder.funcDecl {
+				return false
+			}
+			if _, isExpr := finder.pattern[0].(ast.Expr); isExpr {
+				if expr, isExpr := node.(ast.Expr); isExpr && finder.matches([]ast.Node{expr}) {
+					duplicates[finder.filenameOf(expr)] = append(duplicates[finder.filenameOf(expr)], finder.duplicateAt([]ast.Node{expr}, funcName))
+					return false
+				}
+				return true
+			}
+			if stmts := stmtListOf(node); stmts != nil {
+				for i := 0; i+len(finder.pattern) <= len(stmts); i++ {
+					fragment := make([]ast.Node, len(finder.pattern))
+					for j := range fragment {
+						fragment[j] = stmts[i+j]
+					}
+					if finder.matches(fragment) {
+						duplicates[finder.filenameOf(fragment[0])] = append(duplicates[finder.filenameOf(fragment[0])], finder.duplicateAt(fragment, funcName))
+						i += len(fragment) - 1
+					}
+				}
+			}
+			return true
+		})
+	}
+	return duplicates
+}
+
+// preparePattern determines the parameters, the pattern and the results of the
+// extracted function. Functions assigning to their parameters have no
+// duplicates, because the calls could not change the variables passed.
+func (finder *duplicateFinder) preparePattern() bool {
+	for _, field := range finder.funcDecl.Type.Params.List {
+		for _, name := range field.Names {
+			finder.params = append(finder.params, finder.info.Defs[name])
+		}
+	}
+	body := finder.funcDecl.Body.List
+	if len(body) == 0 {
+		return false
+	}
+	returnStmt, isReturn := body[len(body)-1].(*ast.ReturnStmt)
+	switch {
+	case len(body) == 1 && isReturn && len(returnStmt.Results) == 1:
+		if _, isIdent := returnStmt.Results[0].(*ast.Ident); isIdent {
+			return false
+		}
+		finder.pattern = []ast.Node{returnStmt.Results[0]}
+	case isReturn:
+		for _, result := range returnStmt.Results {
+			ident, isIdent := result.(*ast.Ident)
+			if !isIdent {
+				return false
+			}
+			finder.results = append(finder.results, finder.info.Uses[ident])
+		}
+		body = body[:len(body)-1]
+		fallthrough
+	default:
+		for _, stmt := range body {
+			finder.pattern = append(finder.pattern, stmt)
+		}
+	}
+	assignsParam := false
+	isParam := func(expr ast.Expr) bool {
+		ident, isIdent := astutil.Unparen(expr).(*ast.Ident)
+		if !isIdent {
+			return false
+		}
+		for _, param := range finder.params {
+			if finder.info.Uses[ident] == param {
+				return true
+			}
+		}
+		return false
+	}
+	ast.Inspect(finder.funcDecl.Body, func(node ast.Node) bool {
+		switch typedNode := node.(type) {
+		case *ast.AssignStmt:
+			for _, lhs := range typedNode.Lhs {
+				assignsParam = assignsParam || (typedNode.Tok != token.DEFINE && isParam(lhs))
+			}
+		case *ast.IncDecStmt:
+			assignsParam = assignsParam || isParam(typedNode.X)
+		case *ast.UnaryExpr:
+			assignsParam = assignsParam || (typedNode.Op == token.AND && isParam(typedNode.X))
+		case *ast.RangeStmt:
+			assignsParam = assignsParam || (typedNode.Tok == token.ASSIGN && (isParam(typedNode.Key) || isParam(typedNode.Value)))
+		}
+		return true
+	})
+	return !assignsParam
+}
+
+func stmtListOf(node ast.Node) []ast.Stmt {
+	switch typedNode := node.(type) {
+	case *ast.BlockStmt:
+		return typedNode.List
+	case *ast.CaseClause:
+		return typedNode.Body
+	case *ast.CommClause:
+		return typedNode.Body
+	}
+	return nil
+}
+
+func (finder *duplicateFinder) filenameOf(node ast.Node) string {
+	return finder.fileSet.Position(node.Pos()).Filename
+}
+
+func (finder *duplicateFinder) matches(fragment []ast.Node) bool {
+	finder.fragmentBegin, finder.fragmentEnd = fragment[0].Pos(), fragment[len(fragment)-1].End()
+	finder.mapping = make(map[types.Object]types.Object)
+	finder.mapped = make(map[types.Object]bool)
+	if len(fragment) == 1 && finder.assigned[fragment[0]] {
+		return false
+	}
+	for i := range fragment {
+		if !finder.equal(reflect.ValueOf(finder.pattern[i]), reflect.ValueOf(fragment[i])) {
+			return false
+		}
+	}
+	for _, param := range finder.params {
+		if finder.mapping[param] == nil {
+			return false
+		}
+	}
+	// Locals of the fragment used afterwards must be results of the function.
+	for patternObject, fragmentObject := range finder.mapping {
+		isResult := false
+		for _, result := range finder.results {
+			isResult = isResult || patternObject == result
+		}
+		if !isResult && fragmentObject.Pos() >= finder.fragmentBegin && finder.usedAfterFragment(fragmentObject) {
+			return false
+		}
+	}
+	return true
+}
+
+var (
+	identType       = reflect.TypeOf((*ast.Ident)(nil))
+	posType         = reflect.TypeOf(token.NoPos)
+	objectType      = reflect.TypeOf((*ast.Object)(nil))
+	commentType     = reflect.TypeOf((*ast.CommentGroup)(nil))
+	scopeType       = reflect.TypeOf((*ast.Scope)(nil))
+	ignoredASTTypes = map[reflect.Type]bool{objectType: true, commentType: true, scopeType: true}
+)
+
+// equal compares pattern and fragment structurally, ignoring positions, and
+// compares identifiers with identsMatch.
+func (finder *duplicateFinder) equal(pattern reflect.Value, fragment reflect.Value) bool {
+	if pattern.Type() != fragment.Type() {
+		return false
+	}
+	switch pattern.Kind() {
+	case reflect.Interface:
+		if pattern.IsNil() || fragment.IsNil() {
+			return pattern.IsNil() && fragment.IsNil()
+		}
+		return finder.equal(pattern.Elem(), fragment.Elem())
+	case reflect.Ptr:
+		if ignoredASTTypes[pattern.Type()] {
+			return true
+		}
+		if pattern.IsNil() || fragment.IsNil() {
+			return pattern.IsNil() && fragment.IsNil()
+		}
+		if pattern.Type() == identType {
+			return finder.identsMatch(pattern.Interface().(*ast.Ident), fragment.Interface().(*ast.Ident))
+		}
+		return finder.equal(pattern.Elem(), fragment.Elem())
+	case reflect.Struct:
+		for i := 0; i < pattern.NumField(); i++ {
+			if pattern.Type().Field(i).Type != posType && !finder.equal(pattern.Field(i), fragment.Field(i)) {
+				return false
+			}
+		}
+		return true
+	case reflect.Slice:
+		if pattern.Len() != fragment.Len() {
+			return false
+		}
+		for i := 0; i < pattern.Len(); i++ {
+			if !finder.equal(pattern.Index(i), fragment.Index(i)) {
+				return false
+			}
+		}
+		return true
+	default:
+		return pattern.Interface() == fragment.Interface()
+	}
+}
+
+// identsMatch requires parameters and locals of the extracted function to
+// correspond one to one to locals declared outside and inside the fragment,
+// and all other identifiers to denote the same objects.
+func (finder *duplicateFinder) identsMatch(pattern *ast.Ident, fragment *ast.Ident) bool {
+	patternObject, fragmentObject := finder.info.ObjectOf(pattern), finder.info.ObjectOf(fragment)
+	if patternObject == nil || fragmentObject == nil {
+		return patternObject == nil && fragmentObject == nil && pattern.Name == fragment.Name
+	}
+	isParam := false
+	for _, param := range finder.params {
+		isParam = isParam || patternObject == param
+	}
+	isLocal := patternObject.Pos() >= finder.funcDecl.Body.Pos() && patternObject.Pos() < finder.funcDecl.Body.End()
+	if !isParam && !isLocal {
+		if patternPkgName, isPkgName := patternObject.(*types.PkgName); isPkgName {
+			fragmentPkgName, isPkgName := fragmentObject.(*types.PkgName)
+			return isPkgName && patternPkgName.Imported() == fragmentPkgName.Imported()
+		}
+		return patternObject == fragmentObject
+	}
+	if mapped, found := finder.mapping[patternObject]; found {
+		return mapped == fragmentObject
+	}
+	fragmentVar, isVar := fragmentObject.(*types.Var)
+	if !isVar || fragmentVar.IsField() || finder.mapped[fragmentObject] ||
+		fragmentVar.Parent() == nil || fragmentVar.Parent() == finder.pkg.Scope() ||
+		!types.Identical(patternObject.Type(), fragmentObject.Type()) {
+		return false
+	}
+	declaredInFragment := fragmentObject.Pos() >= finder.fragmentBegin && fragmentObject.Pos() < finder.fragmentEnd
+	if declaredInFragment != isLocal {
+		return false
+	}
+	finder.mapping[patternObject] = fragmentObject
+	finder.mapped[fragmentObject] = true
+	return true
+}
+
+// duplicateAt describes how to replace fragment, which matches.
+func (finder *duplicateFinder) duplicateAt(fragment []ast.Node, funcName string) duplicate {
+	var args []string
+	for _, param := range finder.params {
+		args = append(args, finder.mapping[param].Name())
+	}
+	call := funcName + "(" + strings.Join(args, ", ") + ")"
+	var lhs []string
+	used := false
+	for _, result := range finder.results {
+		name := "_"
+		if finder.usedAfterFragment(finder.mapping[result]) {
+			name = finder.mapping[result].Name()
+			used = true
+		}
+		lhs = append(lhs, name)
+	}
+	if used {
+		call = strings.Join(lhs, ", ") + " := " + call
+	}
+	begin, end := finder.fileSet.Position(finder.fragmentBegin), finder.fileSet.Position(finder.fragmentEnd)
+	return duplicate{Duplicate: Duplicate{Position: begin, Call: call}, begin: begin.Offset, end: end.Offset}
+}
+
+func (finder *duplicateFinder) usedAfterFragment(object types.Object) bool {
+	for ident, usedObject := range finder.info.Uses {
+		if usedObject == object && ident.Pos() >= finder.fragmentEnd {
+			return true
+		}
+	}
+	return false
+}
+
+// replaceDuplicates replaces all duplicates in src by their calls.
+func replaceDuplicates(src string, duplicates []duplicate) string {
+	sort.Slice(duplicates, func(i, j int) bool { return duplicates[i].begin > duplicates[j].begin })
+	for _, duplicate := range duplicates {
+		src = src[:duplicate.begin] + duplicate.Call + src[duplicate.end:]
+	}
+	formatted, err := format.Source([]byte(src))
+	util.PanicOnError(err)
+	return string(formatted)
+}
+
+// handleDuplicates finds the duplicates of the extracted function in src as
+// requested by options and replaces them if requested. Duplicates in other
+// files of the package are replaced in the returned changes.
+func handleDuplicates(checker *packageChecker, original string, src string, selection Selection, funcName string, options Options) (string, []Duplicate, []FileChange, error) {
+	if options.Duplicates == NoDuplicates {
+		return src, nil, nil, nil
+	}
+	filename := checker.filename
+	found := findDuplicates(checker, src, funcName, options.Duplicates)
+	mapper := newPositionMapper(original, src, selection)
+	var duplicates []Duplicate
+	var otherChanges []FileChange
+	var otherFilenames []string
+	for duplicateFilename := range found {
+		if duplicateFilename != filename {
+			otherFilenames = append(otherFilenames, duplicateFilename)
+		}
+	}
+	sort.Strings(otherFilenames)
+	for _, duplicateFilename := range append([]string{filename}, otherFilenames...) {
+		for _, duplicate := range found[duplicateFilename] {
+			if duplicateFilename == filename {
+				duplicate.Position = mapper.mapToOriginal(Problem{Position: duplicate.Position}).Position
+			}
+			duplicates = append(duplicates, duplicate.Duplicate)
+		}
+	}
+	if !options.ReplaceDuplicates {
+		return src, duplicates, nil, nil
+	}
+	if len(otherFilenames) != 0 && options.Placement == PlaceInFile {
+		return "", nil, nil, errors.New("Cannot replace duplicates in other files when placing the function in another file")
+	}
+	for _, otherFilename := range otherFilenames {
+		otherOriginal := options.Overlay.ReadFile(otherFilename)
+		otherChanges = append(otherChanges, FileChange{Filename: otherFilename, Original: otherOriginal, Modified: replaceDuplicates(otherOriginal, found[otherFilename])})
+	}
+	return replaceDuplicates(src, found[filename]), duplicates, otherChanges, nil
+}
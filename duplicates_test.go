@@ -0,0 +1,77 @@
+package goextract_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/petergtz/goextract"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Duplicates", func() {
+	const src = `package p
+
+func f(a int, b int) {
+	x := a * 2
+	y := x + b
+	println(y)
+	m := b * 2
+	n := m + a
+	println(n)
+	k := b * 2
+	l := k + a
+	println(k, l)
+}
+
+func g(c int, d int) int {
+	p := c * 2
+	q := p + d
+	return q * 2
+}
+`
+	selection := Selection{Position{4, 2}, Position{5, 12}}
+
+	It("lists duplicates with renamed locals, but not those whose locals are used afterwards", func() {
+		result, err := ExtractSource("", src, selection, "h", Options{Duplicates: DuplicatesInFile})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Duplicates).To(HaveLen(2))
+		Expect(result.Duplicates[0].String()).To(Equal("7:2: can be replaced by n := h(b, a)"))
+		Expect(result.Duplicates[1].String()).To(Equal("16:2: can be replaced by q := h(c, d)"))
+		Expect(result.Changes[0].Modified).To(ContainSubstring("\tm := b * 2\n"))
+	})
+
+	It("only looks in the enclosing function if asked to", func() {
+		result, err := ExtractSource("", src, selection, "h", Options{Duplicates: DuplicatesInFunction})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Duplicates).To(HaveLen(1))
+	})
+
+	It("replaces the duplicates", func() {
+		output, _, err := ExtractStringToString(src, selection, "h", Options{Duplicates: DuplicatesInFile, ReplaceDuplicates: true})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(output).To(ContainSubstring("\ty := h(a, b)\n\tprintln(y)\n\tn := h(b, a)\n\tprintln(n)\n\tk := b * 2\n"))
+		Expect(output).To(ContainSubstring("\tq := h(c, d)\n\treturn q * 2\n"))
+	})
+
+	It("replaces duplicates of expressions in other files of the package", func() {
+		dir, err := ioutil.TempDir("", "goextract-duplicates")
+		Expect(err).NotTo(HaveOccurred())
+		defer os.RemoveAll(dir)
+		Expect(ioutil.WriteFile(filepath.Join(dir, "a.go"), []byte("package p\n\nfunc f(a int) int {\n\treturn a*a + 1\n}\n"), 0644)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(dir, "b.go"), []byte("package p\n\nfunc g(b int) {\n\tprintln(b*b + 1)\n}\n"), 0644)).To(Succeed())
+
+		result, err := ExtractFile(filepath.Join(dir, "a.go"), Selection{Position{4, 9}, Position{4, 16}}, "square",
+			Options{Duplicates: DuplicatesInPackage, ReplaceDuplicates: true})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Changes).To(HaveLen(2))
+		Expect(result.Changes[1].Filename).To(Equal(filepath.Join(dir, "b.go")))
+		Expect(result.Changes[1].Modified).To(Equal("package p\n\nfunc g(b int) {\n\tprintln(square(b))\n}\n"))
+	})
+})
@@ -0,0 +1,142 @@
+package goextract
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"strings"
+
+	"github.com/petergtz/goextract/util"
+)
+
+type TextPosition struct {
+	Offset int `json:"offset"`
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+// TextEdit replaces the text between Start and End of the original file with NewText.
+type TextEdit struct {
+	Start   TextPosition `json:"start"`
+	End     TextPosition `json:"end"`
+	NewText string       `json:"newText"`
+}
+
+// TextEditsFrom computes line based edits that turn original into modified.
+func TextEditsFrom(original string, modified string) []TextEdit {
+	oldLines, newLines := linesWithNewlinesOf(original), linesWithNewlinesOf(modified)
+	lineOffsets := make([]int, len(oldLines)+1)
+	for i, line := range oldLines {
+		lineOffsets[i+1] = lineOffsets[i] + len(line)
+	}
+	var edits []TextEdit
+	var current *TextEdit
+	oldLine := 0
+	for _, edit := range lineDiff(oldLines, newLines) {
+		if edit.op == lineEqual {
+			if current != nil {
+				current.End = textPositionAt(original, lineOffsets[oldLine])
+				edits = append(edits, *current)
+				current = nil
+			}
+			oldLine++
+			continue
+		}
+		if current == nil {
+			current = &TextEdit{Start: textPositionAt(original, lineOffsets[oldLine])}
+		}
+		if edit.op == lineDeleted {
+			oldLine++
+		} else {
+			current.NewText += newLines[edit.newLine]
+		}
+	}
+	if current != nil {
+		current.End = textPositionAt(original, lineOffsets[oldLine])
+		edits = append(edits, *current)
+	}
+	return edits
+}
+
+func linesWithNewlinesOf(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+func textPositionAt(text string, offset int) TextPosition {
+	line := strings.Count(text[:offset], "\n") + 1
+	return TextPosition{
+		Offset: offset,
+		Line:   line,
+		Column: offset - strings.LastIndex(text[:offset], "\n"),
+	}
+}
+
+// FunctionInfo describes the extracted function as it appears in the modified file.
+type FunctionInfo struct {
+	Filename  string       `json:"filename"`
+	Name      string       `json:"name"`
+	NameStart TextPosition `json:"nameStart"`
+	NameEnd   TextPosition `json:"nameEnd"`
+	Signature string       `json:"signature"`
+	Params    []Var        `json:"params"`
+	Results   []Var        `json:"results"`
+}
+
+type Var struct {
+	Name string `json:"name,omitempty"`
+	Type string `json:"type"`
+}
+
+func functionInfoFrom(filename string, src string, funcName string) FunctionInfo {
+	fileSet := token.NewFileSet()
+	astFile, err := parser.ParseFile(fileSet, filename, src, 0)
+	util.PanicOnError(err)
+	var funcDecl *ast.FuncDecl
+	for _, decl := range astFile.Decls {
+		if candidate, ok := decl.(*ast.FuncDecl); ok && candidate.Recv == nil && candidate.Name.Name == funcName {
+			funcDecl = candidate
+		}
+	}
+	if funcDecl == nil {
+		panic("Unexpected: extracted function " + funcName + " not found")
+	}
+	return FunctionInfo{
+		Filename:  filename,
+		Name:      funcName,
+		NameStart: textPositionAt(src, fileSet.Position(funcDecl.Name.Pos()).Offset),
+		NameEnd:   textPositionAt(src, fileSet.Position(funcDecl.Name.End()).Offset),
+		Signature: nodeString(fileSet, &ast.FuncDecl{Name: funcDecl.Name, Type: funcDecl.Type}),
+		Params:    varsFrom(fileSet, funcDecl.Type.Params),
+		Results:   varsFrom(fileSet, funcDecl.Type.Results),
+	}
+}
+
+func varsFrom(fileSet *token.FileSet, fieldList *ast.FieldList) []Var {
+	vars := []Var{}
+	if fieldList == nil {
+		return vars
+	}
+	for _, field := range fieldList.List {
+		typeString := nodeString(fileSet, field.Type)
+		if len(field.Names) == 0 {
+			vars = append(vars, Var{Type: typeString})
+		}
+		for _, name := range field.Names {
+			vars = append(vars, Var{Name: name.Name, Type: typeString})
+		}
+	}
+	return vars
+}
+
+func nodeString(fileSet *token.FileSet, node ast.Node) string {
+	buf := new(bytes.Buffer)
+	err := printer.Fprint(buf, fileSet, node)
+	util.PanicOnError(err)
+	return buf.String()
+}
@@ -0,0 +1,93 @@
+package goextract_test
+
+import (
+	"encoding/json"
+
+	. "github.com/petergtz/goextract"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func apply(edits []TextEdit, original string) string {
+	result := original
+	for i := len(edits) - 1; i >= 0; i-- {
+		result = result[:edits[i].Start.Offset] + edits[i].NewText + result[edits[i].End.Offset:]
+	}
+	return result
+}
+
+var _ = Describe("Edits", func() {
+	It("turn the original into the modified text", func() {
+		original := "a\nb\nc\nd\ne\n"
+		modified := "a\nB\nc\nd\ne\nf\n"
+
+		edits := TextEditsFrom(original, modified)
+
+		Expect(edits).To(Equal([]TextEdit{
+			{Start: TextPosition{2, 2, 1}, End: TextPosition{4, 3, 1}, NewText: "B\n"},
+			{Start: TextPosition{10, 6, 1}, End: TextPosition{10, 6, 1}, NewText: "f\n"},
+		}))
+		Expect(apply(edits, original)).To(Equal(modified))
+	})
+
+	It("handle a missing newline at the end", func() {
+		original := "a\nb"
+		modified := "a\nb\n"
+
+		Expect(apply(TextEditsFrom(original, modified), original)).To(Equal(modified))
+	})
+
+	It("are part of the JSON output together with the extracted function", func() {
+		var output struct {
+			Files []struct {
+				Filename string
+				Edits    []TextEdit
+			}
+			Function FunctionInfo
+			Warnings []interface{}
+		}
+		result, err := ExtractFile("test_data/multiple_simple_statements_taking_parameters_used_afterwards.go.input",
+			Selection{Position{9, 2}, Position{11, 5}}, "MyExtractedFunc", Options{})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(json.Unmarshal(JSONFrom(result, err), &output)).To(Succeed())
+
+		Expect(output.Files).To(HaveLen(1))
+		Expect(apply(output.Files[0].Edits, result.Changes[0].Original)).To(Equal(result.Changes[0].Modified))
+		Expect(output.Function.Name).To(Equal("MyExtractedFunc"))
+		Expect(output.Function.Signature).To(Equal("func MyExtractedFunc() int"))
+		Expect(output.Function.Params).To(BeEmpty())
+		Expect(output.Function.Results).To(Equal([]Var{{Type: "int"}}))
+		Expect(output.Function.NameStart.Line).To(Equal(output.Function.NameEnd.Line))
+		Expect(output.Function.NameEnd.Column - output.Function.NameStart.Column).To(Equal(len("MyExtractedFunc")))
+		Expect(output.Warnings).To(BeEmpty())
+	})
+
+	It("are part of the JSON output without a function for other refactorings", func() {
+		var output map[string]interface{}
+		result, err := ExtractVariableFromSource("", "package p\n\nfunc f() int {\n\treturn 1 + 2\n}\n",
+			Selection{Position{4, 9}, Position{4, 14}}, "sum", Options{})
+		Expect(err).NotTo(HaveOccurred())
+
+		Expect(json.Unmarshal(JSONFrom(result, err), &output)).To(Succeed())
+
+		Expect(output["files"]).To(HaveLen(1))
+		Expect(output).NotTo(HaveKey("function"))
+	})
+
+	It("contain the problems in the JSON output if the extraction fails", func() {
+		var output struct {
+			Error    string
+			Problems []struct{ Rule string }
+		}
+		selection := Selection{Position{21, 2}, Position{46, 3}}
+		result, err := ExtractFile("test_data/type_switch_statement.go.input", selection, "MyExtractedFunc", Options{})
+
+		Expect(json.Unmarshal(JSONFrom(result, err), &output)).To(Succeed())
+
+		Expect(output.Error).NotTo(BeEmpty())
+		Expect(output.Problems).To(HaveLen(1))
+		Expect(output.Problems[0].Rule).To(Equal("typecheck"))
+	})
+})
@@ -0,0 +1,318 @@
+package goextract
+
+import (
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/petergtz/goextract/util"
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// returnErrors turns the extracted function funcName into one returning an
+// error if the extracted statements contain guards like
+//
+//	if err != nil {
+//		return 0, err
+//	}
+//
+// The guards return the error from the function instead, and its call
+// returns the error from the enclosing function with zero values for the
+// other results. If the error is used after the extracted statements and
+// thus already a result, it becomes the error result. With wrapErrors, the errors are wrapped with the function
+// name. src is returned unchanged if the function contains other returns or
+// the enclosing function does not return an error.
+func returnErrors(checker *packageChecker, src string, funcName string, wrapErrors bool) string {
+	checked := checker.check(src, parser.ParseComments)
+	fileSet, astFile, pkg, info := checked.fileSet, checked.astFile, checked.pkg, checked.info
+
+	funcDecl := funcDeclNamed(astFile, funcName)
+	call := callOf(astFile, funcDecl, funcName)
+	if call == nil {
+		return src
+	}
+	path, _ := astutil.PathEnclosingInterval(astFile, call.Pos(), call.End())
+	callStmt, enclosingResults := callStmtAndEnclosingResultsOf(path, info)
+	if callStmt == nil || enclosingResults == nil || enclosingResults.Len() == 0 ||
+		!types.Identical(enclosingResults.At(enclosingResults.Len()-1).Type(), types.Universe.Lookup("error").Type()) {
+		return src
+	}
+	guards, finalReturn, ok := guardsIn(funcDecl, enclosingResults.Len())
+	if !ok || len(guards) == 0 {
+		return src
+	}
+
+	qualifier := func(other *types.Package) string {
+		if other == pkg {
+			return ""
+		}
+		return other.Name()
+	}
+	textOf := func(node ast.Node) string {
+		return src[fileSet.Position(node.Pos()).Offset:fileSet.Position(node.End()).Offset]
+	}
+	var edits []textEdit
+	replace := func(node ast.Node, text string) {
+		edits = append(edits, textEdit{fileSet.Position(node.Pos()).Offset, fileSet.Position(node.End()).Offset, text})
+	}
+
+	// The error of the guards is already a result if it is used after the
+	// extracted statements. It becomes the trailing error result then.
+	errResult := errorResultIndex(funcDecl, finalReturn, guards, info)
+	var resultTypes, zeroResults, finalResults []string
+	if funcDecl.Type.Results != nil {
+		for i, field := range funcDecl.Type.Results.List {
+			if i == errResult {
+				continue
+			}
+			resultTypes = append(resultTypes, textOf(field.Type))
+			zeroResults = append(zeroResults, zeroValueOf(info.TypeOf(field.Type), qualifier))
+			if finalReturn != nil {
+				finalResults = append(finalResults, textOf(finalReturn.Results[i]))
+			}
+		}
+	}
+	for _, guard := range guards {
+		errExpr := textOf(guard.Results[len(guard.Results)-1])
+		if wrapErrors {
+			errExpr = "fmt.Errorf(" + strconv.Quote(funcName+": %w") + ", " + errExpr + ")"
+		}
+		replace(guard, "return "+strings.Join(append(append([]string{}, zeroResults...), errExpr), ", "))
+	}
+	if errResult != -1 {
+		replace(finalReturn, "return "+strings.Join(append(finalResults, textOf(finalReturn.Results[errResult])), ", "))
+	} else if finalReturn != nil {
+		replace(finalReturn, textOf(finalReturn)+", nil")
+	} else {
+		closing := fileSet.Position(funcDecl.Body.Rbrace).Offset
+		edits = append(edits, textEdit{closing, closing, "return nil\n"})
+	}
+	if len(resultTypes) == 0 && errResult != -1 {
+		replace(funcDecl.Type.Results, "error")
+	} else if funcDecl.Type.Results == nil {
+		paramsEnd := fileSet.Position(funcDecl.Type.Params.End()).Offset
+		edits = append(edits, textEdit{paramsEnd, paramsEnd, " error"})
+	} else {
+		replace(funcDecl.Type.Results, "("+strings.Join(append(resultTypes, "error"), ", ")+")")
+	}
+
+	var zeroEnclosingResults []string
+	for i := 0; i < enclosingResults.Len()-1; i++ {
+		zeroEnclosingResults = append(zeroEnclosingResults, zeroValueOf(enclosingResults.At(i).Type(), qualifier))
+	}
+	errName := "err"
+	switch typedStmt := callStmt.(type) {
+	case *ast.ExprStmt:
+		replace(callStmt, "if err := "+textOf(call)+"; err != nil {\n"+returnErrFrom(zeroEnclosingResults, errName)+"\n}")
+	case *ast.AssignStmt:
+		var lhs []string
+		for i, expr := range typedStmt.Lhs {
+			if i == errResult {
+				errName = textOf(expr)
+				continue
+			}
+			lhs = append(lhs, textOf(expr))
+		}
+		assignment := strings.Join(append(lhs, errName), ", ") + " " + typedStmt.Tok.String() + " " + textOf(call)
+		if _, isVar := lookupAt(pkg, errName, call.Pos()).(*types.Var); typedStmt.Tok == token.ASSIGN && !isVar {
+			assignment = "var " + errName + " error\n" + assignment
+		}
+		replace(callStmt, assignment+"\nif "+errName+" != nil {\n"+returnErrFrom(zeroEnclosingResults, errName)+"\n}")
+	}
+
+	modified := applyTextEdits(src, edits)
+	if wrapErrors {
+		modified = withImport(modified, "fmt")
+	}
+	formatted, err := format.Source([]byte(modified))
+	util.PanicOnError(err)
+	return string(formatted)
+}
+
+func returnErrFrom(zeroResults []string, errName string) string {
+	return "return " + strings.Join(append(append([]string{}, zeroResults...), errName), ", ")
+}
+
+// errorResultIndex returns the index of the result of funcDecl that the
+// final return sets to the error variable returned by all guards, or -1.
+func errorResultIndex(funcDecl *ast.FuncDecl, finalReturn *ast.ReturnStmt, guards []*ast.ReturnStmt, info *types.Info) int {
+	if finalReturn == nil || len(funcDecl.Type.Results.List) != len(finalReturn.Results) {
+		return -1
+	}
+	var errVar types.Object
+	for _, guard := range guards {
+		ident, isIdent := guard.Results[len(guard.Results)-1].(*ast.Ident)
+		if !isIdent || errVar != nil && info.Uses[ident] != errVar {
+			return -1
+		}
+		errVar = info.Uses[ident]
+	}
+	for i, result := range finalReturn.Results {
+		if ident, isIdent := result.(*ast.Ident); isIdent && errVar != nil && info.Uses[ident] == errVar &&
+			types.Identical(errVar.Type(), types.Universe.Lookup("error").Type()) {
+			return i
+		}
+	}
+	return -1
+}
+
+// callStmtAndEnclosingResultsOf returns the statement of the call at the end
+// of path and the results of the function containing it.
+func callStmtAndEnclosingResultsOf(path []ast.Node, info *types.Info) (callStmt ast.Stmt, results *types.Tuple) {
+	if len(path) > 1 {
+		switch typedStmt := path[1].(type) {
+		case *ast.ExprStmt:
+			callStmt = typedStmt
+		case *ast.AssignStmt:
+			if len(typedStmt.Rhs) == 1 && typedStmt.Rhs[0] == path[0] {
+				callStmt = typedStmt
+			}
+		}
+	}
+	for _, node := range path {
+		var signature types.Type
+		switch typedNode := node.(type) {
+		case *ast.FuncDecl:
+			if object := info.Defs[typedNode.Name]; object != nil {
+				signature = object.Type()
+			}
+		case *ast.FuncLit:
+			signature = info.TypeOf(typedNode)
+		default:
+			continue
+		}
+		if signature, isSignature := signature.(*types.Signature); isSignature {
+			return callStmt, signature.Results()
+		}
+		return callStmt, nil
+	}
+	return callStmt, nil
+}
+
+// guardsIn returns the returns of funcDecl, which must all be in error guards
+// returning numResults values, all but the error being zero values. The
+// final return added by the extraction is returned separately.
+func guardsIn(funcDecl *ast.FuncDecl, numResults int) (guards []*ast.ReturnStmt, finalReturn *ast.ReturnStmt, ok bool) {
+	body := funcDecl.Body.List
+	if funcDecl.Type.Results != nil && len(body) != 0 {
+		finalReturn, _ = body[len(body)-1].(*ast.ReturnStmt)
+	}
+	isGuard := make(map[*ast.ReturnStmt]bool)
+	ok = true
+	ast.Inspect(funcDecl.Body, func(node ast.Node) bool {
+		switch typedNode := node.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.IfStmt:
+			if returnStmt := errorGuardReturnOf(typedNode); returnStmt != nil && len(returnStmt.Results) == numResults {
+				isGuard[returnStmt] = true
+			}
+		case *ast.ReturnStmt:
+			if typedNode == finalReturn {
+				break
+			}
+			if !isGuard[typedNode] {
+				ok = false
+			}
+			guards = append(guards, typedNode)
+		}
+		return ok
+	})
+	return
+}
+
+// errorGuardReturnOf returns the return of an if statement like
+// "if err != nil { return 0, err }" that returns only zero values besides
+// the error.
+func errorGuardReturnOf(ifStmt *ast.IfStmt) *ast.ReturnStmt {
+	cond, isBinary := ifStmt.Cond.(*ast.BinaryExpr)
+	if !isBinary || cond.Op != token.NEQ || !isNil(cond.Y) || ifStmt.Else != nil || len(ifStmt.Body.List) != 1 {
+		return nil
+	}
+	returnStmt, isReturn := ifStmt.Body.List[0].(*ast.ReturnStmt)
+	if !isReturn || len(returnStmt.Results) == 0 {
+		return nil
+	}
+	for _, result := range returnStmt.Results[:len(returnStmt.Results)-1] {
+		if !isZeroValue(result) {
+			return nil
+		}
+	}
+	return returnStmt
+}
+
+func isNil(expr ast.Expr) bool {
+	ident, isIdent := expr.(*ast.Ident)
+	return isIdent && ident.Name == "nil"
+}
+
+func isZeroValue(expr ast.Expr) bool {
+	switch typedExpr := expr.(type) {
+	case *ast.Ident:
+		return typedExpr.Name == "nil" || typedExpr.Name == "false"
+	case *ast.BasicLit:
+		switch typedExpr.Value {
+		case "0", "0.0", `""`, "``":
+			return true
+		}
+	case *ast.CompositeLit:
+		return len(typedExpr.Elts) == 0
+	}
+	return false
+}
+
+func zeroValueOf(typ types.Type, qualifier types.Qualifier) string {
+	switch underlying := typ.Underlying().(type) {
+	case *types.Basic:
+		switch {
+		case underlying.Info()&types.IsBoolean != 0:
+			return "false"
+		case underlying.Info()&types.IsString != 0:
+			return `""`
+		case underlying.Info()&types.IsNumeric != 0:
+			return "0"
+		}
+		return "nil"
+	case *types.Struct, *types.Array:
+		return types.TypeString(typ, qualifier) + "{}"
+	}
+	return "nil"
+}
+
+// lookupAt returns the object name refers to at pos.
+func lookupAt(pkg *types.Package, name string, pos token.Pos) types.Object {
+	scope := pkg.Scope().Innermost(pos)
+	if scope == nil {
+		return nil
+	}
+	_, object := scope.LookupParent(name, pos)
+	return object
+}
+
+type textEdit struct {
+	begin, end int
+	text       string
+}
+
+func applyTextEdits(src string, edits []textEdit) string {
+	sort.SliceStable(edits, func(i, j int) bool { return edits[i].begin > edits[j].begin })
+	for _, edit := range edits {
+		src = src[:edit.begin] + edit.text + src[edit.end:]
+	}
+	return src
+}
+
+func withImport(src string, path string) string {
+	fileSet := token.NewFileSet()
+	astFile, err := parser.ParseFile(fileSet, "", src, parser.ParseComments)
+	util.PanicOnError(err)
+	if !astutil.AddImport(fileSet, astFile, path) {
+		return src
+	}
+	return nodeSource(fileSet, astFile)
+}
@@ -0,0 +1,127 @@
+package goextract_test
+
+import (
+	. "github.com/petergtz/goextract"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Extracting error guards", func() {
+	src := `package p
+
+func atoi(s string) (int, error) { return 0, nil }
+
+func parse(a string, b string) (int, error) {
+	x, err := atoi(a)
+	if err != nil {
+		return 0, err
+	}
+	y, err := atoi(b)
+	if err != nil {
+		return 0, err
+	}
+	sum := x + y
+	return sum * 2, nil
+}
+
+func check(a string) error {
+	_, err := atoi(a)
+	if err != nil {
+		return err
+	}
+	println(a)
+	return nil
+}
+`
+
+	It("returns the error together with the results and checks it at the call site", func() {
+		output, _, err := ExtractStringToString(src, Selection{Position{6, 2}, Position{14, 14}}, "g", Options{})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(output).To(ContainSubstring(`func parse(a string, b string) (int, error) {
+	sum, err := g(a, b)
+	if err != nil {
+		return 0, err
+	}
+	return sum * 2, nil
+}`))
+		Expect(output).To(ContainSubstring(`func g(a, b string) (int, error) {
+	x, err := atoi(a)
+	if err != nil {
+		return 0, err
+	}
+	y, err := atoi(b)
+	if err != nil {
+		return 0, err
+	}
+	sum := x + y
+	return sum, nil
+}`))
+	})
+
+	It("checks an only returned error in the if statement of the call", func() {
+		output, _, err := ExtractStringToString(src, Selection{Position{19, 2}, Position{23, 12}}, "g", Options{})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(output).To(ContainSubstring(`func check(a string) error {
+	if err := g(a); err != nil {
+		return err
+	}
+	return nil
+}
+
+func g(a string) error {
+	_, err := atoi(a)
+	if err != nil {
+		return err
+	}
+	println(a)
+	return nil
+}`))
+	})
+
+	It("wraps the errors with the function name", func() {
+		output, _, err := ExtractStringToString(src, Selection{Position{19, 2}, Position{23, 12}}, "g", Options{WrapErrors: true})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(output).To(ContainSubstring("import \"fmt\"\n"))
+		Expect(output).To(ContainSubstring(`		return fmt.Errorf("g: %w", err)`))
+	})
+
+	It("makes an error used after the extracted statements the error result", func() {
+		output, _, err := ExtractStringToString(`package p
+
+func atoi(s string) (int, error) { return 0, nil }
+
+func parse(a string, b string) (int, error) {
+	x, err := atoi(a)
+	if err != nil {
+		return 0, err
+	}
+	var y int
+	y, err = atoi(b)
+	if err != nil {
+		return 0, err
+	}
+	return x + y, nil
+}
+`, Selection{Position{6, 2}, Position{9, 3}}, "g", Options{})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(output).To(ContainSubstring(`func parse(a string, b string) (int, error) {
+	x, err := g(a)
+	if err != nil {
+		return 0, err
+	}
+	var y int
+`))
+		Expect(output).To(ContainSubstring(`func g(a string) (int, error) {
+	x, err := atoi(a)
+	if err != nil {
+		return 0, err
+	}
+	return x, err
+}`))
+	})
+})
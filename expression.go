@@ -1,4 +1,4 @@
-package main
+package goextract
 
 import (
 	"fmt"
@@ -53,6 +53,7 @@ func matchExpression(fileSet *token.FileSet, astFile *ast.File, selection Select
 func extractExpressionAsFunc(
 	astFile *ast.File,
 	fileSet *token.FileSet,
+	lineLengths []int,
 	expr ast.Expr,
 	parent ast.Node,
 	extractedFuncName string) {
@@ -142,10 +143,10 @@ func extractExpressionAsFunc(
 		panic(fmt.Sprintf("Type %v not supported yet", reflect.TypeOf(parent)))
 	}
 
-	areaRemoved := areaRemoved(fileSet, expr.Pos(), expr.End())
-	lineLengths := lineLengthsFrom(fileSet)
+	areaRemoved := areaRemoved(fileSet, lineLengths, expr.Pos(), expr.End())
 	lineNum, numLinesToCut, newLineLength := replacementModifications(fileSet, expr.Pos(), expr.End(), newExpr.End(), lineLengths, areaRemoved)
 
+	lastDeclEnd := astFile.End()
 	shiftPosesAfterPos(astFile, newExpr, expr.End(), newExpr.End()-expr.End())
 
 	singleExprStmtFuncDeclWith := CopyNode(singleExprStmtFuncDeclWith(extractedFuncName, fieldsFrom(params), expr)).(*ast.FuncDecl)
@@ -169,7 +170,7 @@ func extractExpressionAsFunc(
 	}
 	*fileSet = *newFileSet
 
-	moveComments(astFile, moveOffset /*, needs a range to restict which comments to move*/)
+	moveComments(astFile, expr.Pos(), expr.End(), lastDeclEnd, moveOffset, newExpr.End()-expr.End())
 }
 
 func singleExprStmtFuncDeclWith(funcName string, fields []*ast.Field, returnExpr ast.Expr) *ast.FuncDecl {
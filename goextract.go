@@ -12,11 +12,13 @@
 // See the License for the specific language governing permissions and
 // limitations under the License.
 
-package main
+package goextract
 
 import (
+	"errors"
 	"fmt"
 	"go/ast"
+	"go/format"
 	"go/token"
 	"os"
 	"os/exec"
@@ -24,41 +26,200 @@ import (
 	"github.com/petergtz/goextract/util"
 )
 
-func ExtractFileToFile(inputFileName string, selection Selection, extractedFuncName string, outputFilename string, debugOutput bool) {
-	fileSet, astFile := astFromFile(inputFileName)
-	if debugOutput {
-		createAstFileDump(inputFileName+".ast", fileSet, astFile)
+// Options controls the optional behavior of an extraction.
+type Options struct {
+	// WarnOnly holds the names of validation rules whose violations are
+	// reported as warnings instead of refusing the extraction.
+	WarnOnly map[string]bool
+	// Force produces a result even if it does not type-check. The type
+	// errors are reported as warnings then.
+	Force bool
+	// Overlay replaces the contents of files on disk, including the input file.
+	Overlay Overlay
+	// Placement determines where the extracted function is declared.
+	Placement Placement
+	// PlacementFile is the file that receives the function with PlaceInFile.
+	PlacementFile string
+	// UniqueName appends a number to the function name if the name collides
+	// with another declaration instead of refusing the extraction.
+	UniqueName bool
+	// ExportSuggestedName makes the name suggested for an empty function
+	// name exported instead of unexported.
+	ExportSuggestedName bool
+	// ParamOrder determines the order of the parameters of the function.
+	ParamOrder ParamOrder
+	// NamedResults names the results of the function like the variables it
+	// returns.
+	NamedResults bool
+	// DocTemplate is a text/template for the doc comment of the function,
+	// e.g. DefaultDocTemplate. No doc comment is generated if it is empty.
+	DocTemplate string
+	// Duplicates determines where to look for duplicates of the extracted code.
+	Duplicates DuplicateScope
+	// ReplaceDuplicates replaces the duplicates found by calls of the function.
+	ReplaceDuplicates bool
+	// ParamObjectThreshold bundles the parameters of the function into a
+	// struct if it has more of them. Zero means never.
+	ParamObjectThreshold int
+	// WrapErrors wraps the errors returned by the error guards of the
+	// function with fmt.Errorf and the function name.
+	WrapErrors bool
+
+	// importer type-checks the dependencies for all extractions that use
+	// these options. It must read through Overlay.
+	importer *sourceImporter
+}
+
+func ExtractFileToFile(inputFileName string, selection Selection, extractedFuncName string, options Options, outputFilename string, debugOutput bool) ([]Problem, error) {
+	output, warnings, err := ExtractFileToString(inputFileName, selection, extractedFuncName, options, debugOutput)
+	if err != nil {
+		return warnings, err
 	}
-	doExtraction(fileSet, astFile, selection, extractedFuncName)
-	util.WriteFileAsStringOrPanic(outputFilename, stringFrom(fileSet, astFile))
-	err := exec.Command("gofmt", "-w", outputFilename).Run()
+	util.WriteFileAsStringOrPanic(outputFilename, output)
+	err = exec.Command("gofmt", "-w", outputFilename).Run()
 	if err != nil {
 		fmt.Fprintln(os.Stderr, util.ReadFileAsStringOrPanic(outputFilename))
 		panic(err)
 	}
+	return warnings, nil
+}
+
+// FileChange is the content of a file before and after an extraction.
+type FileChange struct {
+	Filename string
+	Original string
+	Modified string
+}
+
+// Result describes the outcome of an extraction.
+type Result struct {
+	Changes  []FileChange
+	Warnings []Problem
+	Function FunctionInfo
+	// Duplicates are the duplicates of the extracted code found with
+	// Options.Duplicates. They are replaced with Options.ReplaceDuplicates.
+	Duplicates []Duplicate
+}
+
+// ExtractFile returns the gofmt-ed content of all files affected by the extraction.
+func ExtractFile(inputFileName string, selection Selection, extractedFuncName string, options Options) (*Result, error) {
+	return ExtractSource(inputFileName, options.Overlay.ReadFile(inputFileName), selection, extractedFuncName, options)
+}
+
+// ExtractSource is like ExtractFile, but uses src as content of the input file
+// instead of reading it, e.g. for unsaved editor buffers.
+func ExtractSource(inputFileName string, src string, selection Selection, extractedFuncName string, options Options) (*Result, error) {
+	fileSet, astFile, err := astFromSource(inputFileName, src)
+	if err != nil {
+		return &Result{}, err
+	}
+	return extractAndCheck(inputFileName, src, fileSet, astFile, selection, extractedFuncName, options)
 }
 
-func ExtractFileToString(inputFileName string, selection Selection, extractedFuncName string, debugOutput bool) string {
-	fileSet, astFile := astFromFile(inputFileName)
+func ExtractFileToString(inputFileName string, selection Selection, extractedFuncName string, options Options, debugOutput bool) (string, []Problem, error) {
+	input := options.Overlay.ReadFile(inputFileName)
+	fileSet, astFile, err := astFromSource(inputFileName, input)
+	if err != nil {
+		return "", nil, err
+	}
 	if debugOutput {
 		createAstFileDump(inputFileName+".ast", fileSet, astFile)
 	}
-	doExtraction(fileSet, astFile, selection, extractedFuncName)
-	return stringFrom(fileSet, astFile)
+	if options.Placement == PlaceInFile {
+		return "", nil, errors.New("Placing the function in another file changes several files, use ExtractFile")
+	}
+	result, err := extractAndCheck(inputFileName, input, fileSet, astFile, selection, extractedFuncName, options)
+	if err != nil {
+		return "", result.Warnings, err
+	}
+	return result.Changes[0].Modified, result.Warnings, nil
 }
 
-func ExtractStringToString(input string, selection Selection, extractedFuncName string) string {
-	fileSet, astFile := astFromInput(input)
-	doExtraction(fileSet, astFile, selection, extractedFuncName)
-	return stringFrom(fileSet, astFile)
+// ExtractStringToString returns the gofmt-ed result of extracting from input.
+// It never touches the disk, so the type check only covers input itself.
+func ExtractStringToString(input string, selection Selection, extractedFuncName string, options Options) (string, []Problem, error) {
+	result, err := ExtractSource("", input, selection, extractedFuncName, options)
+	if err != nil {
+		return "", result.Warnings, err
+	}
+	return result.Changes[0].Modified, result.Warnings, nil
 }
 
-func doExtraction(fileSet *token.FileSet, astFile *ast.File, selection Selection, extractedFuncName string) {
-	expression, parentNode := matchExpression(fileSet, astFile, selection)
-	if expression != nil {
-		extractExpressionAsFunc(astFile, fileSet, expression, parentNode, extractedFuncName)
+// extractAndCheck returns the gofmt-ed contents of all files changed by the
+// extraction, starting with filename. The result also holds the warnings if
+// the extraction fails.
+func extractAndCheck(filename string, input string, fileSet *token.FileSet, astFile *ast.File, selection Selection, extractedFuncName string, options Options) (*Result, error) {
+	checker := newPackageChecker(filename, options)
+	extractedFuncName, err := uniqueFunctionName(checker, input, selection, extractedFuncName, options)
+	if err != nil {
+		return &Result{}, err
+	}
+	enclosingDecl := enclosingDeclIndex(fileSet, astFile, selection)
+	warnings, err := doExtraction(fileSet, astFile, input, selection, extractedFuncName, options)
+	if err != nil {
+		return &Result{Warnings: warnings}, err
+	}
+	formatted, err := format.Source([]byte(stringFrom(fileSet, astFile)))
+	if err != nil {
+		return &Result{Warnings: warnings}, err
+	}
+	arranged, paramWarnings := arrangeParams(filename, string(formatted), extractedFuncName, options.ParamOrder)
+	warnings = append(warnings, paramWarnings...)
+	arranged = returnErrors(checker, arranged, extractedFuncName, options.WrapErrors)
+	arranged, duplicates, otherChanges, err := handleDuplicates(checker, input, arranged, selection, extractedFuncName, options)
+	if err != nil {
+		return &Result{Warnings: warnings}, err
+	}
+	if options.NamedResults {
+		arranged = nameResults(checker, arranged, extractedFuncName)
+	}
+	if options.DocTemplate != "" {
+		arranged, err = addDocComment(arranged, extractedFuncName, options.DocTemplate)
+		if err != nil {
+			return &Result{Warnings: warnings}, err
+		}
+	}
+	changes, placedFuncName, err := place(filename, input, arranged, selection, enclosingDecl, extractedFuncName, options)
+	if err != nil {
+		return &Result{Warnings: warnings}, err
+	}
+	if options.ParamObjectThreshold > 0 && numParamsOf(changes[len(changes)-1].Modified, placedFuncName) > options.ParamObjectThreshold {
+		if len(changes) != 1 {
+			return &Result{Warnings: warnings}, errors.New("Parameter objects are not supported when placing the function in another file")
+		}
+		paramObjectChanges, err := introduceParamObject(filename, changes[0].Modified, placedFuncName, "", options.Overlay)
+		if err != nil {
+			return &Result{Warnings: warnings}, err
+		}
+		changes[0].Modified = paramObjectChanges[0].Modified
+	}
+	funcChange := changes[len(changes)-1]
+	changes = append(changes, otherChanges...)
+	typeErrors := checkTypes(checker, input, changes[0].Modified, selection, changes[1:])
+	if len(typeErrors) != 0 && !options.Force {
+		return &Result{Warnings: warnings}, &TypeCheckError{Problems: typeErrors}
+	}
+	return &Result{
+		Changes:    changes,
+		Warnings:   append(warnings, typeErrors...),
+		Function:   functionInfoFrom(funcChange.Filename, funcChange.Modified, placedFuncName),
+		Duplicates: duplicates,
+	}, nil
+}
+
+func doExtraction(fileSet *token.FileSet, astFile *ast.File, input string, selection Selection, extractedFuncName string, options Options) ([]Problem, error) {
+	context, err := matchSelection(fileSet, astFile, selection)
+	if err != nil {
+		return nil, err
+	}
+	warnings, err := validate(context, options.WarnOnly)
+	if err != nil {
+		return warnings, err
+	}
+	if context.expression != nil {
+		extractExpressionAsFunc(astFile, fileSet, lineLengthsFrom(input), context.expression, context.parent, extractedFuncName)
 	} else {
-		stmts, parentNode := matchMultipleStmts(fileSet, astFile, selection)
-		extractMultipleStatementsAsFunc(astFile, fileSet, stmts, parentNode, extractedFuncName)
+		extractMultipleStatementsAsFunc(astFile, fileSet, lineLengthsFrom(input), context.nodes, context.parent, extractedFuncName)
 	}
+	return warnings, nil
 }
@@ -1,6 +1,10 @@
-package main_test
+package goextract_test
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
 	. "github.com/onsi/ginkgo"
 	. "github.com/onsi/gomega"
 
@@ -11,3 +15,42 @@ func TestGoextract(t *testing.T) {
 	RegisterFailHandler(Fail)
 	RunSpecs(t, "Goextract Suite")
 }
+
+// tempPackage is a temporary directory holding the files of the packages a
+// spec refactors.
+type tempPackage struct {
+	dir string
+}
+
+// newTempPackage writes files, given by their slash-separated paths relative
+// to the directory, into a new temporary directory before each spec of the
+// enclosing container and removes it after each spec.
+func newTempPackage(prefix string, files map[string]string) *tempPackage {
+	pkg := &tempPackage{}
+	BeforeEach(func() {
+		var err error
+		pkg.dir, err = ioutil.TempDir("", prefix)
+		Expect(err).NotTo(HaveOccurred())
+		for filename, content := range files {
+			pkg.writeFile(filename, content)
+		}
+	})
+	AfterEach(func() {
+		os.RemoveAll(pkg.dir)
+	})
+	return pkg
+}
+
+// path returns the path of the file whose path relative to the directory
+// consists of elements.
+func (pkg *tempPackage) path(elements ...string) string {
+	return filepath.Join(append([]string{pkg.dir}, elements...)...)
+}
+
+// writeFile writes content into the file with the slash-separated path
+// filename relative to the directory, creating missing directories.
+func (pkg *tempPackage) writeFile(filename string, content string) {
+	path := pkg.path(filepath.FromSlash(filename))
+	Expect(os.MkdirAll(filepath.Dir(path), 0755)).To(Succeed())
+	Expect(ioutil.WriteFile(path, []byte(content), 0644)).To(Succeed())
+}
@@ -1,4 +1,4 @@
-package main_test
+package goextract_test
 
 import (
 	"io/ioutil"
@@ -49,27 +49,84 @@ var _ = Describe("Goextract", func() {
 		}
 
 		it("Can extract a "+strings.Replace(prefix, "_", " ", -1), func() {
-			selection, extractedFuncName := extractionDataFrom(filepath.Join("test_data", prefix) + ".go.extract")
+			selection, extractedFuncName, options := extractionDataFrom(filepath.Join("test_data", prefix) + ".go.extract")
 
 			tmpfile, err := ioutil.TempFile("", "goextract")
 			util.PanicOnError(err)
 			defer os.Remove(tmpfile.Name())
 
-			ExtractFileToFile(filepath.Join("test_data", filename), selection, extractedFuncName, tmpfile.Name(), true)
+			_, err = ExtractFileToFile(filepath.Join("test_data", filename), selection, extractedFuncName, options, tmpfile.Name(), true)
+			Expect(err).NotTo(HaveOccurred())
 
 			Expect(tmpfile.Name()).To(HaveSameContentAs(filepath.Join("test_data", prefix) + ".go.output"))
 		})
 	}
+
+	It("Extracts from a string as a filter", func() {
+		selection, extractedFuncName, options := extractionDataFrom("test_data/one_simple_statement.go.extract")
+
+		output, warnings, err := ExtractStringToString(util.ReadFileAsStringOrPanic("test_data/one_simple_statement.go.input"), selection, extractedFuncName, options)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(warnings).To(BeEmpty())
+		Expect(output).To(Equal(util.ReadFileAsStringOrPanic("test_data/one_simple_statement.go.output")))
+	})
+
+	It("Refuses results that do not type-check", func() {
+		selection, extractedFuncName, _ := extractionDataFrom("test_data/type_switch_statement.go.extract")
+
+		_, _, err := ExtractFileToString("test_data/type_switch_statement.go.input", selection, extractedFuncName, Options{}, false)
+
+		Expect(err).To(BeAssignableToTypeOf(&TypeCheckError{}))
+		problems := err.(*TypeCheckError).Problems
+		Expect(problems).To(HaveLen(1))
+		Expect(problems[0].Message).To(ContainSubstring("undefined: UnresolvedIdent_varIdentsUsedIn"))
+		Expect(problems[0].Position.Line).To(Equal(21))
+	})
+
+	It("Maps type errors back to the original source", func() {
+		_, _, err := ExtractStringToString("package p\n\nfunc twice(n int) int {\n\tn = n * 2\n\tprintln(n)\n\treturn n\n}\n",
+			Selection{Position{4, 2}, Position{6, 10}}, "MyExtractedFunc", Options{})
+
+		Expect(err).To(BeAssignableToTypeOf(&TypeCheckError{}))
+		problems := err.(*TypeCheckError).Problems
+		Expect(problems).To(HaveLen(2))
+		Expect(problems[0].Message).To(Equal("missing return (in generated code)"))
+		Expect(problems[0].Position.Line).To(Equal(4))
+		Expect(problems[0].Position.Column).To(Equal(2))
+		Expect(problems[1].Message).To(ContainSubstring("too many return values"))
+		Expect(problems[1].Position.Line).To(Equal(6))
+		Expect(problems[1].Position.Column).To(Equal(9))
+	})
 })
 
-func extractionDataFrom(filename string) (Selection, string) {
+// extractionDataFrom reads selection and function name from an extract file.
+// Any further fields are command line flags for the extraction.
+func extractionDataFrom(filename string) (Selection, string, Options) {
 	parts := strings.Split(strings.TrimRight(util.ReadFileAsStringOrPanic(filename), "\n"), " ")
-	Expect(parts).To(HaveLen(5))
+	Expect(len(parts)).To(BeNumerically(">=", 5))
 	return Selection{
 			Position{toInt(parts[0]), toInt(parts[1])},
 			Position{toInt(parts[2]), toInt(parts[3])},
 		},
-		parts[4]
+		parts[4],
+		optionsFrom(parts[5:])
+}
+
+func optionsFrom(flags []string) (options Options) {
+	for _, flag := range flags {
+		switch flag {
+		case "--force":
+			options.Force = true
+		case "--placement=after":
+			options.Placement = PlaceAfterEnclosingDecl
+		case "--placement=before":
+			options.Placement = PlaceBeforeEnclosingDecl
+		default:
+			Fail("Unknown flag in extract file: " + flag)
+		}
+	}
+	return
 }
 
 func toInt(s string) int {
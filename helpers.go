@@ -1,4 +1,4 @@
-package main
+package goextract
 
 import (
 	"fmt"
@@ -252,6 +252,15 @@ func deduceTypeExprForVarIdent(ident *ast.Ident) ast.Expr {
 	}
 	switch typedDecl := ident.Obj.Decl.(type) {
 	case *ast.AssignStmt:
+		// the variable of a type switch guard, see bindTypeSwitchVars
+		if clause, isClause := ident.Obj.Data.(*ast.CaseClause); isClause {
+			if len(clause.List) == 1 {
+				if typeIdent, isIdent := clause.List[0].(*ast.Ident); !isIdent || typeIdent.Name != "nil" {
+					return clause.List[0]
+				}
+			}
+			return deduceTypeExprsForExpr(typedDecl.Rhs[0])[0]
+		}
 		for i, lhs := range typedDecl.Lhs {
 			if lhs.(*ast.Ident).Obj == ident.Obj {
 				if len(typedDecl.Rhs) == 0 {
@@ -0,0 +1,136 @@
+package goextract
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// sourceImporter type-checks imported packages from source and reads all
+// files through an overlay. Unlike the "source" importer of go/importer, it
+// also finds packages in module mode while an overlay is in use, because it
+// only lets go/build locate the package directories.
+type sourceImporter struct {
+	fileSet  *token.FileSet
+	overlay  Overlay
+	packages map[string]*types.Package
+}
+
+func newSourceImporter(fileSet *token.FileSet, overlay Overlay) *sourceImporter {
+	return &sourceImporter{fileSet: fileSet, overlay: overlay, packages: make(map[string]*types.Package)}
+}
+
+func (importer *sourceImporter) Import(path string) (*types.Package, error) {
+	return importer.ImportFrom(path, "", 0)
+}
+
+func (importer *sourceImporter) ImportFrom(path string, srcDir string, mode types.ImportMode) (*types.Package, error) {
+	if path == "unsafe" {
+		return types.Unsafe, nil
+	}
+	dir, err := dirOfImportPath(path, srcDir, importer.overlay)
+	if err != nil {
+		return nil, err
+	}
+	if pkg, found := importer.packages[dir]; found {
+		if pkg == nil {
+			return nil, fmt.Errorf("Import cycle through %v", path)
+		}
+		return pkg, nil
+	}
+	importer.packages[dir] = nil
+	buildPackage, err := importer.overlay.buildContext().ImportDir(dir, 0)
+	if err != nil {
+		delete(importer.packages, dir)
+		return nil, err
+	}
+	var files []*ast.File
+	for _, filename := range append(buildPackage.GoFiles, buildPackage.CgoFiles...) {
+		filename = filepath.Join(dir, filename)
+		file, err := parser.ParseFile(importer.fileSet, filename, importer.overlay.ReadFile(filename), 0)
+		if err != nil {
+			delete(importer.packages, dir)
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	// Errors in dependencies are not the extraction's business, so they are
+	// ignored as long as the package can be checked at all.
+	config := types.Config{Importer: importer, FakeImportC: true, Error: func(error) {}}
+	pkg, err := config.Check(path, importer.fileSet, files, nil)
+	if pkg == nil {
+		delete(importer.packages, dir)
+		return nil, err
+	}
+	importer.packages[dir] = pkg
+	return pkg, nil
+}
+
+// dirOfImportPath finds the directory of the package with the given import
+// path, as imported from srcDir, reading through overlay.
+func dirOfImportPath(path string, srcDir string, overlay Overlay) (string, error) {
+	if srcDir != "" {
+		if moduleRoot, modulePath, found := moduleOf(srcDir, overlay); found {
+			if path == modulePath {
+				return moduleRoot, nil
+			}
+			if strings.HasPrefix(path, modulePath+"/") {
+				return filepath.Join(moduleRoot, filepath.FromSlash(strings.TrimPrefix(path, modulePath+"/"))), nil
+			}
+		}
+	}
+	buildPackage, err := overlay.buildContext().Import(path, srcDir, build.FindOnly)
+	if err != nil {
+		return "", err
+	}
+	return buildPackage.Dir, nil
+}
+
+// importPathOf determines the import path of the package in dir, which does
+// not need to exist yet.
+func importPathOf(dir string, overlay Overlay) (string, error) {
+	dir = absPath(dir)
+	if moduleRoot, modulePath, found := moduleOf(dir, overlay); found {
+		if dir == moduleRoot {
+			return modulePath, nil
+		}
+		relativeDir, err := filepath.Rel(moduleRoot, dir)
+		if err != nil {
+			return "", err
+		}
+		return modulePath + "/" + filepath.ToSlash(relativeDir), nil
+	}
+	for _, gopath := range filepath.SplitList(build.Default.GOPATH) {
+		src := filepath.Join(absPath(gopath), "src") + string(filepath.Separator)
+		if strings.HasPrefix(dir, src) {
+			return filepath.ToSlash(strings.TrimPrefix(dir, src)), nil
+		}
+	}
+	return "", fmt.Errorf("Cannot determine the import path of %v: neither in a module nor in GOPATH", dir)
+}
+
+var moduleDirective = regexp.MustCompile(`(?m)^module\s+"?([^"\s]+)"?`)
+
+// moduleOf finds the go.mod governing dir and returns the directory containing
+// it and the module path it declares. go.mod is read through overlay.
+func moduleOf(dir string, overlay Overlay) (moduleRoot string, modulePath string, found bool) {
+	for dir = absPath(dir); ; dir = filepath.Dir(dir) {
+		goMod, err := overlay.readFile(filepath.Join(dir, "go.mod"))
+		if err == nil {
+			if match := moduleDirective.FindSubmatch(goMod); match != nil {
+				return dir, string(match[1]), true
+			}
+			return "", "", false
+		}
+		if !os.IsNotExist(err) || filepath.Dir(dir) == dir {
+			return "", "", false
+		}
+	}
+}
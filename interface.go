@@ -0,0 +1,252 @@
+package goextract
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/types"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// ExtractInterface declares an interface with the methods that the function
+// funcName, declared in filename, calls on its parameter paramName, and
+// changes the type of the parameter to it. The parameter must be of a named
+// concrete type or a pointer to one and must not be used other than by
+// calling its methods. The interface is declared before the function, or
+// after the type of the parameter if besideType is set, possibly in another
+// package. Methods are given as Type.Method. If interfaceName is empty, it is
+// the only method's name followed by er, or the type's name followed by
+// Interface. The first change is the one of filename.
+func ExtractInterface(filename string, funcName string, paramName string, interfaceName string, besideType bool, options Options) (*Result, error) {
+	refactoring, err := newPackageRefactoring(filename, options.Overlay, "interface")
+	if err != nil {
+		return &Result{}, err
+	}
+	funcDecl := funcOrMethodDeclNamed(refactoring.astFile, funcName)
+	if funcDecl == nil || funcDecl.Body == nil {
+		return &Result{}, fmt.Errorf("There is no function %v in %v", funcName, filename)
+	}
+	var paramField *ast.Field
+	var param types.Object
+	for _, field := range funcDecl.Type.Params.List {
+		for _, name := range field.Names {
+			if name.Name == paramName {
+				paramField, param = field, refactoring.info.Defs[name]
+			}
+		}
+	}
+	if param == nil {
+		return &Result{}, fmt.Errorf("%v has no parameter %v", funcName, paramName)
+	}
+	paramType := param.Type()
+	named, _ := paramType.(*types.Named)
+	if pointer, isPointer := paramType.(*types.Pointer); isPointer {
+		named, _ = pointer.Elem().(*types.Named)
+	}
+	if named == nil || types.IsInterface(named) {
+		return &Result{}, fmt.Errorf("The parameter %v must be of a named concrete type or a pointer to one", paramName)
+	}
+
+	methods := methodsCalledOn(refactoring, funcDecl.Body, param)
+	if len(refactoring.problems) != 0 {
+		return &Result{}, &ValidationError{Problems: refactoring.problems}
+	}
+	if len(methods) == 0 {
+		return &Result{}, fmt.Errorf("No methods are called on %v", paramName)
+	}
+	methodSet := types.NewMethodSet(paramType)
+	for _, method := range methods {
+		if methodSet.Lookup(method.Pkg(), method.Name()) == nil {
+			return &Result{}, fmt.Errorf("%v has a pointer receiver, so %v does not implement the interface", method.Name(), types.TypeString(paramType, types.RelativeTo(refactoring.pkg)))
+		}
+	}
+
+	targetPkg := refactoring.pkg
+	if besideType {
+		targetPkg = named.Obj().Pkg()
+	}
+	if interfaceName == "" {
+		interfaceName = defaultInterfaceName(named, methods)
+		if targetPkg != refactoring.pkg || funcDecl.Name.IsExported() {
+			interfaceName = exported(interfaceName)
+		} else {
+			interfaceName = unexported(interfaceName)
+		}
+		baseName := interfaceName
+		for i := 2; targetPkg.Scope().Lookup(interfaceName) != nil; i++ {
+			interfaceName = baseName + strconv.Itoa(i)
+		}
+	} else if targetPkg.Scope().Lookup(interfaceName) != nil {
+		return &Result{}, fmt.Errorf("%v is already declared in package %v", interfaceName, targetPkg.Name())
+	}
+
+	var declFilename string
+	var declOffset int
+	var declText string
+	if besideType {
+		typeDecl, typeFilename := typeDeclOf(refactoring, named.Obj())
+		if typeDecl == nil {
+			return &Result{}, fmt.Errorf("The declaration of %v cannot be found", named.Obj().Name())
+		}
+		declFilename, declOffset = typeFilename, refactoring.offsetOf(typeDecl.End())
+		declText = "\n\n" + interfaceDeclFor(refactoring, interfaceName, methods, targetPkg, declFilename)
+	} else {
+		declFilename, declOffset = filename, refactoring.offsetOf(declPos(funcDecl))
+		declText = interfaceDeclFor(refactoring, interfaceName, methods, targetPkg, declFilename) + "\n\n"
+	}
+	refactoring.edits[declFilename] = append(refactoring.edits[declFilename], lazyEdit{declOffset, declOffset, func() string { return declText }})
+
+	typeText := interfaceName
+	if targetPkg != refactoring.pkg {
+		typeExpr := paramField.Type
+		if star, isStar := typeExpr.(*ast.StarExpr); isStar {
+			typeExpr = star.X
+		}
+		selector, isSelector := typeExpr.(*ast.SelectorExpr)
+		if !isSelector {
+			return &Result{}, fmt.Errorf("The type of %v must be given as package.Type", paramName)
+		}
+		typeText = refactoring.originalText(selector.X) + "." + interfaceName
+	}
+	if len(paramField.Names) == 1 {
+		refactoring.edit(paramField.Type.Pos(), paramField.Type.End(), func() string { return typeText })
+	} else {
+		// The other parameters of the field keep their type.
+		var params []string
+		for _, name := range paramField.Names {
+			if name.Name == paramName {
+				params = append(params, name.Name+" "+typeText)
+			} else {
+				params = append(params, name.Name+" "+refactoring.originalText(paramField.Type))
+			}
+		}
+		refactoring.edit(paramField.Pos(), paramField.End(), func() string { return strings.Join(params, ", ") })
+	}
+	return refactoring.result(options)
+}
+
+// methodsCalledOn returns the methods called on param in body, sorted by
+// name, and reports all other uses of it.
+func methodsCalledOn(refactoring *packageRefactoring, body *ast.BlockStmt, param types.Object) []*types.Func {
+	byName := make(map[string]*types.Func)
+	receivers := make(map[*ast.Ident]bool)
+	ast.Inspect(body, func(node ast.Node) bool {
+		selector, isSelector := node.(*ast.SelectorExpr)
+		if !isSelector {
+			return true
+		}
+		ident, isIdent := astutil.Unparen(selector.X).(*ast.Ident)
+		selection := refactoring.info.Selections[selector]
+		if isIdent && refactoring.info.Uses[ident] == param && selection != nil && selection.Kind() == types.MethodVal {
+			receivers[ident] = true
+			byName[selection.Obj().Name()] = selection.Obj().(*types.Func)
+		}
+		return true
+	})
+	ast.Inspect(body, func(node ast.Node) bool {
+		if ident, isIdent := node.(*ast.Ident); isIdent && refactoring.info.Uses[ident] == param && !receivers[ident] {
+			refactoring.problem(ident.Pos(), "%v is used other than by calling its methods", ident.Name)
+		}
+		return true
+	})
+	var methods []*types.Func
+	for _, method := range byName {
+		methods = append(methods, method)
+	}
+	sort.Slice(methods, func(i, j int) bool { return methods[i].Name() < methods[j].Name() })
+	return methods
+}
+
+func defaultInterfaceName(named *types.Named, methods []*types.Func) string {
+	if len(methods) == 1 {
+		if agentNoun, isSimple := agentNounOf(methods[0].Name()); isSimple {
+			return agentNoun
+		}
+	}
+	return named.Obj().Name() + "Interface"
+}
+
+// agentNounOf returns name followed by er, like Reader for Read, Closer for
+// Close or Getter for Get. It tells whether that is a simple suffix, which
+// it is not for words ending in a consonant and y, or in a single vowel and
+// a consonant after more than one syllable, like Copy or Open.
+func agentNounOf(name string) (string, bool) {
+	lastWord := name
+	for i := len(name) - 1; i > 0; i-- {
+		if unicode.IsUpper(rune(name[i])) {
+			lastWord = name[i:]
+			break
+		}
+	}
+	word := strings.ToLower(lastWord)
+	isVowel := func(i int) bool { return i >= 0 && strings.ContainsRune("aeiou", rune(word[i])) }
+	last := len(word) - 1
+	switch {
+	case strings.HasSuffix(word, "e"):
+		return name + "r", true
+	case strings.HasSuffix(word, "y") && !isVowel(last-1):
+		return "", false
+	case isVowel(last) || strings.ContainsRune("wxy", rune(word[last])) || !isVowel(last-1) || isVowel(last-2):
+		return name + "er", true
+	}
+	for i := 0; i < last-1; i++ {
+		if isVowel(i) {
+			// more than one syllable, whether to double depends on the stress
+			return "", false
+		}
+	}
+	return name + name[len(name)-1:] + "er", true
+}
+
+// interfaceDeclFor returns the declaration of the interface name with
+// methods in the package pkg, importing the packages of their signatures in
+// filename.
+func interfaceDeclFor(refactoring *packageRefactoring, name string, methods []*types.Func, pkg *types.Package, filename string) string {
+	qualifier := func(other *types.Package) string {
+		if other == pkg {
+			return ""
+		}
+		refactoring.addImport(filename, "", other.Path())
+		return other.Name()
+	}
+	var lines []string
+	for _, method := range methods {
+		lines = append(lines, method.Name()+strings.TrimPrefix(types.TypeString(method.Type(), qualifier), "func"))
+	}
+	return "type " + name + " interface {\n" + strings.Join(lines, "\n") + "\n}"
+}
+
+// typeDeclOf returns the declaration of typeName and the name of its file,
+// which is parsed if it is not in the package of the refactoring.
+func typeDeclOf(refactoring *packageRefactoring, typeName *types.TypeName) (*ast.GenDecl, string) {
+	filename := refactoring.filenameOf(typeName.Pos())
+	var file *ast.File
+	for _, packageFile := range refactoring.files {
+		if refactoring.filenameOf(packageFile.Pos()) == filename {
+			file = packageFile
+		}
+	}
+	if file == nil {
+		refactoring.sources[filename] = refactoring.overlay.ReadFile(filename)
+		var err error
+		file, err = parser.ParseFile(refactoring.fileSet, filename, refactoring.sources[filename], parser.ParseComments)
+		if err != nil {
+			return nil, ""
+		}
+	}
+	for _, decl := range file.Decls {
+		if genDecl, isGenDecl := decl.(*ast.GenDecl); isGenDecl {
+			for _, spec := range genDecl.Specs {
+				if typeSpec, isTypeSpec := spec.(*ast.TypeSpec); isTypeSpec && typeSpec.Name.Name == typeName.Name() {
+					return genDecl, filename
+				}
+			}
+		}
+	}
+	return nil, ""
+}
@@ -0,0 +1,109 @@
+package goextract_test
+
+import (
+	. "github.com/petergtz/goextract"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ExtractInterface", func() {
+	pkg := newTempPackage("goextract-interface", map[string]string{
+		"a.go": `package p
+
+type store struct {
+	data map[string]string
+}
+
+func (s *store) Load(key string) (string, error) { return s.data[key], nil }
+
+func (s *store) Save(key string, value string) error {
+	s.data[key] = value
+	return nil
+}
+`,
+		"b.go": `package p
+
+func rename(s *store, from, to string) error {
+	value, err := s.Load(from)
+	if err != nil {
+		return err
+	}
+	return s.Save(to, value)
+}
+
+func size(s *store) int {
+	return len(s.data)
+}
+`,
+	})
+
+	It("declares an interface with the called methods before the function and uses it", func() {
+		result, err := ExtractInterface(pkg.path("b.go"), "rename", "s", "", false, Options{})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Changes).To(HaveLen(1))
+		Expect(result.Changes[0].Modified).To(Equal(`package p
+
+type storeInterface interface {
+	Load(key string) (string, error)
+	Save(key string, value string) error
+}
+
+func rename(s storeInterface, from, to string) error {
+	value, err := s.Load(from)
+	if err != nil {
+		return err
+	}
+	return s.Save(to, value)
+}
+
+func size(s *store) int {
+	return len(s.data)
+}
+`))
+	})
+
+	It("declares the interface after the type of the parameter", func() {
+		result, err := ExtractInterface(pkg.path("b.go"), "rename", "s", "loadSaver", true, Options{})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Changes).To(HaveLen(2))
+		Expect(result.Changes[0].Modified).To(ContainSubstring("func rename(s loadSaver, from, to string) error {"))
+		Expect(result.Changes[1].Filename).To(Equal(pkg.path("a.go")))
+		Expect(result.Changes[1].Modified).To(ContainSubstring(`type store struct {
+	data map[string]string
+}
+
+type loadSaver interface {
+	Load(key string) (string, error)
+	Save(key string, value string) error
+}
+`))
+	})
+
+	It("refuses parameters used other than by calling their methods", func() {
+		_, err := ExtractInterface(pkg.path("b.go"), "size", "s", "", false, Options{})
+
+		Expect(err).To(MatchError(ContainSubstring("s is used other than by calling its methods")))
+	})
+
+	It("doubles the final consonant of short method names in the interface name", func() {
+		pkg.writeFile("c.go", `package p
+
+type cache struct{}
+
+func (c cache) Get(key string) string { return key }
+
+func lookup(c cache) string {
+	return c.Get("key")
+}
+`)
+
+		result, err := ExtractInterface(pkg.path("c.go"), "lookup", "c", "", false, Options{})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Changes[0].Modified).To(ContainSubstring("type getter interface {"))
+		Expect(result.Changes[0].Modified).To(ContainSubstring("func lookup(c getter) string {"))
+	})
+})
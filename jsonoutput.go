@@ -0,0 +1,125 @@
+package goextract
+
+import (
+	"encoding/json"
+
+	"github.com/petergtz/goextract/util"
+)
+
+type jsonResult struct {
+	Files    []jsonFile    `json:"files"`
+	Function *FunctionInfo `json:"function,omitempty"`
+	Warnings []jsonProblem `json:"warnings"`
+	Error    string        `json:"error,omitempty"`
+	Problems []jsonProblem `json:"problems,omitempty"`
+	// Duplicates are only listed if requested.
+	Duplicates []jsonDuplicate `json:"duplicates,omitempty"`
+}
+
+type jsonDuplicate struct {
+	Filename string `json:"filename"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Call     string `json:"call"`
+}
+
+type jsonFile struct {
+	Filename string     `json:"filename"`
+	Edits    []TextEdit `json:"edits"`
+}
+
+type jsonProblem struct {
+	Filename string `json:"filename"`
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Rule     string `json:"rule"`
+	Message  string `json:"message"`
+}
+
+// JSONFrom converts the outcome of an extraction into the JSON format used by
+// editor integrations.
+func JSONFrom(result *Result, err error) []byte {
+	output := jsonResult{
+		Files:    []jsonFile{},
+		Warnings: jsonProblemsFrom(result.Warnings),
+	}
+	if err != nil {
+		output.Error = err.Error()
+		switch typedErr := err.(type) {
+		case *ValidationError:
+			output.Problems = jsonProblemsFrom(typedErr.Problems)
+		case *TypeCheckError:
+			output.Problems = jsonProblemsFrom(typedErr.Problems)
+		}
+	} else {
+		for _, change := range result.Changes {
+			output.Files = append(output.Files, jsonFile{
+				Filename: change.Filename,
+				Edits:    TextEditsFrom(change.Original, change.Modified),
+			})
+		}
+		if result.Function.Name != "" {
+			output.Function = &result.Function
+		}
+		for _, duplicate := range result.Duplicates {
+			output.Duplicates = append(output.Duplicates, jsonDuplicate{
+				Filename: duplicate.Position.Filename,
+				Line:     duplicate.Position.Line,
+				Column:   duplicate.Position.Column,
+				Call:     duplicate.Call,
+			})
+		}
+	}
+	content, marshalErr := json.MarshalIndent(output, "", "  ")
+	util.PanicOnError(marshalErr)
+	return content
+}
+
+func jsonProblemsFrom(problems []Problem) []jsonProblem {
+	result := []jsonProblem{}
+	for _, problem := range problems {
+		result = append(result, jsonProblem{
+			Filename: problem.Position.Filename,
+			Line:     problem.Position.Line,
+			Column:   problem.Position.Column,
+			Rule:     problem.Rule,
+			Message:  problem.Message,
+		})
+	}
+	return result
+}
+
+type jsonSuggestion struct {
+	Filename    string `json:"filename"`
+	Function    string `json:"function"`
+	BeginLine   int    `json:"beginLine"`
+	BeginColumn int    `json:"beginColumn"`
+	EndLine     int    `json:"endLine"`
+	EndColumn   int    `json:"endColumn"`
+	Name        string `json:"name"`
+	Signature   string `json:"signature"`
+	Complexity  int    `json:"complexity"`
+	Score       int    `json:"score"`
+}
+
+// JSONFromSuggestions converts the suggestions of goextract suggest into JSON.
+func JSONFromSuggestions(suggestions []Suggestion) []byte {
+	output := []jsonSuggestion{}
+	for _, suggestion := range suggestions {
+		output = append(output, jsonSuggestion{
+			Filename:    suggestion.Filename,
+			Function:    suggestion.Function,
+			BeginLine:   suggestion.Selection.Begin.Line,
+			BeginColumn: suggestion.Selection.Begin.Column,
+			EndLine:     suggestion.Selection.End.Line,
+			EndColumn:   suggestion.Selection.End.Column,
+			Name:        suggestion.Name,
+			Signature:   suggestion.Signature,
+			Complexity:  suggestion.Complexity,
+			Score:       suggestion.Score,
+		})
+	}
+	content, err := json.MarshalIndent(output, "", "  ")
+	util.PanicOnError(err)
+	return content
+}
@@ -0,0 +1,500 @@
+package goextract
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+const (
+	extractFunctionCommand = "goextract.extractFunction"
+	extractVariableCommand = "goextract.extractVariable"
+
+	extractFunctionKind = "refactor.extract.function"
+	extractVariableKind = "refactor.extract.variable"
+
+	defaultVariableName = "extractedVar"
+)
+
+type lspRequest struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id,omitempty"`
+	Method  string           `json:"method,omitempty"`
+	Params  json.RawMessage  `json:"params,omitempty"`
+}
+
+type lspResponse struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id"`
+	Result  interface{}      `json:"result"`
+}
+
+type lspErrorResponse struct {
+	JSONRPC string           `json:"jsonrpc"`
+	ID      *json.RawMessage `json:"id"`
+	Error   lspError         `json:"error"`
+}
+
+type lspError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+type lspOutgoingRequest struct {
+	JSONRPC string      `json:"jsonrpc"`
+	ID      int         `json:"id"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+const (
+	lspMethodNotFound = -32601
+	lspInternalError  = -32603
+)
+
+type lspPosition struct {
+	Line      int `json:"line"`
+	Character int `json:"character"`
+}
+
+type lspRange struct {
+	Start lspPosition `json:"start"`
+	End   lspPosition `json:"end"`
+}
+
+type lspTextEdit struct {
+	Range   lspRange `json:"range"`
+	NewText string   `json:"newText"`
+}
+
+type lspWorkspaceEdit struct {
+	Changes map[string][]lspTextEdit `json:"changes"`
+}
+
+type lspCommand struct {
+	Title     string        `json:"title"`
+	Command   string        `json:"command"`
+	Arguments []interface{} `json:"arguments"`
+}
+
+type lspCodeAction struct {
+	Title   string     `json:"title"`
+	Kind    string     `json:"kind"`
+	Command lspCommand `json:"command"`
+}
+
+type lspTextDocumentIdentifier struct {
+	URI string `json:"uri"`
+}
+
+type lspExtractionArguments struct {
+	URI   string   `json:"uri"`
+	Range lspRange `json:"range"`
+}
+
+type lspServer struct {
+	in        *bufio.Reader
+	out       io.Writer
+	outMutex  sync.Mutex
+	documents map[string]string
+	nextID    int
+}
+
+// ServeLSP runs a Language Server Protocol server that reads requests from in
+// and writes responses to out, until the client sends the exit notification.
+func ServeLSP(in io.Reader, out io.Writer) error {
+	server := &lspServer{in: bufio.NewReader(in), out: out, documents: make(map[string]string)}
+	for {
+		request, err := server.readMessage()
+		if err != nil {
+			return err
+		}
+		if request.Method == "" {
+			// a response to one of our own requests, e.g. workspace/applyEdit
+			continue
+		}
+		if request.Method == "exit" {
+			return nil
+		}
+		result, err := server.handle(request)
+		if request.ID == nil {
+			continue
+		}
+		if err != nil {
+			code := lspInternalError
+			if err == errMethodNotFound {
+				code = lspMethodNotFound
+			}
+			server.writeMessage(lspErrorResponse{JSONRPC: "2.0", ID: request.ID, Error: lspError{code, err.Error()}})
+		} else {
+			server.writeMessage(lspResponse{JSONRPC: "2.0", ID: request.ID, Result: result})
+		}
+	}
+}
+
+var errMethodNotFound = errors.New("Method not found")
+
+func (server *lspServer) readMessage() (*lspRequest, error) {
+	contentLength := -1
+	for {
+		line, err := server.in.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			break
+		}
+		if strings.HasPrefix(strings.ToLower(line), "content-length:") {
+			contentLength, err = strconv.Atoi(strings.TrimSpace(line[len("content-length:"):]))
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if contentLength < 0 {
+		return nil, errors.New("Missing Content-Length header")
+	}
+	content := make([]byte, contentLength)
+	if _, err := io.ReadFull(server.in, content); err != nil {
+		return nil, err
+	}
+	request := &lspRequest{}
+	return request, json.Unmarshal(content, request)
+}
+
+func (server *lspServer) writeMessage(message interface{}) {
+	content, err := json.Marshal(message)
+	if err != nil {
+		panic(err)
+	}
+	server.outMutex.Lock()
+	defer server.outMutex.Unlock()
+	fmt.Fprintf(server.out, "Content-Length: %v\r\n\r\n%s", len(content), content)
+}
+
+func (server *lspServer) sendRequest(method string, params interface{}) {
+	server.nextID++
+	server.writeMessage(lspOutgoingRequest{JSONRPC: "2.0", ID: server.nextID, Method: method, Params: params})
+}
+
+func (server *lspServer) handle(request *lspRequest) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+	switch request.Method {
+	case "initialize":
+		return server.initialize()
+	case "initialized", "$/cancelRequest", "workspace/didChangeConfiguration":
+		return nil, nil
+	case "shutdown":
+		return nil, nil
+	case "textDocument/didOpen":
+		return nil, server.didOpen(request.Params)
+	case "textDocument/didChange":
+		return nil, server.didChange(request.Params)
+	case "textDocument/didClose":
+		return nil, server.didClose(request.Params)
+	case "textDocument/codeAction":
+		return server.codeAction(request.Params)
+	case "workspace/executeCommand":
+		return nil, server.executeCommand(request.Params)
+	default:
+		return nil, errMethodNotFound
+	}
+}
+
+func (server *lspServer) initialize() (interface{}, error) {
+	return map[string]interface{}{
+		"capabilities": map[string]interface{}{
+			"textDocumentSync": map[string]interface{}{
+				"openClose": true,
+				"change":    2, // incremental
+			},
+			"codeActionProvider": map[string]interface{}{
+				"codeActionKinds": []string{extractFunctionKind, extractVariableKind},
+			},
+			"executeCommandProvider": map[string]interface{}{
+				"commands": []string{extractFunctionCommand, extractVariableCommand},
+			},
+		},
+		"serverInfo": map[string]interface{}{"name": "goextract"},
+	}, nil
+}
+
+func (server *lspServer) didOpen(rawParams json.RawMessage) error {
+	var params struct {
+		TextDocument struct {
+			URI  string `json:"uri"`
+			Text string `json:"text"`
+		} `json:"textDocument"`
+	}
+	if err := json.Unmarshal(rawParams, &params); err != nil {
+		return err
+	}
+	server.documents[params.TextDocument.URI] = params.TextDocument.Text
+	return nil
+}
+
+func (server *lspServer) didChange(rawParams json.RawMessage) error {
+	var params struct {
+		TextDocument   lspTextDocumentIdentifier `json:"textDocument"`
+		ContentChanges []struct {
+			Range *lspRange `json:"range"`
+			Text  string    `json:"text"`
+		} `json:"contentChanges"`
+	}
+	if err := json.Unmarshal(rawParams, &params); err != nil {
+		return err
+	}
+	text := server.documents[params.TextDocument.URI]
+	for _, change := range params.ContentChanges {
+		if change.Range == nil {
+			text = change.Text
+		} else {
+			text = text[:byteOffsetOf(text, change.Range.Start)] + change.Text + text[byteOffsetOf(text, change.Range.End):]
+		}
+	}
+	server.documents[params.TextDocument.URI] = text
+	return nil
+}
+
+func (server *lspServer) didClose(rawParams json.RawMessage) error {
+	var params struct {
+		TextDocument lspTextDocumentIdentifier `json:"textDocument"`
+	}
+	if err := json.Unmarshal(rawParams, &params); err != nil {
+		return err
+	}
+	delete(server.documents, params.TextDocument.URI)
+	return nil
+}
+
+func (server *lspServer) codeAction(rawParams json.RawMessage) ([]lspCodeAction, error) {
+	var params struct {
+		TextDocument lspTextDocumentIdentifier `json:"textDocument"`
+		Range        lspRange                  `json:"range"`
+		Context      struct {
+			Only []string `json:"only"`
+		} `json:"context"`
+	}
+	if err := json.Unmarshal(rawParams, &params); err != nil {
+		return nil, err
+	}
+	actions := []lspCodeAction{}
+	text, isOpen := server.documents[params.TextDocument.URI]
+	if !isOpen || params.Range.Start == params.Range.End {
+		return actions, nil
+	}
+	selection := selectionFromLSPRange(text, params.Range)
+	arguments := []interface{}{lspExtractionArguments{URI: params.TextDocument.URI, Range: params.Range}}
+	if kindRequested(extractFunctionKind, params.Context.Only) && canExtractFunction(text, selection) {
+		actions = append(actions, lspCodeAction{
+			Title:   "Extract function",
+			Kind:    extractFunctionKind,
+			Command: lspCommand{Title: "Extract function", Command: extractFunctionCommand, Arguments: arguments},
+		})
+	}
+	if kindRequested(extractVariableKind, params.Context.Only) && canExtractVariable(text, selection) {
+		actions = append(actions, lspCodeAction{
+			Title:   "Extract variable",
+			Kind:    extractVariableKind,
+			Command: lspCommand{Title: "Extract variable", Command: extractVariableCommand, Arguments: arguments},
+		})
+	}
+	return actions, nil
+}
+
+func kindRequested(kind string, only []string) bool {
+	if len(only) == 0 {
+		return true
+	}
+	for _, requestedKind := range only {
+		if kind == requestedKind || strings.HasPrefix(kind, requestedKind+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// canExtractFunction is a cheap check for the code action. The actual
+// extraction can still fail, e.g. because the result does not type-check.
+func canExtractFunction(text string, selection Selection) bool {
+	fileSet, astFile, err := astFromInput(text)
+	if err != nil {
+		return false
+	}
+	context, err := matchSelection(fileSet, astFile, selection)
+	if err != nil {
+		return false
+	}
+	_, err = validate(context, nil)
+	return err == nil
+}
+
+func canExtractVariable(text string, selection Selection) bool {
+	fileSet, astFile, err := astFromInput(text)
+	if err != nil {
+		return false
+	}
+	_, _, err = matchVariableExtraction(fileSet, astFile, selection)
+	return err == nil
+}
+
+func (server *lspServer) executeCommand(rawParams json.RawMessage) error {
+	var params struct {
+		Command   string                   `json:"command"`
+		Arguments []lspExtractionArguments `json:"arguments"`
+	}
+	if err := json.Unmarshal(rawParams, &params); err != nil {
+		return err
+	}
+	if len(params.Arguments) != 1 {
+		return errors.New("Expected exactly one argument")
+	}
+	uri := params.Arguments[0].URI
+	text, isOpen := server.documents[uri]
+	if !isOpen {
+		return fmt.Errorf("Document %v is not open", uri)
+	}
+	filename, err := filenameFromURI(uri)
+	if err != nil {
+		return err
+	}
+	selection := selectionFromLSPRange(text, params.Arguments[0].Range)
+	options := Options{Overlay: server.overlay(), UniqueName: true}
+	var result *Result
+	switch params.Command {
+	case extractFunctionCommand:
+		result, err = ExtractSource(filename, text, selection, "", options)
+	case extractVariableCommand:
+		result, err = ExtractVariableFromSource(filename, text, selection, defaultVariableName, options)
+	default:
+		return fmt.Errorf("Unknown command %v", params.Command)
+	}
+	if err != nil {
+		return err
+	}
+	edit := lspWorkspaceEdit{Changes: make(map[string][]lspTextEdit)}
+	for _, change := range result.Changes {
+		changeURI := uri
+		if change.Filename != filename {
+			changeURI = uriFromFilename(change.Filename)
+		}
+		edit.Changes[changeURI] = lspTextEditsFrom(change.Original, TextEditsFrom(change.Original, change.Modified))
+	}
+	server.sendRequest("workspace/applyEdit", map[string]interface{}{
+		"label": strings.TrimPrefix(params.Command, "goextract."),
+		"edit":  edit,
+	})
+	return nil
+}
+
+// overlay makes all open documents visible to the type check.
+func (server *lspServer) overlay() Overlay {
+	overlay := make(Overlay)
+	for uri, text := range server.documents {
+		if filename, err := filenameFromURI(uri); err == nil {
+			overlay[absPath(filename)] = text
+		}
+	}
+	return overlay
+}
+
+func lspTextEditsFrom(text string, textEdits []TextEdit) []lspTextEdit {
+	result := make([]lspTextEdit, len(textEdits))
+	for i, textEdit := range textEdits {
+		result[i] = lspTextEdit{
+			Range: lspRange{
+				Start: lspPositionFrom(text, textEdit.Start),
+				End:   lspPositionFrom(text, textEdit.End),
+			},
+			NewText: textEdit.NewText,
+		}
+	}
+	return result
+}
+
+// LSP columns count UTF-16 code units, while goextract columns count bytes.
+
+func selectionFromLSPRange(text string, lspRange lspRange) Selection {
+	lines := strings.Split(text, "\n")
+	return ShrinkToNonWhiteSpace(Selection{
+		Begin: positionFromLSPPosition(lines, lspRange.Start),
+		End:   positionFromLSPPosition(lines, lspRange.End),
+	}, text)
+}
+
+func positionFromLSPPosition(lines []string, lspPosition lspPosition) Position {
+	if lspPosition.Line >= len(lines) {
+		return Position{Line: len(lines), Column: len(lines[len(lines)-1]) + 1}
+	}
+	return Position{
+		Line:   lspPosition.Line + 1,
+		Column: byteColumnOf(lines[lspPosition.Line], lspPosition.Character) + 1,
+	}
+}
+
+func byteOffsetOf(text string, lspPosition lspPosition) int {
+	position := positionFromLSPPosition(strings.Split(text, "\n"), lspPosition)
+	offset := 0
+	for _, line := range strings.Split(text, "\n")[:position.Line-1] {
+		offset += len(line) + 1
+	}
+	return offset + position.Column - 1
+}
+
+func byteColumnOf(line string, utf16Column int) int {
+	units := 0
+	for i, r := range line {
+		if units >= utf16Column {
+			return i
+		}
+		units += len(utf16.Encode([]rune{r}))
+	}
+	return len(line)
+}
+
+func lspPositionFrom(text string, position TextPosition) lspPosition {
+	lineBegin := position.Offset - (position.Column - 1)
+	return lspPosition{
+		Line:      position.Line - 1,
+		Character: utf16Length(text[lineBegin:position.Offset]),
+	}
+}
+
+func utf16Length(s string) int {
+	length := 0
+	for len(s) > 0 {
+		r, size := utf8.DecodeRuneInString(s)
+		length += len(utf16.Encode([]rune{r}))
+		s = s[size:]
+	}
+	return length
+}
+
+func filenameFromURI(uri string) (string, error) {
+	parsedURI, err := url.Parse(uri)
+	if err != nil {
+		return "", err
+	}
+	if parsedURI.Scheme != "file" {
+		return "", fmt.Errorf("Unsupported URI scheme %v", parsedURI.Scheme)
+	}
+	return filepath.FromSlash(parsedURI.Path), nil
+}
+
+func uriFromFilename(filename string) string {
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(filename)}).String()
+}
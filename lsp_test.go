@@ -0,0 +1,202 @@
+package goextract_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	. "github.com/petergtz/goextract"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+type lspClient struct {
+	toServer   *io.PipeWriter
+	fromServer *bufio.Reader
+	nextID     int
+	done       chan error
+}
+
+func newLSPClient() *lspClient {
+	serverIn, toServer := io.Pipe()
+	fromServer, serverOut := io.Pipe()
+	client := &lspClient{toServer: toServer, fromServer: bufio.NewReader(fromServer), done: make(chan error, 1)}
+	go func() { client.done <- ServeLSP(serverIn, serverOut) }()
+	return client
+}
+
+func (client *lspClient) send(message map[string]interface{}) {
+	message["jsonrpc"] = "2.0"
+	content, err := json.Marshal(message)
+	Expect(err).NotTo(HaveOccurred())
+	_, err = fmt.Fprintf(client.toServer, "Content-Length: %v\r\n\r\n%s", len(content), content)
+	Expect(err).NotTo(HaveOccurred())
+}
+
+func (client *lspClient) notify(method string, params interface{}) {
+	client.send(map[string]interface{}{"method": method, "params": params})
+}
+
+func (client *lspClient) call(method string, params interface{}) map[string]interface{} {
+	client.nextID++
+	client.send(map[string]interface{}{"id": client.nextID, "method": method, "params": params})
+	for {
+		message := client.receive()
+		if message["id"] == float64(client.nextID) && message["method"] == nil {
+			return message
+		}
+	}
+}
+
+func (client *lspClient) receive() map[string]interface{} {
+	header, err := client.fromServer.ReadString('\n')
+	Expect(err).NotTo(HaveOccurred())
+	contentLength, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(header, "Content-Length:")))
+	Expect(err).NotTo(HaveOccurred())
+	_, err = client.fromServer.ReadString('\n')
+	Expect(err).NotTo(HaveOccurred())
+	content := make([]byte, contentLength)
+	_, err = io.ReadFull(client.fromServer, content)
+	Expect(err).NotTo(HaveOccurred())
+	var message map[string]interface{}
+	Expect(json.Unmarshal(content, &message)).To(Succeed())
+	return message
+}
+
+func (client *lspClient) exit() {
+	client.notify("exit", nil)
+	Eventually(client.done).Should(Receive(BeNil()))
+}
+
+func lspRange(startLine, startCharacter, endLine, endCharacter int) map[string]interface{} {
+	return map[string]interface{}{
+		"start": map[string]interface{}{"line": startLine, "character": startCharacter},
+		"end":   map[string]interface{}{"line": endLine, "character": endCharacter},
+	}
+}
+
+// applyLSPEdits only supports edits starting and ending at the beginning of a
+// line, which is what goextract produces.
+func applyLSPEdits(edits []interface{}, original string) string {
+	lines := strings.SplitAfter(original, "\n")
+	offsetOf := func(position interface{}) int {
+		line := int(position.(map[string]interface{})["line"].(float64))
+		Expect(position.(map[string]interface{})["character"]).To(BeEquivalentTo(0))
+		return len(strings.Join(lines[:line], ""))
+	}
+	result := original
+	for i := len(edits) - 1; i >= 0; i-- {
+		edit := edits[i].(map[string]interface{})
+		editRange := edit["range"].(map[string]interface{})
+		result = result[:offsetOf(editRange["start"])] + edit["newText"].(string) + result[offsetOf(editRange["end"]):]
+	}
+	return result
+}
+
+var _ = Describe("LSP server", func() {
+	var (
+		client *lspClient
+		dir    string
+		uri    string
+	)
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "goextract-lsp")
+		Expect(err).NotTo(HaveOccurred())
+		uri = "file://" + filepath.ToSlash(filepath.Join(dir, "unsaved.go"))
+
+		client = newLSPClient()
+		response := client.call("initialize", map[string]interface{}{"capabilities": map[string]interface{}{}})
+		Expect(response["result"]).To(HaveKeyWithValue("capabilities", HaveKey("codeActionProvider")))
+		client.notify("initialized", map[string]interface{}{})
+	})
+
+	AfterEach(func() {
+		client.call("shutdown", nil)
+		client.exit()
+		os.RemoveAll(dir)
+	})
+
+	codeActions := func(actionRange map[string]interface{}, only ...string) []interface{} {
+		context := map[string]interface{}{"diagnostics": []interface{}{}}
+		if len(only) != 0 {
+			context["only"] = only
+		}
+		response := client.call("textDocument/codeAction", map[string]interface{}{
+			"textDocument": map[string]interface{}{"uri": uri},
+			"range":        actionRange,
+			"context":      context,
+		})
+		Expect(response).NotTo(HaveKey("error"))
+		return response["result"].([]interface{})
+	}
+
+	execute := func(action interface{}) []interface{} {
+		command := action.(map[string]interface{})["command"].(map[string]interface{})
+		client.nextID++
+		client.send(map[string]interface{}{"id": client.nextID, "method": "workspace/executeCommand", "params": map[string]interface{}{
+			"command":   command["command"],
+			"arguments": command["arguments"],
+		}})
+		applyEdit := client.receive()
+		Expect(applyEdit).To(HaveKeyWithValue("method", "workspace/applyEdit"))
+		Expect(client.receive()).To(HaveKeyWithValue("result", BeNil()))
+		client.send(map[string]interface{}{"id": applyEdit["id"], "result": map[string]interface{}{"applied": true}})
+
+		changes := applyEdit["params"].(map[string]interface{})["edit"].(map[string]interface{})["changes"].(map[string]interface{})
+		Expect(changes).To(HaveKey(uri))
+		return changes[uri].([]interface{})
+	}
+
+	It("extracts statements of an unsaved buffer into a function", func() {
+		client.notify("textDocument/didOpen", map[string]interface{}{"textDocument": map[string]interface{}{
+			"uri": uri, "languageId": "go", "version": 1, "text": "package p\n",
+		}})
+		content := "package p\n\nfunc g() {}\nfunc h() {}\n\nfunc f() {\n\tg()\n\th()\n}\n"
+		client.notify("textDocument/didChange", map[string]interface{}{
+			"textDocument":   map[string]interface{}{"uri": uri, "version": 2},
+			"contentChanges": []interface{}{map[string]interface{}{"range": lspRange(1, 0, 1, 0), "text": content[len("package p\n"):]}},
+		})
+
+		actions := codeActions(lspRange(6, 0, 8, 0))
+		Expect(actions).To(HaveLen(1))
+		Expect(actions[0]).To(HaveKeyWithValue("kind", "refactor.extract.function"))
+
+		Expect(applyLSPEdits(execute(actions[0]), content)).To(Equal(
+			"package p\n\nfunc g() {}\nfunc h() {}\n\nfunc f() {\n\tdoG()\n}\n\nfunc doG() {\n\tg()\n\th()\n}\n"))
+	})
+
+	It("extracts a variable using UTF-16 based columns", func() {
+		content := "package p\n\nfunc f() int {\n\treturn len(\"ä€😀\") + 2*3\n}\n"
+		client.notify("textDocument/didOpen", map[string]interface{}{"textDocument": map[string]interface{}{
+			"uri": uri, "languageId": "go", "version": 1, "text": content,
+		}})
+
+		actions := codeActions(lspRange(3, 22, 3, 25), "refactor.extract.variable")
+		Expect(actions).To(HaveLen(1))
+		Expect(actions[0]).To(HaveKeyWithValue("kind", "refactor.extract.variable"))
+
+		Expect(applyLSPEdits(execute(actions[0]), content)).To(Equal(
+			"package p\n\nfunc f() int {\n\textractedVar := 2 * 3\n\treturn len(\"ä€😀\") + extractedVar\n}\n"))
+	})
+
+	It("offers no actions for selections that cannot be extracted", func() {
+		client.notify("textDocument/didOpen", map[string]interface{}{"textDocument": map[string]interface{}{
+			"uri": uri, "languageId": "go", "version": 1, "text": "package p\n\nfunc f() {\n\tdefer g()\n}\n\nfunc g() {}\n",
+		}})
+
+		Expect(codeActions(lspRange(3, 1, 3, 10))).To(BeEmpty())
+	})
+
+	It("answers unknown requests with an error", func() {
+		Expect(client.call("textDocument/hover", map[string]interface{}{})).To(HaveKeyWithValue("error", HaveKeyWithValue("code", BeEquivalentTo(-32601))))
+	})
+})
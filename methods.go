@@ -0,0 +1,334 @@
+package goextract
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// FunctionToMethod turns the function funcName, declared in filename, into a
+// method on the type of its first parameter, which must be a named type of
+// the package or a pointer to one. All calls in the package call the method
+// on their first argument, other uses become method expressions. The first
+// change is the one of filename.
+func FunctionToMethod(filename string, funcName string, options Options) (*Result, error) {
+	refactoring, err := newPackageRefactoring(filename, options.Overlay, "method")
+	if err != nil {
+		return &Result{}, err
+	}
+	funcDecl := funcOrMethodDeclNamed(refactoring.astFile, funcName)
+	if funcDecl == nil || funcDecl.Recv != nil {
+		return &Result{}, fmt.Errorf("There is no function %v in %v", funcName, filename)
+	}
+	if funcDecl.Type.TypeParams != nil {
+		return &Result{}, fmt.Errorf("The generic function %v cannot become a method", funcName)
+	}
+	if funcDecl.Type.Params.NumFields() == 0 {
+		return &Result{}, fmt.Errorf("%v has no parameters", funcName)
+	}
+	recvField := funcDecl.Type.Params.List[0]
+	converter := &methodConverter{
+		packageRefactoring: refactoring,
+		funcDecl:           funcDecl,
+		recvType:           refactoring.info.TypeOf(recvField.Type),
+		recvTypeText:       refactoring.originalText(recvField.Type),
+	}
+	named := converter.namedRecvType()
+	if named == nil || named.Obj().Pkg() != refactoring.pkg || types.IsInterface(named) || isPointer(named.Underlying()) {
+		return &Result{}, fmt.Errorf("The first parameter of %v must be of a named type declared in package %v or a pointer to one", funcName, refactoring.pkg.Name())
+	}
+	if object, _, _ := types.LookupFieldOrMethod(named, true, refactoring.pkg, funcName); object != nil {
+		return &Result{}, fmt.Errorf("%v already has a field or method %v", named.Obj().Name(), funcName)
+	}
+	refactoring.checkNotUsedByExternalTests(funcDecl)
+
+	recv := converter.recvTypeText
+	if len(recvField.Names) != 0 {
+		recv = recvField.Names[0].Name + " " + recv
+	}
+	refactoring.edit(funcDecl.Name.Pos(), funcDecl.Name.Pos(), func() string { return "(" + recv + ") " })
+	switch params := funcDecl.Type.Params; {
+	case len(recvField.Names) > 1:
+		refactoring.edit(recvField.Names[0].Pos(), recvField.Names[1].Pos(), func() string { return "" })
+	case len(params.List) > 1:
+		refactoring.edit(recvField.Pos(), params.List[1].Pos(), func() string { return "" })
+	default:
+		refactoring.edit(recvField.Pos(), params.Closing, func() string { return "" })
+	}
+
+	funcObject := refactoring.info.Defs[funcDecl.Name]
+	for _, file := range refactoring.files {
+		called := make(map[*ast.Ident]bool)
+		ast.Inspect(file, func(node ast.Node) bool {
+			if call, isCall := node.(*ast.CallExpr); isCall {
+				if ident, isIdent := astutil.Unparen(call.Fun).(*ast.Ident); isIdent && refactoring.info.Uses[ident] == funcObject {
+					called[ident] = true
+					converter.callOnReceiver(call)
+				}
+			}
+			return true
+		})
+		ast.Inspect(file, func(node ast.Node) bool {
+			if ident, isIdent := node.(*ast.Ident); isIdent && refactoring.info.Uses[ident] == funcObject && !called[ident] {
+				converter.checkTypeVisible(ident.Pos())
+				refactoring.edit(ident.Pos(), ident.End(), func() string { return converter.methodExpression() })
+			}
+			return true
+		})
+	}
+	return refactoring.result(options)
+}
+
+// MethodToFunction turns the method methodName, given as Type.Method and
+// declared in filename, into a function taking the receiver as its first
+// parameter. All calls in the package pass the receiver, method values become
+// function literals bound to the receiver and method expressions the
+// function. The first change is the one of filename.
+func MethodToFunction(filename string, methodName string, options Options) (*Result, error) {
+	refactoring, err := newPackageRefactoring(filename, options.Overlay, "function")
+	if err != nil {
+		return &Result{}, err
+	}
+	funcDecl := funcOrMethodDeclNamed(refactoring.astFile, methodName)
+	if funcDecl == nil || funcDecl.Recv == nil {
+		return &Result{}, fmt.Errorf("There is no method %v in %v", methodName, filename)
+	}
+	name := funcDecl.Name.Name
+	if _, object := refactoring.pkg.Scope().LookupParent(name, token.NoPos); object != nil {
+		return &Result{}, fmt.Errorf("%v is already declared", name)
+	}
+	refactoring.checkNotUsedByExternalTests(funcDecl)
+	recvField := funcDecl.Recv.List[0]
+	converter := &methodConverter{
+		packageRefactoring: refactoring,
+		funcDecl:           funcDecl,
+		recvType:           refactoring.info.TypeOf(recvField.Type),
+		recvTypeText:       refactoring.originalText(recvField.Type),
+	}
+
+	params := funcDecl.Type.Params
+	paramsNamed := len(params.List) != 0 && len(params.List[0].Names) != 0
+	recv := converter.recvTypeText
+	if len(recvField.Names) != 0 {
+		recv = recvField.Names[0].Name + " " + recv
+	} else if paramsNamed {
+		recv = "_ " + recv
+	}
+	if len(params.List) != 0 {
+		recv += ", "
+	}
+	refactoring.edit(funcDecl.Recv.Pos(), funcDecl.Name.Pos(), func() string { return "" })
+	refactoring.edit(params.Opening+1, params.Opening+1, func() string { return recv })
+	if len(recvField.Names) != 0 && !paramsNamed {
+		// Named and unnamed parameters cannot be mixed.
+		for _, field := range params.List {
+			refactoring.edit(field.Pos(), field.Pos(), func() string { return "_ " })
+		}
+	}
+
+	methodObject := refactoring.info.Defs[funcDecl.Name]
+	for _, file := range refactoring.files {
+		calls := make(map[*ast.SelectorExpr]*ast.CallExpr)
+		ast.Inspect(file, func(node ast.Node) bool {
+			if call, isCall := node.(*ast.CallExpr); isCall {
+				if selector, isSelector := astutil.Unparen(call.Fun).(*ast.SelectorExpr); isSelector {
+					calls[selector] = call
+				}
+			}
+			return true
+		})
+		ast.Inspect(file, func(node ast.Node) bool {
+			selector, isSelector := node.(*ast.SelectorExpr)
+			if !isSelector {
+				return true
+			}
+			selection := refactoring.info.Selections[selector]
+			if selection == nil || selection.Obj() != methodObject {
+				return true
+			}
+			if lookupAt(refactoring.pkg, name, selector.Pos()) != nil {
+				refactoring.problem(selector.Pos(), "%v refers to something else here", name)
+				return true
+			}
+			if len(selection.Index()) > 1 {
+				refactoring.problem(selector.Pos(), "%v is promoted from an embedded field here", name)
+				return true
+			}
+			switch {
+			case selection.Kind() == types.MethodExpr:
+				if !types.Identical(selection.Recv(), converter.recvType) {
+					refactoring.problem(selector.Pos(), "The method expression does not match the receiver of %v", name)
+					return true
+				}
+				refactoring.edit(selector.Pos(), selector.End(), func() string { return name })
+			case calls[selector] != nil:
+				converter.callWithReceiver(calls[selector], selector.X)
+			default:
+				converter.bindReceiver(selector)
+			}
+			return true
+		})
+	}
+	return refactoring.result(options)
+}
+
+// methodConverter turns funcDecl from a function into a method or back.
+// recvType is the type of the receiver, i.e. of the first parameter of the
+// function.
+type methodConverter struct {
+	*packageRefactoring
+	funcDecl     *ast.FuncDecl
+	recvType     types.Type
+	recvTypeText string
+}
+
+func (converter *methodConverter) namedRecvType() *types.Named {
+	recvType := converter.recvType
+	if pointer, isPointer := recvType.(*types.Pointer); isPointer {
+		recvType = pointer.Elem()
+	}
+	named, _ := recvType.(*types.Named)
+	return named
+}
+
+func isPointer(typ types.Type) bool {
+	_, isPointer := typ.(*types.Pointer)
+	return isPointer
+}
+
+// checkTypeVisible reports if the receiver type is not referred to by its
+// name at pos.
+func (converter *methodConverter) checkTypeVisible(pos token.Pos) {
+	typeName := converter.namedRecvType().Obj()
+	if lookupAt(converter.pkg, typeName.Name(), pos) != typeName {
+		converter.problem(pos, "%v refers to something else here", typeName.Name())
+	}
+}
+
+func (converter *methodConverter) methodExpression() string {
+	if isPointer(converter.recvType) {
+		return "(" + converter.recvTypeText + ")." + converter.funcDecl.Name.Name
+	}
+	return converter.recvTypeText + "." + converter.funcDecl.Name.Name
+}
+
+// callOnReceiver turns a call of the function into a call of the method on
+// its first argument.
+func (converter *methodConverter) callOnReceiver(call *ast.CallExpr) {
+	if len(call.Args) == 0 {
+		converter.problem(call.Pos(), "The call has no receiver argument")
+		return
+	}
+	recv := call.Args[0]
+	if _, isTuple := converter.info.TypeOf(recv).(*types.Tuple); isTuple {
+		converter.problem(recv.Pos(), "The receiver cannot be separated from the other arguments")
+		return
+	}
+	if converter.needsConversion(recv) {
+		converter.checkTypeVisible(recv.Pos())
+	}
+	converter.edit(call.Pos(), call.End(), func() string {
+		args := ""
+		if len(call.Args) > 1 {
+			args = converter.textOf(converter.filenameOf(call.Pos()), converter.offsetOf(call.Args[1].Pos()), converter.offsetOf(call.Rparen))
+		}
+		return converter.receiverText(recv) + "." + converter.funcDecl.Name.Name + "(" + args + ")"
+	})
+}
+
+// receiverText returns the text of the argument arg as receiver of a method
+// call. Constants and arguments of other types are converted, &v becomes v
+// and all but primary expressions are parenthesized.
+func (converter *methodConverter) receiverText(arg ast.Expr) string {
+	if converter.needsConversion(arg) {
+		typeText := converter.recvTypeText
+		if isPointer(converter.recvType) {
+			typeText = "(" + typeText + ")"
+		}
+		return typeText + "(" + converter.nodeText(arg) + ")"
+	}
+	if unary, isUnary := astutil.Unparen(arg).(*ast.UnaryExpr); isUnary && unary.Op == token.AND {
+		if _, isCompositeLit := unary.X.(*ast.CompositeLit); !isCompositeLit {
+			arg = unary.X
+		}
+	}
+	switch arg.(type) {
+	case *ast.Ident, *ast.SelectorExpr, *ast.CallExpr, *ast.IndexExpr, *ast.ParenExpr:
+		return converter.nodeText(arg)
+	}
+	return "(" + converter.nodeText(arg) + ")"
+}
+
+// needsConversion returns whether arg is a constant, nil or of another type
+// than the receiver, which has no method set of the receiver type.
+func (converter *methodConverter) needsConversion(arg ast.Expr) bool {
+	typeAndValue := converter.info.Types[arg]
+	return typeAndValue.Value != nil || typeAndValue.IsNil() || !types.Identical(typeAndValue.Type, converter.recvType)
+}
+
+// callWithReceiver turns a call of the method on recv into a call of the
+// function with recv as first argument.
+func (converter *methodConverter) callWithReceiver(call *ast.CallExpr, recv ast.Expr) {
+	converter.edit(call.Pos(), call.End(), func() string {
+		args := []string{converter.receiverArgument(recv)}
+		if len(call.Args) != 0 {
+			args = append(args, converter.textOf(converter.filenameOf(call.Pos()), converter.offsetOf(call.Args[0].Pos()), converter.offsetOf(call.Rparen)))
+		}
+		return converter.funcDecl.Name.Name + "(" + strings.Join(args, ", ") + ")"
+	})
+}
+
+// receiverArgument returns the text of the receiver recv of a method call as
+// first argument of the function, taking its address or dereferencing it
+// where the call did so implicitly.
+func (converter *methodConverter) receiverArgument(recv ast.Expr) string {
+	switch recvIsPointer := isPointer(converter.info.TypeOf(recv)); {
+	case isPointer(converter.recvType) && !recvIsPointer:
+		return "&" + converter.nodeText(recv)
+	case !isPointer(converter.recvType) && recvIsPointer:
+		return "*" + converter.nodeText(recv)
+	}
+	return converter.nodeText(recv)
+}
+
+// bindReceiver replaces the method value selector by a function literal
+// calling the function. The receiver is evaluated where the method value was,
+// so it is passed to an enclosing function literal.
+func (converter *methodConverter) bindReceiver(selector *ast.SelectorExpr) {
+	name := converter.funcDecl.Name.Name
+	recvName := "recv"
+	if names := converter.funcDecl.Recv.List[0].Names; len(names) != 0 && names[0].Name != "_" {
+		recvName = names[0].Name
+	}
+	var args []string
+	for _, field := range converter.funcDecl.Type.Params.List {
+		for _, ident := range field.Names {
+			if ident.Name == "_" || ident.Name == name || ident.Name == recvName {
+				converter.problem(selector.Pos(), "The parameters of %v must be named to convert its method value", name)
+				return
+			}
+			args = append(args, ident.Name)
+		}
+		if len(field.Names) == 0 {
+			converter.problem(selector.Pos(), "The parameters of %v must be named to convert its method value", name)
+			return
+		}
+		if _, isEllipsis := field.Type.(*ast.Ellipsis); isEllipsis {
+			args[len(args)-1] += "..."
+		}
+	}
+	params := converter.funcDecl.Type.Params
+	funcType := "func(" + converter.sources[converter.filenameOf(params.Pos())][converter.offsetOf(params.Opening+1):converter.offsetOf(params.Closing)] + ")"
+	body := name + "(" + strings.Join(append([]string{recvName}, args...), ", ") + ")"
+	if results := converter.funcDecl.Type.Results; results != nil {
+		funcType += " " + converter.originalText(results)
+		body = "return " + body
+	}
+	converter.edit(selector.Pos(), selector.End(), func() string {
+		return "func(" + recvName + " " + converter.recvTypeText + ") " + funcType + " {\nreturn " + funcType + " { " + body + " }\n}(" + converter.receiverArgument(selector.X) + ")"
+	})
+}
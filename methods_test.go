@@ -0,0 +1,158 @@
+package goextract_test
+
+import (
+	. "github.com/petergtz/goextract"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Converting between functions and methods", func() {
+	pkg := newTempPackage("goextract-methods", map[string]string{
+		"a.go": `package p
+
+type counter struct {
+	n int
+}
+
+func add(c *counter, delta int) {
+	c.n += delta
+}
+
+func (c counter) twice() int {
+	return c.n * 2
+}
+`,
+		"b.go": `package p
+
+var adder = add
+
+func g(c counter, p *counter) int {
+	add(&c, 1)
+	add(p, c.twice())
+	f := p.twice
+	return f() + counter.twice(c)
+}
+`,
+	})
+
+	It("turns a function into a method and updates calls and function values", func() {
+		result, err := FunctionToMethod(pkg.path("a.go"), "add", Options{})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Changes).To(HaveLen(2))
+		Expect(result.Changes[0].Modified).To(ContainSubstring(`func (c *counter) add(delta int) {
+	c.n += delta
+}`))
+		Expect(result.Changes[1].Modified).To(Equal(`package p
+
+var adder = (*counter).add
+
+func g(c counter, p *counter) int {
+	c.add(1)
+	p.add(c.twice())
+	f := p.twice
+	return f() + counter.twice(c)
+}
+`))
+	})
+
+	It("turns a method into a function and updates calls, method values and method expressions", func() {
+		result, err := MethodToFunction(pkg.path("a.go"), "counter.twice", Options{})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Changes).To(HaveLen(2))
+		Expect(result.Changes[0].Modified).To(ContainSubstring(`func twice(c counter) int {
+	return c.n * 2
+}`))
+		Expect(result.Changes[1].Modified).To(Equal(`package p
+
+var adder = add
+
+func g(c counter, p *counter) int {
+	add(&c, 1)
+	add(p, twice(c))
+	f := func(c counter) func() int {
+		return func() int { return twice(c) }
+	}(*p)
+	return f() + twice(c)
+}
+`))
+	})
+
+	It("refuses names that are already taken", func() {
+		_, err := MethodToFunction(pkg.path("a.go"), "counter.twice", Options{})
+		Expect(err).NotTo(HaveOccurred())
+
+		pkg.writeFile("c.go", "package p\n\nfunc twice() {}\n")
+		_, err = MethodToFunction(pkg.path("a.go"), "counter.twice", Options{})
+		Expect(err).To(MatchError("twice is already declared"))
+
+		pkg.writeFile("c.go", "package p\n\nfunc (c *counter) add(int) {}\n")
+		_, err = FunctionToMethod(pkg.path("a.go"), "add", Options{})
+		Expect(err).To(MatchError("counter already has a field or method add"))
+	})
+
+	It("refuses methods promoted from embedded fields", func() {
+		pkg.writeFile("c.go", `package p
+
+type wrapper struct{ counter }
+
+func h(w wrapper) int {
+	return w.twice()
+}
+`)
+
+		_, err := MethodToFunction(pkg.path("a.go"), "counter.twice", Options{})
+
+		Expect(err).To(MatchError(ContainSubstring("twice is promoted from an embedded field here")))
+	})
+
+	It("updates the calls in the test files of the package", func() {
+		pkg.writeFile("a_test.go", `package p
+
+import "testing"
+
+func TestAdd(t *testing.T) {
+	c := &counter{}
+	add(c, 1)
+	if c.n != 1 {
+		t.Fail()
+	}
+}
+`)
+
+		result, err := FunctionToMethod(pkg.path("a.go"), "add", Options{})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Changes).To(HaveLen(3))
+		Expect(result.Changes[1].Filename).To(Equal(pkg.path("a_test.go")))
+		Expect(result.Changes[1].Modified).To(ContainSubstring("\tc.add(1)\n"))
+	})
+
+	It("refuses functions used by the external test package", func() {
+		pkg.writeFile("go.mod", "module example.com/p\n")
+		pkg.writeFile("c.go", `package p
+
+type Counter struct{ N int }
+
+func Add(c *Counter, delta int) { c.N += delta }
+`)
+		pkg.writeFile("c_test.go", `package p_test
+
+import (
+	"testing"
+
+	"example.com/p"
+)
+
+func TestAdd(t *testing.T) {
+	p.Add(&p.Counter{}, 1)
+}
+`)
+
+		_, err := FunctionToMethod(pkg.path("c.go"), "Add", Options{})
+
+		Expect(err).To(MatchError(ContainSubstring("Add is used by the external test package p_test, whose uses could not be updated")))
+	})
+})
@@ -0,0 +1,385 @@
+package goextract
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"strings"
+)
+
+// Move moves the top-level declaration of name, declared in filename, with
+// its doc comment to the end of targetFilename and moves the imports it needs
+// along. Methods are given as Type.Method. If targetFilename is in another
+// directory, the declaration is exported, a type takes its methods along and
+// all references in the package are qualified with an import of the other
+// package. The first change is the one of filename.
+func Move(filename string, name string, targetFilename string, options Options) (*Result, error) {
+	if sameFile(targetFilename, filename) {
+		return &Result{}, fmt.Errorf("%v is the input file", targetFilename)
+	}
+	refactoring, err := newPackageRefactoring(filename, options.Overlay, "move")
+	if err != nil {
+		return &Result{}, err
+	}
+	moved, object := topLevelDeclNamed(refactoring, name)
+	if moved == nil {
+		return &Result{}, fmt.Errorf("There is no declaration %v in %v", name, filename)
+	}
+	if valueSpec, isValueSpec := moved.spec.(*ast.ValueSpec); isValueSpec && len(valueSpec.Names) > 1 {
+		other := valueSpec.Names[0].Name
+		if other == name {
+			other = valueSpec.Names[1].Name
+		}
+		return &Result{}, fmt.Errorf("%v is declared together with %v", name, other)
+	}
+	if moved.dependsOnConstGroup() {
+		return &Result{}, fmt.Errorf("The value of %v depends on its position in the const declaration", name)
+	}
+	mover := &declMover{packageRefactoring: refactoring, moved: []*movedDecl{moved}, object: object, objects: map[types.Object]bool{object: true}}
+
+	targetDir := filepath.Dir(targetFilename)
+	targetPackageName := refactoring.astFile.Name.Name
+	var target *targetPackage
+	if absPath(targetDir) == absPath(filepath.Dir(filename)) {
+		targetFilename = filepath.Join(filepath.Dir(filename), filepath.Base(targetFilename))
+	} else {
+		if funcDecl, isFuncDecl := moved.decl.(*ast.FuncDecl); isFuncDecl && funcDecl.Recv != nil {
+			return &Result{}, fmt.Errorf("Methods can only be moved to another package together with their type")
+		}
+		target, err = mover.otherPackageTarget(targetDir)
+		if err != nil {
+			return &Result{}, err
+		}
+		targetPackageName = target.name
+		if typeName, isTypeName := object.(*types.TypeName); isTypeName {
+			mover.addMethodsOf(typeName)
+		}
+		mover.newName, err = uniqueNameInPackage(targetDir, target.importPath, exported(name), options)
+		if err != nil {
+			return &Result{}, err
+		}
+		mover.checkDependencies(target)
+	}
+	if _, isInPackage := refactoring.sources[targetFilename]; !isInPackage {
+		var exists bool
+		refactoring.sources[targetFilename], exists = readTargetFile(targetFilename, targetPackageName, options.Overlay)
+		refactoring.created[targetFilename] = !exists
+	}
+	packageClause, err := parser.ParseFile(token.NewFileSet(), targetFilename, refactoring.sources[targetFilename], parser.PackageClauseOnly)
+	if err != nil {
+		return &Result{}, fmt.Errorf("Cannot parse %v: %v", targetFilename, err)
+	}
+	if packageClause.Name.Name != targetPackageName {
+		return &Result{}, fmt.Errorf("%v does not belong to package %v", targetFilename, targetPackageName)
+	}
+
+	if target != nil {
+		mover.renameAndQualify(target)
+	}
+	mover.moveTo(targetFilename)
+	if len(refactoring.problems) != 0 {
+		return &Result{}, &ValidationError{Problems: refactoring.problems}
+	}
+	changes := refactoring.changes()
+	typeErrors := checkChangedPackage(changes, options.Overlay)
+	if target != nil && options.Overlay.isDir(targetDir) {
+		typeErrors = append(typeErrors, checkChangedPackage(withChangeFirst(changes, targetFilename), options.Overlay)...)
+	}
+	if len(typeErrors) != 0 && !options.Force {
+		return &Result{}, &TypeCheckError{Problems: typeErrors}
+	}
+	return &Result{Changes: changes, Warnings: typeErrors}, nil
+}
+
+// movedDecl is a declaration in file, or its spec if it is declared in a
+// group together with others.
+type movedDecl struct {
+	file *ast.File
+	decl ast.Decl
+	spec ast.Spec
+}
+
+func (moved *movedDecl) node() ast.Node {
+	if moved.spec != nil {
+		return moved.spec
+	}
+	return moved.decl
+}
+
+// pos returns the position of the moved declaration including its doc
+// comment.
+func (moved *movedDecl) pos() token.Pos {
+	switch spec := moved.spec.(type) {
+	case *ast.ValueSpec:
+		if spec.Doc != nil {
+			return spec.Doc.Pos()
+		}
+	case *ast.TypeSpec:
+		if spec.Doc != nil {
+			return spec.Doc.Pos()
+		}
+	}
+	if moved.spec != nil {
+		return moved.spec.Pos()
+	}
+	return declPos(moved.decl)
+}
+
+func (moved *movedDecl) doc() *ast.CommentGroup {
+	switch node := moved.node().(type) {
+	case *ast.FuncDecl:
+		return node.Doc
+	case *ast.GenDecl:
+		return node.Doc
+	case *ast.ValueSpec:
+		return node.Doc
+	case *ast.TypeSpec:
+		return node.Doc
+	}
+	return nil
+}
+
+// dependsOnConstGroup reports whether moved is a const spec in a group that
+// uses iota or repeats the previous values.
+func (moved *movedDecl) dependsOnConstGroup() bool {
+	valueSpec, isValueSpec := moved.spec.(*ast.ValueSpec)
+	if !isValueSpec || moved.decl.(*ast.GenDecl).Tok != token.CONST {
+		return false
+	}
+	if len(valueSpec.Values) == 0 {
+		return true
+	}
+	usesIota := false
+	ast.Inspect(valueSpec, func(node ast.Node) bool {
+		if ident, isIdent := node.(*ast.Ident); isIdent && ident.Name == "iota" {
+			usesIota = true
+		}
+		return !usesIota
+	})
+	return usesIota
+}
+
+// topLevelDeclNamed finds the declaration of name in the file of the
+// refactoring and returns it with its object.
+func topLevelDeclNamed(refactoring *packageRefactoring, name string) (*movedDecl, types.Object) {
+	if funcDecl := funcOrMethodDeclNamed(refactoring.astFile, name); funcDecl != nil {
+		return &movedDecl{file: refactoring.astFile, decl: funcDecl}, refactoring.info.Defs[funcDecl.Name]
+	}
+	for _, decl := range refactoring.astFile.Decls {
+		genDecl, isGenDecl := decl.(*ast.GenDecl)
+		if !isGenDecl {
+			continue
+		}
+		for _, spec := range genDecl.Specs {
+			var names []*ast.Ident
+			switch typedSpec := spec.(type) {
+			case *ast.TypeSpec:
+				names = []*ast.Ident{typedSpec.Name}
+			case *ast.ValueSpec:
+				names = typedSpec.Names
+			}
+			if i := indexOfName(names, name); i != -1 {
+				moved := &movedDecl{file: refactoring.astFile, decl: genDecl}
+				if len(genDecl.Specs) > 1 || len(names) > 1 {
+					moved.spec = spec
+				}
+				return moved, refactoring.info.Defs[names[i]]
+			}
+		}
+	}
+	return nil, nil
+}
+
+func indexOfName(names []*ast.Ident, name string) int {
+	for i, ident := range names {
+		if ident.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// declMover moves the declaration of object, and of its methods when moving
+// to another package, to another file. The first moved declaration is the
+// one of object. When moving to another package, object is renamed to
+// newName.
+type declMover struct {
+	*packageRefactoring
+	moved   []*movedDecl
+	object  types.Object
+	objects map[types.Object]bool
+	newName string
+}
+
+// otherPackageTarget determines the package in dir and makes sure it does not
+// import the package of the refactoring.
+func (mover *declMover) otherPackageTarget(dir string) (*targetPackage, error) {
+	importPath, err := importPathOf(dir, mover.overlay)
+	if err != nil {
+		return nil, err
+	}
+	originalImportPath, err := importPathOf(filepath.Dir(mover.filename), mover.overlay)
+	if err != nil {
+		return nil, err
+	}
+	target := &targetPackage{name: packageNameIn(dir, mover.overlay), importPath: importPath}
+	if target.name == "main" {
+		return nil, fmt.Errorf("Cannot move to %v, package main cannot be imported", dir)
+	}
+	if importsTransitively(dir, originalImportPath, mover.overlay, make(map[string]bool)) {
+		return nil, fmt.Errorf("Cannot move to %v, it would create an import cycle with %v", importPath, originalImportPath)
+	}
+	return target, nil
+}
+
+// addMethodsOf adds the methods of typeName in all files of the package to
+// the moved declarations.
+func (mover *declMover) addMethodsOf(typeName *types.TypeName) {
+	for _, file := range mover.files {
+		for _, decl := range file.Decls {
+			funcDecl, isFuncDecl := decl.(*ast.FuncDecl)
+			if !isFuncDecl || funcDecl.Recv == nil {
+				continue
+			}
+			method, isFunc := mover.info.Defs[funcDecl.Name].(*types.Func)
+			if !isFunc {
+				continue
+			}
+			recvType := method.Type().(*types.Signature).Recv().Type()
+			if pointer, isPointer := recvType.(*types.Pointer); isPointer {
+				recvType = pointer.Elem()
+			}
+			if named, isNamed := recvType.(*types.Named); isNamed && named.Obj() == typeName {
+				mover.moved = append(mover.moved, &movedDecl{file: file, decl: funcDecl})
+				mover.objects[method] = true
+			}
+		}
+	}
+}
+
+// checkDependencies reports the package level identifiers of the package of
+// the refactoring that the moved declarations use. Unexported ones cannot be
+// accessed from target, and exported ones would require an import cycle.
+func (mover *declMover) checkDependencies(target *targetPackage) {
+	reported := make(map[types.Object]bool)
+	for _, moved := range mover.moved {
+		ast.Inspect(moved.node(), func(node ast.Node) bool {
+			ident, isIdent := node.(*ast.Ident)
+			if !isIdent {
+				return true
+			}
+			object := mover.info.Uses[ident]
+			if object == nil || object.Pkg() != mover.pkg || object.Parent() != mover.pkg.Scope() || mover.objects[object] || reported[object] {
+				return true
+			}
+			reported[object] = true
+			if object.Exported() {
+				mover.problem(ident.Pos(), "%v is exported, but using it from %v would create an import cycle", object.Name(), target.importPath)
+			} else {
+				mover.problem(ident.Pos(), "%v is not exported and would be left behind", object.Name())
+			}
+			return true
+		})
+	}
+}
+
+func (mover *declMover) isMoved(pos token.Pos) bool {
+	for _, moved := range mover.moved {
+		if moved.pos() <= pos && pos < moved.node().End() {
+			return true
+		}
+	}
+	return false
+}
+
+// renameAndQualify renames the moved object to newName and qualifies all
+// references to it outside of the moved declarations with an import of
+// target.
+func (mover *declMover) renameAndQualify(target *targetPackage) {
+	name := mover.object.Name()
+	if doc := mover.moved[0].doc(); doc != nil && strings.HasPrefix(doc.List[0].Text, "// "+name+" ") {
+		begin := doc.List[0].Pos() + token.Pos(len("// "))
+		mover.edit(begin, begin+token.Pos(len(name)), func() string { return mover.newName })
+	}
+	for _, file := range mover.files {
+		packageName := ""
+		ast.Inspect(file, func(node ast.Node) bool {
+			ident, isIdent := node.(*ast.Ident)
+			if !isIdent || mover.info.ObjectOf(ident) != mover.object {
+				return true
+			}
+			if mover.isMoved(ident.Pos()) {
+				mover.edit(ident.Pos(), ident.End(), func() string { return mover.newName })
+				return true
+			}
+			if packageName == "" {
+				packageName = packageNameFor(file, target)
+				explicitName := ""
+				if packageName != assumedPackageName(target.importPath) {
+					explicitName = packageName
+				}
+				mover.addImport(mover.filenameOf(file.Pos()), explicitName, target.importPath)
+			}
+			qualified := packageName + "." + mover.newName
+			mover.edit(ident.Pos(), ident.End(), func() string { return qualified })
+			return true
+		})
+	}
+}
+
+// moveTo removes the moved declarations with their lines and appends them to
+// targetFilename, together with the imports they use.
+func (mover *declMover) moveTo(targetFilename string) {
+	var texts []func() string
+	for _, moved := range mover.moved {
+		moved := moved
+		filename := mover.filenameOf(moved.pos())
+		src := mover.sources[filename]
+		begin := lineBeginOf(src, mover.offsetOf(moved.pos()))
+		end := lineEndOf(src, mover.offsetOf(moved.node().End()))
+		mover.edits[filename] = append(mover.edits[filename], lazyEdit{begin, end, func() string { return "" }})
+		// The text ends before the line break, so the removal is not
+		// contained in it.
+		texts = append(texts, func() string {
+			if moved.spec == nil {
+				return mover.textOf(filename, mover.offsetOf(moved.pos()), end-1)
+			}
+			text := moved.decl.(*ast.GenDecl).Tok.String() + " " + mover.textOf(filename, mover.offsetOf(moved.spec.Pos()), end-1)
+			if moved.pos() != moved.spec.Pos() {
+				text = mover.textOf(filename, mover.offsetOf(moved.pos()), mover.offsetOf(moved.spec.Pos())) + text
+			}
+			return text
+		})
+		for _, importSpec := range moved.file.Imports {
+			path, name := importPathAndName(importSpec)
+			if name != "_" && name != "." && usesPackageName(moved.node(), name) {
+				mover.addImport(targetFilename, explicitImportName(importSpec), path)
+				mover.removeImportIfUnused(filename, explicitImportName(importSpec), path)
+			}
+		}
+	}
+	targetEnd := len(mover.sources[targetFilename])
+	mover.edits[targetFilename] = append(mover.edits[targetFilename], lazyEdit{targetEnd, targetEnd, func() string {
+		var movedTexts []string
+		for _, text := range texts {
+			movedTexts = append(movedTexts, text())
+		}
+		return "\n" + strings.Join(movedTexts, "\n\n") + "\n"
+	}})
+}
+
+// withChangeFirst returns changes with the change of filename first.
+func withChangeFirst(changes []FileChange, filename string) []FileChange {
+	var reordered []FileChange
+	for _, change := range changes {
+		if change.Filename == filename {
+			reordered = append([]FileChange{change}, reordered...)
+		} else {
+			reordered = append(reordered, change)
+		}
+	}
+	return reordered
+}
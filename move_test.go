@@ -0,0 +1,159 @@
+package goextract_test
+
+import (
+	. "github.com/petergtz/goextract"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Move", func() {
+	pkg := newTempPackage("goextract-move", map[string]string{
+		"go.mod": "module example.com/m\n",
+		"a.go": `package m
+
+import (
+	"fmt"
+	"strings"
+)
+
+var prefix = "> "
+
+// shout prints s in upper case.
+func shout(s string) {
+	fmt.Println(strings.ToUpper(s))
+}
+
+type counter struct {
+	N int
+}
+
+func (c *counter) Inc() {
+	c.N++
+}
+
+func f() {
+	shout("hi")
+	fmt.Println(prefix)
+}
+`,
+		"b.go": `package m
+
+func g() int {
+	c := &counter{}
+	c.Inc()
+	shout(prefix)
+	return c.N
+}
+`,
+	})
+
+	It("moves a function with its doc comment and imports to another file of the package", func() {
+		result, err := Move(pkg.path("a.go"), "shout", pkg.path("shout.go"), Options{})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Changes).To(HaveLen(2))
+		Expect(result.Changes[0].Modified).To(Equal(`package m
+
+import (
+	"fmt"
+)
+
+var prefix = "> "
+
+type counter struct {
+	N int
+}
+
+func (c *counter) Inc() {
+	c.N++
+}
+
+func f() {
+	shout("hi")
+	fmt.Println(prefix)
+}
+`))
+		Expect(result.Changes[1].Filename).To(Equal(pkg.path("shout.go")))
+		Expect(result.Changes[1].Original).To(BeEmpty())
+		Expect(result.Changes[1].Modified).To(Equal(`package m
+
+import (
+	"fmt"
+	"strings"
+)
+
+// shout prints s in upper case.
+func shout(s string) {
+	fmt.Println(strings.ToUpper(s))
+}
+`))
+	})
+
+	It("exports a type moved to another package, moves its methods along and qualifies its uses", func() {
+		result, err := Move(pkg.path("a.go"), "counter", pkg.path("count", "count.go"), Options{})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Changes).To(HaveLen(3))
+		Expect(result.Changes[1].Modified).To(Equal(`package m
+
+import "example.com/m/count"
+
+func g() int {
+	c := &count.Counter{}
+	c.Inc()
+	shout(prefix)
+	return c.N
+}
+`))
+		Expect(result.Changes[2].Original).To(BeEmpty())
+		Expect(result.Changes[2].Modified).To(Equal(`package count
+
+type Counter struct {
+	N int
+}
+
+func (c *Counter) Inc() {
+	c.N++
+}
+`))
+	})
+
+	It("refuses to leave unexported dependencies behind", func() {
+		pkg.writeFile("c.go", `package m
+
+func decorated(s string) string {
+	return prefix + s
+}
+`)
+		_, err := Move(pkg.path("c.go"), "decorated", pkg.path("deco", "deco.go"), Options{})
+
+		Expect(err).To(MatchError(ContainSubstring("prefix is not exported and would be left behind")))
+	})
+
+	It("refuses target packages importing the package", func() {
+		pkg.writeFile("deco/deco.go", `package deco
+
+import _ "example.com/m"
+`)
+
+		_, err := Move(pkg.path("a.go"), "shout", pkg.path("deco", "shout.go"), Options{})
+
+		Expect(err).To(MatchError("Cannot move to example.com/m/deco, it would create an import cycle with example.com/m"))
+	})
+
+	It("refuses exported dependencies, which the target would have to import", func() {
+		pkg.writeFile("c.go", `package m
+
+var Suffix = "!"
+
+func decorated(s string) string {
+	return s + Suffix
+}
+`)
+
+		_, err := Move(pkg.path("c.go"), "decorated", pkg.path("deco", "deco.go"), Options{})
+
+		Expect(err).To(MatchError(ContainSubstring("Suffix is exported, but using it from example.com/m/deco would create an import cycle")))
+	})
+})
@@ -0,0 +1,288 @@
+package goextract
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strconv"
+	"strings"
+)
+
+// uniqueFunctionName returns name if it can be used for the function
+// extracted from selection, or a name with a number appended if
+// options.UniqueName is set. Otherwise all collisions are returned as error.
+// If name is empty, a name is suggested from the selected code.
+func uniqueFunctionName(checker *packageChecker, src string, selection Selection, name string, options Options) (string, error) {
+	if name == "" {
+		var err error
+		name, err = suggestedFunctionName(checker.filename, src, selection, options.ExportSuggestedName)
+		if err != nil {
+			return "", err
+		}
+		options.UniqueName = true
+	}
+	scopes, err := newNameScopes(checker, src, selection)
+	if err != nil {
+		return "", err
+	}
+	problems := scopes.collisionsOf(name)
+	if len(problems) == 0 || !options.UniqueName || !token.IsIdentifier(name) || name == "_" {
+		if len(problems) != 0 {
+			return "", &ValidationError{Problems: problems}
+		}
+		return name, nil
+	}
+	for i := 2; ; i++ {
+		candidate := name + strconv.Itoa(i)
+		if len(scopes.collisionsOf(candidate)) == 0 {
+			return candidate, nil
+		}
+	}
+}
+
+// nameScopes knows all names a new package level function could collide with.
+type nameScopes struct {
+	pkg      *types.Package
+	callSite *types.Scope
+	position token.Pos
+	params   map[string]bool
+	report   token.Position
+}
+
+func newNameScopes(checker *packageChecker, src string, selection Selection) (*nameScopes, error) {
+	checked := checker.check(src, 0)
+	fileSet, pkg, info := checked.fileSet, checked.pkg, checked.info
+
+	tokenFile := fileSet.File(checked.astFile.Pos())
+	for _, line := range []int{selection.Begin.Line, selection.End.Line} {
+		if line < 1 || line > tokenFile.LineCount() {
+			return nil, fmt.Errorf("Line %v is outside of the file", line)
+		}
+	}
+	begin := tokenFile.LineStart(selection.Begin.Line) + token.Pos(selection.Begin.Column-1)
+	end := tokenFile.LineStart(selection.End.Line) + token.Pos(selection.End.Column-1)
+	scopes := &nameScopes{
+		pkg:      pkg,
+		callSite: pkg.Scope().Innermost(begin),
+		position: begin,
+		params:   make(map[string]bool),
+		report:   fileSet.Position(begin),
+	}
+	if scopes.callSite == nil {
+		scopes.callSite = pkg.Scope()
+	}
+	// The parameters are the local variables used in, but declared before the selection.
+	for ident, object := range info.Uses {
+		if variable, isVar := object.(*types.Var); isVar && !variable.IsField() &&
+			ident.Pos() >= begin && ident.End() <= end &&
+			variable.Parent() != pkg.Scope() && (variable.Pos() < begin || variable.Pos() >= end) {
+			scopes.params[variable.Name()] = true
+		}
+	}
+	return scopes, nil
+}
+
+func (scopes *nameScopes) collisionsOf(name string) (problems []Problem) {
+	problem := func(format string, args ...interface{}) {
+		problems = append(problems, Problem{Rule: "name", Position: scopes.report, Message: fmt.Sprintf(format, args...)})
+	}
+	switch {
+	case token.IsKeyword(name):
+		problem("%v is a keyword", name)
+		return
+	case !token.IsIdentifier(name):
+		problem("%v is not a valid identifier", name)
+		return
+	case name == "_":
+		problem("Functions named _ cannot be called")
+		return
+	case name == "init" || (name == "main" && scopes.pkg.Name() == "main"):
+		problem("%v is a special function that cannot be called", name)
+		return
+	}
+	if scope, object := scopes.callSite.LookupParent(name, scopes.position); object != nil {
+		switch scope {
+		case types.Universe:
+			problem("%v is predeclared and would be shadowed in the whole package", name)
+		case scopes.pkg.Scope():
+			problem("%v is already declared in package %v", name, scopes.pkg.Name())
+		default:
+			problem("%v is declared locally as %v and would shadow the function at the call site", name, objectKind(object))
+		}
+	} else if scopes.pkg.Scope().Lookup(name) != nil {
+		problem("%v is already declared in package %v", name, scopes.pkg.Name())
+	}
+	for i := 0; i < scopes.pkg.Scope().NumChildren(); i++ {
+		fileScope := scopes.pkg.Scope().Child(i)
+		if pkgName, isPkgName := fileScope.Lookup(name).(*types.PkgName); isPkgName {
+			problem("%v is the name of an imported package", pkgName.Name())
+			break
+		}
+	}
+	for _, typeName := range scopes.pkg.Scope().Names() {
+		if named, isNamed := scopes.pkg.Scope().Lookup(typeName).Type().(*types.Named); isNamed {
+			if _, isTypeName := scopes.pkg.Scope().Lookup(typeName).(*types.TypeName); !isTypeName {
+				continue
+			}
+			for i := 0; i < named.NumMethods(); i++ {
+				if named.Method(i).Name() == name {
+					problem("%v is already a method of %v", name, typeName)
+				}
+			}
+		}
+	}
+	if scopes.params[name] {
+		problem("%v is also the name of a parameter of the extracted function", name)
+	}
+	return
+}
+
+func objectKind(object types.Object) string {
+	switch object.(type) {
+	case *types.Var:
+		return "variable"
+	case *types.Const:
+		return "constant"
+	case *types.TypeName:
+		return "type"
+	case *types.Func:
+		return "function"
+	case *types.Label:
+		return "label"
+	default:
+		return "identifier"
+	}
+}
+
+// uniqueNameInPackage makes sure name is not declared in the package in dir
+// yet, which receives the extracted function.
+func uniqueNameInPackage(dir string, importPath string, name string, options Options) (string, error) {
+	pkg, err := newSourceImporter(token.NewFileSet(), options.Overlay).ImportFrom(importPath, dir, 0)
+	if err != nil || pkg.Scope().Lookup(name) == nil {
+		return name, nil
+	}
+	if !options.UniqueName {
+		return "", fmt.Errorf("%v is already declared in package %v", name, importPath)
+	}
+	candidate := name
+	for i := 2; pkg.Scope().Lookup(candidate) != nil; i++ {
+		candidate = name + strconv.Itoa(i)
+	}
+	return candidate, nil
+}
+
+// suggestedFunctionName derives a function name from the selected code: from
+// the variables it computes for the code after it, from the condition it
+// tests, or from the function it calls most.
+func suggestedFunctionName(filename string, src string, selection Selection, exportedName bool) (string, error) {
+	fileSet := token.NewFileSet()
+	astFile, err := parser.ParseFile(fileSet, filename, src, 0)
+	if err != nil {
+		return "", err
+	}
+	context, err := matchSelection(fileSet, astFile, selection)
+	if err != nil {
+		return "", err
+	}
+	return nameSuggestedFor(context, exportedName), nil
+}
+
+func nameSuggestedFor(context *selectionContext, exportedName bool) string {
+	name := "extracted"
+	if words := computedVarNames(context); len(words) != 0 {
+		name = "compute" + strings.Join(words, "And")
+	} else if words := testedNames(context); len(words) != 0 {
+		name = "check" + strings.Join(words, "")
+	} else if callee := dominantCallee(context.nodes); callee != "" {
+		name = "do" + exported(callee)
+	}
+	if exportedName {
+		return exported(name)
+	}
+	return unexported(name)
+}
+
+func computedVarNames(context *selectionContext) (words []string) {
+	if context.expression != nil {
+		switch parent := context.parent.(type) {
+		case *ast.AssignStmt:
+			for i, rhs := range parent.Rhs {
+				if ident, isIdent := parent.Lhs[i].(*ast.Ident); isIdent && rhs == context.expression && ident.Name != "_" && len(parent.Lhs) == len(parent.Rhs) {
+					words = append(words, exported(ident.Name))
+				}
+			}
+		case *ast.ValueSpec:
+			for i, value := range parent.Values {
+				if value == context.expression && len(parent.Names) == len(parent.Values) && parent.Names[i].Name != "_" {
+					words = append(words, exported(parent.Names[i].Name))
+				}
+			}
+		}
+		return
+	}
+	allStmts := stmtsFromBlockStmt(context.parent)
+	indexOfExtractedStmt := indexOf(context.nodes[0].(ast.Stmt), *allStmts)
+	varsUsedAfterwards := overlappingVarsIdentsUsedIn((*allStmts)[indexOfExtractedStmt+len(context.nodes):], varIdentsDeclaredWithin(context.nodes))
+	for _, name := range sortedKeysFrom(varsUsedAfterwards) {
+		if name != "_" {
+			words = append(words, exported(name))
+		}
+	}
+	return
+}
+
+// testedNames returns the identifiers of the condition if the selection is
+// a single if statement or the condition of one.
+func testedNames(context *selectionContext) (words []string) {
+	var condition ast.Expr
+	if ifStmt, isIfStmt := context.parent.(*ast.IfStmt); isIfStmt && context.expression == ifStmt.Cond {
+		condition = ifStmt.Cond
+	} else if ifStmt, isIfStmt := context.nodes[0].(*ast.IfStmt); isIfStmt && len(context.nodes) == 1 {
+		condition = ifStmt.Cond
+	} else {
+		return
+	}
+	ast.Inspect(condition, func(node ast.Node) bool {
+		if ident, isIdent := node.(*ast.Ident); isIdent && len(words) < 2 && ident.Name != "nil" && ident.Name != "true" && ident.Name != "false" {
+			words = append(words, exported(ident.Name))
+		}
+		return true
+	})
+	return
+}
+
+// dominantCallee returns the name of the function called most often in
+// nodes, or the first of them if several are called equally often.
+func dominantCallee(nodes []ast.Node) string {
+	counts := make(map[string]int)
+	var callees []string
+	for _, node := range nodes {
+		ast.Inspect(node, func(node ast.Node) bool {
+			if call, isCall := node.(*ast.CallExpr); isCall {
+				var name string
+				switch fun := call.Fun.(type) {
+				case *ast.Ident:
+					name = fun.Name
+				case *ast.SelectorExpr:
+					name = fun.Sel.Name
+				}
+				if name != "" {
+					if counts[name] == 0 {
+						callees = append(callees, name)
+					}
+					counts[name]++
+				}
+			}
+			return true
+		})
+	}
+	dominant := ""
+	for _, callee := range callees {
+		if counts[callee] > counts[dominant] {
+			dominant = callee
+		}
+	}
+	return dominant
+}
@@ -0,0 +1,118 @@
+package goextract_test
+
+import (
+	. "github.com/petergtz/goextract"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Name collisions", func() {
+	const src = `package p
+
+import "strings"
+
+type t struct{}
+
+func (t) join() {}
+
+func g() {}
+
+func f(s string, n int) {
+	x := n + 1
+	y := x * 2
+	_ = strings.Repeat(s, y)
+}
+`
+	selection := Selection{Position{12, 2}, Position{13, 12}}
+
+	extract := func(name string, unique bool) (string, error) {
+		result, _, err := ExtractStringToString(src, selection, name, Options{UniqueName: unique})
+		return result, err
+	}
+
+	for name, message := range map[string]string{
+		"1st":     "1st is not a valid identifier",
+		"range":   "range is a keyword",
+		"_":       "Functions named _ cannot be called",
+		"init":    "init is a special function that cannot be called",
+		"len":     "len is predeclared",
+		"g":       "g is already declared in package p",
+		"strings": "strings is the name of an imported package",
+		"join":    "join is already a method of t",
+		"s":       "s is declared locally as variable",
+		"n":       "n is also the name of a parameter of the extracted function",
+	} {
+		name, message := name, message
+		It("refuses "+name, func() {
+			_, err := extract(name, false)
+
+			Expect(err).To(MatchError(ContainSubstring(message)))
+		})
+	}
+
+	It("picks a unique variant on request", func() {
+		output, err := extract("g", true)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(output).To(ContainSubstring("func g2(n int) int {"))
+	})
+
+	It("still refuses invalid names on request of a unique variant", func() {
+		_, err := extract("range", true)
+
+		Expect(err).To(MatchError(ContainSubstring("range is a keyword")))
+	})
+
+	It("refuses selections past the end of the file", func() {
+		for _, name := range []string{"h", ""} {
+			_, _, err := ExtractStringToString(src, Selection{Position{99, 1}, Position{99, 5}}, name, Options{})
+
+			Expect(err).To(HaveOccurred())
+		}
+	})
+})
+
+var _ = Describe("Name suggestions", func() {
+	const src = `package p
+
+import "fmt"
+
+func computeTotal() {}
+
+func f(prices []int, limit int) {
+	total := 0
+	for _, price := range prices {
+		total += price
+	}
+	if total > limit {
+		fmt.Println("too much")
+	}
+	fmt.Println(total)
+	fmt.Println(limit)
+	fmt.Print(limit)
+}
+`
+
+	suggest := func(selection Selection, options Options) string {
+		result, err := ExtractSource("", src, selection, "", options)
+		Expect(err).NotTo(HaveOccurred())
+		return result.Function.Name
+	}
+
+	It("names the function after the variables it computes, unique in the package", func() {
+		Expect(suggest(Selection{Position{8, 2}, Position{11, 3}}, Options{})).To(Equal("computeTotal2"))
+	})
+
+	It("names the function after the condition it tests", func() {
+		Expect(suggest(Selection{Position{12, 2}, Position{14, 3}}, Options{})).To(Equal("checkTotalLimit"))
+	})
+
+	It("names the function after the function it calls most", func() {
+		Expect(suggest(Selection{Position{16, 2}, Position{17, 18}}, Options{})).To(Equal("doPrintln"))
+	})
+
+	It("suggests exported names on request", func() {
+		Expect(suggest(Selection{Position{16, 2}, Position{17, 18}}, Options{ExportSuggestedName: true})).To(Equal("DoPrintln"))
+	})
+})
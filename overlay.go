@@ -0,0 +1,158 @@
+package goextract
+
+import (
+	"bufio"
+	"fmt"
+	"go/build"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/petergtz/goextract/util"
+)
+
+// Overlay maps absolute filenames to contents that replace the contents on
+// disk, e.g. for unsaved editor buffers.
+type Overlay map[string]string
+
+// ParseOverlay reads an archive of modified files in the format used by guru
+// and gopls: for every file its name and its size in bytes, each on a line of
+// its own, followed by its content.
+func ParseOverlay(r io.Reader) (Overlay, error) {
+	overlay := make(Overlay)
+	reader := bufio.NewReader(r)
+	for {
+		filename, err := reader.ReadString('\n')
+		if err == io.EOF && filename == "" {
+			return overlay, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Reading modified file name: %v", err)
+		}
+		filename = strings.TrimSuffix(filename, "\n")
+		sizeLine, err := reader.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("Reading size of modified file %v: %v", filename, err)
+		}
+		size, err := strconv.Atoi(strings.TrimSuffix(sizeLine, "\n"))
+		if err != nil || size < 0 {
+			return nil, fmt.Errorf("Invalid size of modified file %v: %q", filename, strings.TrimSuffix(sizeLine, "\n"))
+		}
+		content := make([]byte, size)
+		if _, err := io.ReadFull(reader, content); err != nil {
+			return nil, fmt.Errorf("Reading content of modified file %v: %v", filename, err)
+		}
+		overlay[absPath(filename)] = string(content)
+	}
+}
+
+func absPath(filename string) string {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return filepath.Clean(filename)
+	}
+	return abs
+}
+
+func (overlay Overlay) contentOf(filename string) (string, bool) {
+	content, found := overlay[absPath(filename)]
+	return content, found
+}
+
+// with returns a copy of overlay that also contains the modified contents of changes.
+func (overlay Overlay) with(changes []FileChange) Overlay {
+	result := make(Overlay)
+	for filename, content := range overlay {
+		result[filename] = content
+	}
+	for _, change := range changes {
+		result[absPath(change.Filename)] = change.Modified
+	}
+	return result
+}
+
+// ReadFile returns the content of filename in overlay, or else on disk.
+func (overlay Overlay) ReadFile(filename string) string {
+	if content, found := overlay.contentOf(filename); found {
+		return content
+	}
+	return util.ReadFileAsStringOrPanic(filename)
+}
+
+// readFile is like ReadFile, but returns errors like ioutil.ReadFile.
+func (overlay Overlay) readFile(filename string) ([]byte, error) {
+	if content, found := overlay.contentOf(filename); found {
+		return []byte(content), nil
+	}
+	return ioutil.ReadFile(filename)
+}
+
+func (overlay Overlay) openFile(filename string) (io.ReadCloser, error) {
+	if content, found := overlay.contentOf(filename); found {
+		return ioutil.NopCloser(strings.NewReader(content)), nil
+	}
+	return os.Open(filename)
+}
+
+// readDir lists dir like ioutil.ReadDir, including files that only exist in
+// the overlay and with the sizes of their overlaid contents.
+func (overlay Overlay) readDir(dir string) ([]os.FileInfo, error) {
+	fileInfos, err := ioutil.ReadDir(dir)
+	if err != nil && !(os.IsNotExist(err) && overlay.hasFilesIn(dir)) {
+		return nil, err
+	}
+	listed := make(map[string]bool)
+	for i, fileInfo := range fileInfos {
+		listed[fileInfo.Name()] = true
+		if content, found := overlay.contentOf(filepath.Join(dir, fileInfo.Name())); found && !fileInfo.IsDir() {
+			fileInfos[i] = overlayFileInfo{name: fileInfo.Name(), size: len(content)}
+		}
+	}
+	absDir := absPath(dir)
+	for filename, content := range overlay {
+		if filepath.Dir(filename) == absDir && !listed[filepath.Base(filename)] {
+			fileInfos = append(fileInfos, overlayFileInfo{name: filepath.Base(filename), size: len(content)})
+		}
+	}
+	return fileInfos, nil
+}
+
+func (overlay Overlay) isDir(dir string) bool {
+	fileInfo, err := os.Stat(dir)
+	return (err == nil && fileInfo.IsDir()) || overlay.hasFilesIn(dir)
+}
+
+func (overlay Overlay) hasFilesIn(dir string) bool {
+	absDir := absPath(dir)
+	for filename := range overlay {
+		if filepath.Dir(filename) == absDir {
+			return true
+		}
+	}
+	return false
+}
+
+// buildContext returns build.Default with all reads going through the overlay.
+func (overlay Overlay) buildContext() *build.Context {
+	context := build.Default
+	context.OpenFile = overlay.openFile
+	context.ReadDir = overlay.readDir
+	context.IsDir = overlay.isDir
+	return &context
+}
+
+type overlayFileInfo struct {
+	name string
+	size int
+}
+
+func (fileInfo overlayFileInfo) Name() string       { return fileInfo.name }
+func (fileInfo overlayFileInfo) Size() int64        { return int64(fileInfo.size) }
+func (fileInfo overlayFileInfo) Mode() os.FileMode  { return 0644 }
+func (fileInfo overlayFileInfo) ModTime() time.Time { return time.Time{} }
+func (fileInfo overlayFileInfo) IsDir() bool        { return false }
+func (fileInfo overlayFileInfo) Sys() interface{}   { return nil }
@@ -0,0 +1,76 @@
+package goextract_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/petergtz/goextract"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Overlay", func() {
+	It("is read from an archive of filename, size and content", func() {
+		overlay, err := ParseOverlay(strings.NewReader("/a.go\n10\npackage a\n/dir/b.go\n0\n"))
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(overlay).To(Equal(Overlay{filepath.FromSlash("/a.go"): "package a\n", filepath.FromSlash("/dir/b.go"): ""}))
+	})
+
+	It("rejects truncated archives", func() {
+		_, err := ParseOverlay(strings.NewReader("/a.go\n100\npackage a\n"))
+
+		Expect(err).To(MatchError(ContainSubstring("Reading content of modified file")))
+	})
+
+	Context("with files on disk", func() {
+		var dir string
+
+		BeforeEach(func() {
+			var err error
+			dir, err = ioutil.TempDir("", "goextract-overlay")
+			Expect(err).NotTo(HaveOccurred())
+			Expect(ioutil.WriteFile(filepath.Join(dir, "a.go"), []byte("package p\n"), 0644)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(dir)
+		})
+
+		It("replaces the input file", func() {
+			overlay := Overlay{filepath.Join(dir, "a.go"): "package p\n\nfunc f() {\n\tg()\n}\n\nfunc g() {}\n"}
+
+			result, err := ExtractFile(filepath.Join(dir, "a.go"), Selection{Position{4, 2}, Position{4, 5}}, "h", Options{Overlay: overlay})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Changes[0].Modified).To(Equal("package p\n\nfunc f() {\n\th()\n}\n\nfunc g() {}\n\nfunc h() {\n\tg()\n}\n"))
+		})
+
+		It("provides siblings for the type check", func() {
+			overlay := Overlay{
+				filepath.Join(dir, "a.go"): "package p\n\nfunc f() {\n\tg()\n}\n\nfunc g() {}\n",
+				filepath.Join(dir, "b.go"): "package p\n\nfunc h() {}\n",
+			}
+
+			_, err := ExtractFile(filepath.Join(dir, "a.go"), Selection{Position{4, 2}, Position{4, 5}}, "h", Options{Overlay: overlay})
+
+			Expect(err).To(MatchError(ContainSubstring("h is already declared in package p")))
+		})
+
+		It("provides the go.mod of the module", func() {
+			overlay := Overlay{
+				filepath.Join(dir, "go.mod"): "module example.com/m\n",
+				filepath.Join(dir, "a.go"):   "package p\n\nfunc f() {\n\tprintln(1)\n}\n",
+			}
+
+			result, err := ExtractFile(filepath.Join(dir, "a.go"), Selection{Position{4, 2}, Position{4, 12}}, "h",
+				Options{Overlay: overlay, Placement: PlaceInFile, PlacementFile: filepath.Join(dir, "q", "q.go")})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result.Changes[0].Modified).To(ContainSubstring(`import "example.com/m/q"`))
+		})
+	})
+})
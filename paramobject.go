@@ -0,0 +1,209 @@
+package goextract
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strconv"
+	"strings"
+
+	"github.com/petergtz/goextract/util"
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// IntroduceParamObject bundles the parameters of the function funcName,
+// declared in filename, into a new struct type typeName. The type is declared
+// before the function, the function gets a single parameter of it and all
+// calls in the package construct it. Methods are given as Type.Method. If
+// typeName is empty, it is funcName followed by Params. Exported functions
+// and methods outside of main packages and methods required by interfaces
+// are refused. The first change is the one of filename.
+func IntroduceParamObject(filename string, funcName string, typeName string, options Options) (*Result, error) {
+	refactoring, err := paramObjectRefactoring(filename, options.Overlay.ReadFile(filename), funcName, typeName, options.Overlay)
+	if err != nil {
+		return &Result{}, err
+	}
+	funcDecl := funcOrMethodDeclNamed(refactoring.astFile, funcName)
+	refactoring.checkOnlyUsedInPackage(funcDecl)
+	refactoring.checkNotRequiredByInterface(funcDecl)
+	return refactoring.result(options)
+}
+
+// introduceParamObject returns the changes of IntroduceParamObject for the
+// content src of filename, without checking them.
+func introduceParamObject(filename string, src string, funcName string, typeName string, overlay Overlay) ([]FileChange, error) {
+	refactoring, err := paramObjectRefactoring(filename, src, funcName, typeName, overlay)
+	if err != nil {
+		return nil, err
+	}
+	if len(refactoring.problems) != 0 {
+		return nil, &ValidationError{Problems: refactoring.problems}
+	}
+	return refactoring.changes(), nil
+}
+
+func paramObjectRefactoring(filename string, src string, funcName string, typeName string, overlay Overlay) (*packageRefactoring, error) {
+	refactoring, err := newPackageRefactoringOf(filename, src, overlay, "param-object")
+	if err != nil {
+		return nil, err
+	}
+	info, pkg := refactoring.info, refactoring.pkg
+	funcDecl := funcOrMethodDeclNamed(refactoring.astFile, funcName)
+	if funcDecl == nil {
+		return nil, fmt.Errorf("There is no function %v in %v", funcName, filename)
+	}
+	if typeName == "" {
+		typeName = funcDecl.Name.Name + "Params"
+		for i := 2; pkg.Scope().Lookup(typeName) != nil; i++ {
+			typeName = funcDecl.Name.Name + "Params" + strconv.Itoa(i)
+		}
+	} else if pkg.Scope().Lookup(typeName) != nil {
+		return nil, fmt.Errorf("%v is already declared in package %v", typeName, pkg.Name())
+	}
+
+	params := make(map[types.Object]string)
+	var fieldLines []string
+	for _, field := range funcDecl.Type.Params.List {
+		if _, isEllipsis := field.Type.(*ast.Ellipsis); isEllipsis {
+			return nil, fmt.Errorf("The variadic parameter of %v cannot be moved into a struct", funcName)
+		}
+		var names []string
+		for _, name := range field.Names {
+			if name.Name == "_" {
+				return nil, fmt.Errorf("The parameters of %v must be named", funcName)
+			}
+			params[info.Defs[name]] = name.Name
+			names = append(names, name.Name)
+		}
+		if len(names) == 0 {
+			return nil, fmt.Errorf("The parameters of %v must be named", funcName)
+		}
+		fieldLines = append(fieldLines, strings.Join(names, ", ")+" "+refactoring.originalText(field.Type))
+	}
+	if len(params) == 0 {
+		return nil, fmt.Errorf("%v has no parameters", funcName)
+	}
+	paramObject := paramObjectNameFor(funcDecl, info, params)
+
+	typeDecl := "type " + typeName + " struct {\n" + strings.Join(fieldLines, "\n") + "\n}\n\n"
+	refactoring.edit(declPos(funcDecl), declPos(funcDecl), func() string { return typeDecl })
+	refactoring.edit(funcDecl.Type.Params.Opening+1, funcDecl.Type.Params.Closing, func() string { return paramObject + " " + typeName })
+	if funcDecl.Body != nil {
+		ast.Inspect(funcDecl.Body, func(node ast.Node) bool {
+			if ident, isIdent := node.(*ast.Ident); isIdent {
+				if name, isParam := params[info.Uses[ident]]; isParam {
+					refactoring.edit(ident.Pos(), ident.End(), func() string { return paramObject + "." + name })
+				}
+			}
+			return true
+		})
+	}
+
+	funcObject := info.Defs[funcDecl.Name]
+	for _, file := range refactoring.files {
+		called := make(map[*ast.Ident]bool)
+		ast.Inspect(file, func(node ast.Node) bool {
+			call, isCall := node.(*ast.CallExpr)
+			if !isCall {
+				return true
+			}
+			var ident *ast.Ident
+			var selection *types.Selection
+			switch fun := astutil.Unparen(call.Fun).(type) {
+			case *ast.Ident:
+				ident = fun
+			case *ast.SelectorExpr:
+				ident, selection = fun.Sel, info.Selections[fun]
+			}
+			if ident == nil || info.Uses[ident] != funcObject {
+				return true
+			}
+			called[ident] = true
+			if selection != nil && selection.Kind() == types.MethodExpr {
+				refactoring.problem(call.Pos(), "Method expressions of %v are not supported", funcName)
+				return true
+			}
+			if call.Ellipsis.IsValid() || len(call.Args) != len(params) {
+				refactoring.problem(call.Pos(), "The arguments of the call cannot be assigned to fields")
+				return true
+			}
+			refactoring.edit(call.Lparen+1, call.Rparen, func() string {
+				var elements []string
+				i := 0
+				for _, field := range funcDecl.Type.Params.List {
+					for _, name := range field.Names {
+						elements = append(elements, name.Name+": "+refactoring.nodeText(call.Args[i]))
+						i++
+					}
+				}
+				return typeName + "{" + strings.Join(elements, ", ") + "}"
+			})
+			return true
+		})
+		ast.Inspect(file, func(node ast.Node) bool {
+			if ident, isIdent := node.(*ast.Ident); isIdent && info.Uses[ident] == funcObject && !called[ident] {
+				refactoring.problem(ident.Pos(), "%v is used as value, not called", funcName)
+			}
+			return true
+		})
+	}
+	return refactoring, nil
+}
+
+// numParamsOf returns the number of parameters of the function funcName in src.
+func numParamsOf(src string, funcName string) int {
+	astFile, err := parser.ParseFile(token.NewFileSet(), "", src, 0)
+	util.PanicOnError(err)
+	return funcOrMethodDeclNamed(astFile, funcName).Type.Params.NumFields()
+}
+
+// funcOrMethodDeclNamed finds the function name, or the method given as Type.Method.
+func funcOrMethodDeclNamed(astFile *ast.File, name string) *ast.FuncDecl {
+	for _, decl := range astFile.Decls {
+		if funcDecl, isFuncDecl := decl.(*ast.FuncDecl); isFuncDecl && qualifiedNameOf(funcDecl) == name {
+			return funcDecl
+		}
+	}
+	return nil
+}
+
+// qualifiedNameOf returns the name of funcDecl, as Type.Method for methods.
+func qualifiedNameOf(funcDecl *ast.FuncDecl) string {
+	if funcDecl.Recv == nil || len(funcDecl.Recv.List) != 1 {
+		return funcDecl.Name.Name
+	}
+	recvType := funcDecl.Recv.List[0].Type
+	if star, isStar := recvType.(*ast.StarExpr); isStar {
+		recvType = star.X
+	}
+	if ident, isIdent := recvType.(*ast.Ident); isIdent {
+		return ident.Name + "." + funcDecl.Name.Name
+	}
+	return funcDecl.Name.Name
+}
+
+// paramObjectNameFor returns p, or another name if p is already used in
+// funcDecl for something other than its parameters.
+func paramObjectNameFor(funcDecl *ast.FuncDecl, info *types.Info, params map[types.Object]string) string {
+	used := make(map[string]bool)
+	ast.Inspect(funcDecl, func(node ast.Node) bool {
+		if ident, isIdent := node.(*ast.Ident); isIdent {
+			if _, isParam := params[info.ObjectOf(ident)]; !isParam {
+				used[ident.Name] = true
+			}
+		}
+		return true
+	})
+	for _, name := range []string{"p", "params"} {
+		if !used[name] {
+			return name
+		}
+	}
+	for i := 2; ; i++ {
+		if name := "params" + strconv.Itoa(i); !used[name] {
+			return name
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package goextract_test
+
+import (
+	. "github.com/petergtz/goextract"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Parameter objects", func() {
+	pkg := newTempPackage("goextract-paramobject", map[string]string{
+		"a.go": `package p
+
+// area computes the area of a rectangle.
+func area(width, height int, unit string) string {
+	width++
+	return fmt(width*height, unit)
+}
+
+func fmt(value int, unit string) string { return unit }
+`,
+		"b.go": `package p
+
+func g() string {
+	return area(1, 2, "m")
+}
+`,
+	})
+
+	It("bundles the parameters into a struct and constructs it at every call", func() {
+		result, err := IntroduceParamObject(pkg.path("a.go"), "area", "", Options{})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Changes).To(HaveLen(2))
+		Expect(result.Changes[0].Modified).To(Equal(`package p
+
+type areaParams struct {
+	width, height int
+	unit          string
+}
+
+// area computes the area of a rectangle.
+func area(p areaParams) string {
+	p.width++
+	return fmt(p.width*p.height, p.unit)
+}
+
+func fmt(value int, unit string) string { return unit }
+`))
+		Expect(result.Changes[1].Filename).To(Equal(pkg.path("b.go")))
+		Expect(result.Changes[1].Modified).To(ContainSubstring(`return area(areaParams{width: 1, height: 2, unit: "m"})`))
+	})
+
+	It("refuses type names already declared", func() {
+		_, err := IntroduceParamObject(pkg.path("a.go"), "area", "g", Options{})
+
+		Expect(err).To(MatchError("g is already declared in package p"))
+	})
+
+	It("refuses methods whose signature an interface requires", func() {
+		pkg.writeFile("c.go", `package p
+
+type scaler interface {
+	scale(factor, offset int) int
+}
+
+type rect struct{ size int }
+
+func (r rect) scale(factor, offset int) int { return r.size*factor + offset }
+`)
+
+		_, err := IntroduceParamObject(pkg.path("c.go"), "rect.scale", "", Options{})
+
+		Expect(err).To(MatchError(ContainSubstring("rect implements scaler, which requires the signature of scale")))
+	})
+
+	It("refuses exported functions, whose uses in other packages would break", func() {
+		pkg.writeFile("c.go", `package p
+
+func Volume(width, height, depth int) int { return width * height * depth }
+`)
+
+		_, err := IntroduceParamObject(pkg.path("c.go"), "Volume", "", Options{})
+
+		Expect(err).To(MatchError(ContainSubstring("Volume is exported, so its uses in other packages could not be updated")))
+	})
+
+	It("rewrites nested calls", func() {
+		pkg.writeFile("c.go", `package p
+
+func sum(a, b int) int { return a + b }
+
+func h() int {
+	return sum(sum(1, 2), 3)
+}
+`)
+
+		result, err := IntroduceParamObject(pkg.path("c.go"), "sum", "", Options{})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Changes[0].Modified).To(ContainSubstring(`return sum(sumParams{a: sum(sumParams{a: 1, b: 2}), b: 3})`))
+	})
+
+	It("rewrites parenthesized calls", func() {
+		pkg.writeFile("c.go", `package p
+
+func sum(a, b int) int { return a + b }
+
+func h() int {
+	return (sum)(1, 2)
+}
+`)
+
+		result, err := IntroduceParamObject(pkg.path("c.go"), "sum", "", Options{})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Changes[0].Modified).To(ContainSubstring(`return (sum)(sumParams{a: 1, b: 2})`))
+	})
+
+	It("refuses method expressions", func() {
+		pkg.writeFile("c.go", `package p
+
+type rect struct{ size int }
+
+func (r rect) scale(factor, offset int) int { return r.size*factor + offset }
+
+func h() int {
+	return rect.scale(rect{}, 2, 3)
+}
+`)
+
+		_, err := IntroduceParamObject(pkg.path("c.go"), "rect.scale", "", Options{})
+
+		Expect(err).To(MatchError(ContainSubstring("Method expressions of rect.scale are not supported")))
+	})
+
+	It("bundles the parameters of extracted functions with too many of them", func() {
+		output, _, err := ExtractStringToString(`package p
+
+func f(a, b, c int) {
+	println(a + b)
+	println(c)
+}
+`, Selection{Position{4, 2}, Position{5, 12}}, "g", Options{ParamObjectThreshold: 2})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(output).To(Equal(`package p
+
+func f(a, b, c int) {
+	g(gParams{a: a, b: b, c: c})
+}
+
+type gParams struct {
+	a, b, c int
+}
+
+func g(p gParams) {
+	println(p.a + p.b)
+	println(p.c)
+}
+`))
+	})
+})
@@ -0,0 +1,151 @@
+package goextract
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"sort"
+
+	"github.com/petergtz/goextract/util"
+)
+
+// ParamOrder determines the order of the parameters of the extracted function.
+type ParamOrder int
+
+const (
+	ParamOrderAlphabetical ParamOrder = iota
+	// ParamOrderFirstUse orders the parameters by their first use in the selection.
+	ParamOrderFirstUse
+	// ParamOrderDeclaration orders the parameters like the declarations of
+	// the variables they are passed in the enclosing function.
+	ParamOrderDeclaration
+)
+
+type param struct {
+	name     string
+	typ      ast.Expr
+	typeName string
+	firstUse token.Pos
+	declPos  token.Pos
+	arg      ast.Expr
+}
+
+// arrangeParams orders the parameters of the extracted function funcName in
+// src and the arguments of its call accordingly. The conventional leading
+// parameters *testing.T and context.Context always come first. Consecutive
+// parameters of the same type are grouped like in "a, b int". If the
+// parameters cannot be matched with the arguments, they stay as they are and
+// the result is a warning.
+func arrangeParams(filename string, src string, funcName string, order ParamOrder) (string, []Problem) {
+	fileSet := token.NewFileSet()
+	astFile, err := parser.ParseFile(fileSet, filename, src, parser.ParseComments)
+	util.PanicOnError(err)
+	funcDecl := funcDeclNamed(astFile, funcName)
+	if funcDecl.Type.Params.NumFields() < 2 {
+		return src, nil
+	}
+	call := callOf(astFile, funcDecl, funcName)
+	if call == nil {
+		return src, nil
+	}
+	if call.Ellipsis.IsValid() || len(call.Args) != funcDecl.Type.Params.NumFields() {
+		return src, []Problem{{
+			Rule:     "params",
+			Position: fileSet.Position(call.Pos()),
+			Message:  fmt.Sprintf("The parameters of %v are not ordered, because they cannot be matched with the arguments of its call", funcName),
+		}}
+	}
+
+	var params []*param
+	for _, field := range funcDecl.Type.Params.List {
+		for _, name := range field.Names {
+			arg := call.Args[len(params)]
+			params = append(params, &param{
+				name:     name.Name,
+				typ:      field.Type,
+				typeName: nodeString(fileSet, field.Type),
+				firstUse: firstUseOf(funcDecl.Body, field),
+				declPos:  declPosOf(arg),
+				arg:      arg,
+			})
+		}
+	}
+	sort.SliceStable(params, func(i, j int) bool {
+		switch order {
+		case ParamOrderFirstUse:
+			return params[i].firstUse < params[j].firstUse
+		case ParamOrderDeclaration:
+			return params[i].declPos < params[j].declPos
+		default:
+			return params[i].name < params[j].name
+		}
+	})
+	sort.SliceStable(params, func(i, j int) bool {
+		return conventionalRank(params[i].typeName) < conventionalRank(params[j].typeName)
+	})
+
+	var fields []*ast.Field
+	call.Args = nil
+	for i, param := range params {
+		if i > 0 && params[i-1].typeName == param.typeName {
+			fields[len(fields)-1].Names = append(fields[len(fields)-1].Names, ast.NewIdent(param.name))
+		} else {
+			fields = append(fields, &ast.Field{Names: []*ast.Ident{ast.NewIdent(param.name)}, Type: param.typ})
+		}
+		call.Args = append(call.Args, param.arg)
+	}
+	funcDecl.Type.Params.List = fields
+	return nodeSource(fileSet, astFile), nil
+}
+
+// callOf finds the call of funcName outside of its declaration funcDecl.
+func callOf(astFile *ast.File, funcDecl *ast.FuncDecl, funcName string) (call *ast.CallExpr) {
+	ast.Inspect(astFile, func(node ast.Node) bool {
+		if node == funcDecl || call != nil {
+			return false
+		}
+		if callExpr, isCall := node.(*ast.CallExpr); isCall {
+			if ident, isIdent := callExpr.Fun.(*ast.Ident); isIdent && ident.Name == funcName {
+				call = callExpr
+				return false
+			}
+		}
+		return true
+	})
+	return
+}
+
+func firstUseOf(body *ast.BlockStmt, field *ast.Field) (pos token.Pos) {
+	ast.Inspect(body, func(node ast.Node) bool {
+		if ident, isIdent := node.(*ast.Ident); isIdent && pos == token.NoPos &&
+			ident.Obj != nil && ident.Obj.Decl == field {
+			pos = ident.Pos()
+		}
+		return pos == token.NoPos
+	})
+	return
+}
+
+// declPosOf returns the position of the declaration of the first variable
+// used in arg.
+func declPosOf(arg ast.Expr) (pos token.Pos) {
+	ast.Inspect(arg, func(node ast.Node) bool {
+		if ident, isIdent := node.(*ast.Ident); isIdent && pos == token.NoPos && ident.Obj != nil {
+			pos = ident.Obj.Pos()
+		}
+		return pos == token.NoPos
+	})
+	return
+}
+
+func conventionalRank(typeName string) int {
+	switch typeName {
+	case "*testing.T", "*testing.B", "testing.TB":
+		return 0
+	case "context.Context":
+		return 1
+	default:
+		return 2
+	}
+}
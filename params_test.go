@@ -0,0 +1,64 @@
+package goextract_test
+
+import (
+	. "github.com/petergtz/goextract"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Parameter order", func() {
+	const src = `package p
+
+import (
+	"context"
+	"testing"
+)
+
+func use(ctx context.Context, t *testing.T) {}
+
+func f(t *testing.T, ctx context.Context) {
+	b := 1
+	a := 2
+	c := "x"
+	println(b, c, a)
+	use(ctx, t)
+}
+`
+
+	extract := func(order ParamOrder) string {
+		output, _, err := ExtractStringToString(src, Selection{Position{14, 2}, Position{15, 13}}, "g", Options{ParamOrder: order})
+		Expect(err).NotTo(HaveOccurred())
+		return output
+	}
+
+	It("orders alphabetically after the conventional leading parameters and groups equal types", func() {
+		output := extract(ParamOrderAlphabetical)
+
+		Expect(output).To(ContainSubstring("\tg(t, ctx, a, b, c)\n"))
+		Expect(output).To(ContainSubstring("func g(t *testing.T, ctx context.Context, a, b int, c string) {"))
+	})
+
+	It("orders by first use in the selection", func() {
+		output := extract(ParamOrderFirstUse)
+
+		Expect(output).To(ContainSubstring("\tg(t, ctx, b, c, a)\n"))
+		Expect(output).To(ContainSubstring("func g(t *testing.T, ctx context.Context, b int, c string, a int) {"))
+	})
+
+	It("orders by declaration in the enclosing function", func() {
+		output := extract(ParamOrderDeclaration)
+
+		Expect(output).To(ContainSubstring("\tg(t, ctx, b, a, c)\n"))
+		Expect(output).To(ContainSubstring("func g(t *testing.T, ctx context.Context, b, a int, c string) {"))
+	})
+
+	It("orders the parameters of a function placed before the enclosing one", func() {
+		output, warnings, err := ExtractStringToString(src, Selection{Position{14, 2}, Position{15, 13}}, "g", Options{Placement: PlaceBeforeEnclosingDecl})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(warnings).To(BeEmpty())
+		Expect(output).To(ContainSubstring("func g(t *testing.T, ctx context.Context, a, b int, c string) {"))
+		Expect(output).To(ContainSubstring("\tg(t, ctx, a, b, c)\n"))
+	})
+})
@@ -0,0 +1,243 @@
+package goextract
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/petergtz/goextract/util"
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// Placement determines where the extracted function is declared.
+type Placement int
+
+const (
+	PlaceAtEndOfFile Placement = iota
+	PlaceAfterEnclosingDecl
+	PlaceBeforeEnclosingDecl
+	// PlaceInFile declares the function in Options.PlacementFile. If that
+	// file is in another directory, the function is exported and called
+	// through an import of its package.
+	PlaceInFile
+)
+
+// enclosingDeclIndex returns the index of the top level declaration containing
+// the selection, or -1.
+func enclosingDeclIndex(fileSet *token.FileSet, astFile *ast.File, selection Selection) int {
+	for i, decl := range astFile.Decls {
+		begin, end := fileSet.Position(decl.Pos()), fileSet.Position(decl.End())
+		if !selection.Begin.isBefore(Position{begin.Line, begin.Column}) &&
+			!(Position{end.Line, end.Column}).isBefore(selection.End) {
+			return i
+		}
+	}
+	return -1
+}
+
+// place moves the extracted function, which the extraction appends to the end
+// of the file, to where options asks for. src must be gofmt-ed. The first
+// change is always the one of inputFileName, the last one declares the
+// function under the returned name.
+func place(inputFileName string, original string, src string, selection Selection, enclosingDecl int, funcName string, options Options) ([]FileChange, string, error) {
+	if options.Placement == PlaceAtEndOfFile {
+		return []FileChange{{Filename: inputFileName, Original: original, Modified: src}}, funcName, nil
+	}
+	fileSet := token.NewFileSet()
+	astFile, err := parser.ParseFile(fileSet, inputFileName, src, parser.ParseComments)
+	util.PanicOnError(err)
+	funcDecl, isFuncDecl := astFile.Decls[len(astFile.Decls)-1].(*ast.FuncDecl)
+	if !isFuncDecl || funcDecl.Name.Name != funcName || enclosingDecl < 0 || enclosingDecl >= len(astFile.Decls)-1 {
+		panic("Unexpected: extracted function " + funcName + " is not the last declaration")
+	}
+	funcBegin := lineBeginOf(src, fileSet.Position(declPos(funcDecl)).Offset)
+	funcEnd := fileSet.Position(funcDecl.End()).Offset
+	funcText := src[funcBegin:funcEnd]
+	withoutFunc := strings.TrimRight(src[:funcBegin], "\n") + "\n" + strings.TrimLeft(src[funcEnd:], "\n")
+
+	var modified string
+	switch options.Placement {
+	case PlaceAfterEnclosingDecl:
+		insertAt := lineEndOf(withoutFunc, fileSet.Position(astFile.Decls[enclosingDecl].End()).Offset)
+		modified = withoutFunc[:insertAt] + "\n" + funcText + "\n" + withoutFunc[insertAt:]
+	case PlaceBeforeEnclosingDecl:
+		insertAt := lineBeginOf(withoutFunc, fileSet.Position(declPos(astFile.Decls[enclosingDecl])).Offset)
+		modified = withoutFunc[:insertAt] + funcText + "\n\n" + withoutFunc[insertAt:]
+	case PlaceInFile:
+		return placeInFile(inputFileName, original, src, withoutFunc, funcDecl, funcText, selection, options)
+	default:
+		panic(fmt.Sprintf("Unexpected placement %v", options.Placement))
+	}
+	formatted, err := format.Source([]byte(modified))
+	util.PanicOnError(err)
+	return []FileChange{{Filename: inputFileName, Original: original, Modified: string(formatted)}}, funcName, nil
+}
+
+// declPos is the position of decl including its doc comment.
+func declPos(decl ast.Decl) token.Pos {
+	switch typedDecl := decl.(type) {
+	case *ast.FuncDecl:
+		if typedDecl.Doc != nil {
+			return typedDecl.Doc.Pos()
+		}
+	case *ast.GenDecl:
+		if typedDecl.Doc != nil {
+			return typedDecl.Doc.Pos()
+		}
+	}
+	return decl.Pos()
+}
+
+func lineBeginOf(text string, offset int) int {
+	return strings.LastIndex(text[:offset], "\n") + 1
+}
+
+func lineEndOf(text string, offset int) int {
+	lineEnd := strings.Index(text[offset:], "\n")
+	if lineEnd == -1 {
+		return len(text)
+	}
+	return offset + lineEnd + 1
+}
+
+// placeInFile appends the function to options.PlacementFile and moves the
+// imports it needs along. If that file belongs to another package, the
+// function gets exported and its calls qualified.
+func placeInFile(inputFileName string, original string, src string, withoutFunc string, funcDecl *ast.FuncDecl, funcText string, selection Selection, options Options) ([]FileChange, string, error) {
+	if inputFileName == "" {
+		return nil, "", errors.New("Cannot place the function in another file when reading from stdin")
+	}
+	targetFileName := options.PlacementFile
+	if sameFile(targetFileName, inputFileName) {
+		return nil, "", fmt.Errorf("%v is the input file", targetFileName)
+	}
+	fileSet := token.NewFileSet()
+	astFile, err := parser.ParseFile(fileSet, inputFileName, src, parser.ImportsOnly)
+	util.PanicOnError(err)
+
+	targetPackageName := astFile.Name.Name
+	funcName := funcDecl.Name.Name
+	var target *targetPackage
+	if absPath(filepath.Dir(targetFileName)) != absPath(filepath.Dir(inputFileName)) {
+		target, err = otherPackageTarget(inputFileName, original, src, funcName, filepath.Dir(targetFileName), selection, options.Overlay)
+		if err != nil {
+			return nil, "", err
+		}
+		targetPackageName = target.name
+		funcName, err = uniqueNameInPackage(filepath.Dir(targetFileName), target.importPath, exported(funcName), options)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	targetContent, targetExists := readTargetFile(targetFileName, targetPackageName, options.Overlay)
+	// A new file is created as a whole, so its edits do not refer to content
+	// that does not exist.
+	targetOriginal := ""
+	if targetExists {
+		targetOriginal = targetContent
+	}
+	targetFileSet := token.NewFileSet()
+	targetFile, err := parser.ParseFile(targetFileSet, targetFileName, targetContent+"\n"+funcText+"\n", parser.ParseComments)
+	if err != nil {
+		return nil, "", fmt.Errorf("Cannot parse %v: %v", targetFileName, err)
+	}
+	if targetFile.Name.Name != targetPackageName {
+		return nil, "", fmt.Errorf("%v does not belong to package %v", targetFileName, targetPackageName)
+	}
+	targetFuncDecl := targetFile.Decls[len(targetFile.Decls)-1].(*ast.FuncDecl)
+	if targetFuncDecl.Doc != nil && strings.HasPrefix(targetFuncDecl.Doc.List[0].Text, "// "+targetFuncDecl.Name.Name+" ") {
+		targetFuncDecl.Doc.List[0].Text = "// " + funcName + strings.TrimPrefix(targetFuncDecl.Doc.List[0].Text, "// "+targetFuncDecl.Name.Name)
+	}
+	targetFuncDecl.Name.Name = funcName
+	for _, importSpec := range astFile.Imports {
+		path, name := importPathAndName(importSpec)
+		if name != "_" && name != "." && usesPackageName(funcDecl, name) {
+			astutil.AddNamedImport(targetFileSet, targetFile, explicitImportName(importSpec), path)
+		}
+	}
+
+	sourceFileSet := token.NewFileSet()
+	sourceFile, err := parser.ParseFile(sourceFileSet, inputFileName, withoutFunc, parser.ParseComments)
+	util.PanicOnError(err)
+	if target != nil {
+		callOtherPackage(sourceFileSet, sourceFile, funcDecl.Name.Name, funcName, target)
+	}
+	for _, importSpec := range astFile.Imports {
+		path, name := importPathAndName(importSpec)
+		if name != "_" && name != "." && usesPackageName(funcDecl, name) && !usesPackageName(sourceFile, name) {
+			astutil.DeleteNamedImport(sourceFileSet, sourceFile, explicitImportName(importSpec), path)
+		}
+	}
+	return []FileChange{
+		{Filename: inputFileName, Original: original, Modified: nodeSource(sourceFileSet, sourceFile)},
+		{Filename: targetFileName, Original: targetOriginal, Modified: nodeSource(targetFileSet, targetFile)},
+	}, funcName, nil
+}
+
+// readTargetFile returns the content of filename, or only a package clause
+// if it does not exist yet.
+func readTargetFile(filename string, packageName string, overlay Overlay) (content string, exists bool) {
+	if _, found := overlay.contentOf(filename); !found {
+		if _, err := os.Stat(filename); os.IsNotExist(err) {
+			return "package " + packageName + "\n", false
+		}
+	}
+	return overlay.ReadFile(filename), true
+}
+
+func importPathAndName(importSpec *ast.ImportSpec) (path string, name string) {
+	path, err := strconv.Unquote(importSpec.Path.Value)
+	util.PanicOnError(err)
+	if importSpec.Name != nil {
+		return path, importSpec.Name.Name
+	}
+	return path, assumedPackageName(path)
+}
+
+// assumedPackageName guesses the name of the package at path from its last
+// element, like goimports does for packages it cannot find.
+func assumedPackageName(path string) string {
+	name := regexp.MustCompile(`\.v[0-9]+$`).ReplaceAllString(filepath.Base(path), "")
+	name = strings.TrimPrefix(name, "go-")
+	if end := strings.IndexFunc(name, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' }); end != -1 {
+		name = name[:end]
+	}
+	return name
+}
+
+func explicitImportName(importSpec *ast.ImportSpec) string {
+	if importSpec.Name != nil {
+		return importSpec.Name.Name
+	}
+	return ""
+}
+
+// usesPackageName reports whether node refers to an import named name, i.e.
+// contains a selector expression name.X where name is not declared locally.
+func usesPackageName(node ast.Node, name string) (used bool) {
+	ast.Inspect(node, func(node ast.Node) bool {
+		if selectorExpr, isSelectorExpr := node.(*ast.SelectorExpr); isSelectorExpr {
+			if ident, isIdent := selectorExpr.X.(*ast.Ident); isIdent && ident.Name == name && ident.Obj == nil {
+				used = true
+			}
+		}
+		return !used
+	})
+	return
+}
+
+func nodeSource(fileSet *token.FileSet, astFile *ast.File) string {
+	ast.SortImports(fileSet, astFile)
+	formatted, err := format.Source([]byte(nodeString(fileSet, astFile)))
+	util.PanicOnError(err)
+	return string(formatted)
+}
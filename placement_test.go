@@ -0,0 +1,90 @@
+package goextract_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	. "github.com/petergtz/goextract"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Placement in another file", func() {
+	var dir string
+
+	BeforeEach(func() {
+		var err error
+		dir, err = ioutil.TempDir("", "goextract-placement")
+		Expect(err).NotTo(HaveOccurred())
+		Expect(ioutil.WriteFile(filepath.Join(dir, "a.go"), []byte(`package p
+
+import (
+	"fmt"
+	"strings"
+)
+
+func f(s string) {
+	fmt.Println(strings.ToUpper(s))
+	fmt.Println(strings.ToLower(s))
+	fmt.Println(s)
+}
+`), 0644)).To(Succeed())
+		Expect(ioutil.WriteFile(filepath.Join(dir, "b.go"), []byte("package p\n\nfunc g() {}\n"), 0644)).To(Succeed())
+	})
+
+	AfterEach(func() {
+		os.RemoveAll(dir)
+	})
+
+	It("moves the function and the imports only it uses", func() {
+		result, err := ExtractFile(filepath.Join(dir, "a.go"), Selection{Position{9, 2}, Position{10, 33}}, "printCases",
+			Options{Placement: PlaceInFile, PlacementFile: filepath.Join(dir, "b.go")})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Changes).To(HaveLen(2))
+		Expect(result.Changes[0].Modified).To(Equal(`package p
+
+import (
+	"fmt"
+)
+
+func f(s string) {
+	printCases(s)
+	fmt.Println(s)
+}
+`))
+		Expect(result.Changes[1].Filename).To(Equal(filepath.Join(dir, "b.go")))
+		Expect(result.Changes[1].Modified).To(Equal(`package p
+
+import (
+	"fmt"
+	"strings"
+)
+
+func g() {}
+
+func printCases(s string) {
+	fmt.Println(strings.ToUpper(s))
+	fmt.Println(strings.ToLower(s))
+}
+`))
+		Expect(result.Function.Filename).To(Equal(filepath.Join(dir, "b.go")))
+	})
+
+	It("creates the file if it does not exist", func() {
+		result, err := ExtractFile(filepath.Join(dir, "a.go"), Selection{Position{9, 2}, Position{10, 33}}, "printIt",
+			Options{Placement: PlaceInFile, PlacementFile: filepath.Join(dir, "c.go")})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Changes[1].Original).To(BeEmpty())
+		Expect(result.Changes[1].Modified).To(HavePrefix("package p\n"))
+		Expect(result.Changes[1].Modified).To(ContainSubstring("func printIt(s string) {"))
+		Expect(TextEditsFrom(result.Changes[1].Original, result.Changes[1].Modified)).To(ConsistOf(TextEdit{
+			Start:   TextPosition{Offset: 0, Line: 1, Column: 1},
+			End:     TextPosition{Offset: 0, Line: 1, Column: 1},
+			NewText: result.Changes[1].Modified,
+		}))
+	})
+})
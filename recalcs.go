@@ -1,4 +1,4 @@
-package main
+package goextract
 
 import (
 	"fmt"
@@ -6,8 +6,6 @@ import (
 	"go/token"
 	"reflect"
 	"strings"
-
-	"github.com/petergtz/goextract/util"
 )
 
 func RecalcPoses(node ast.Node, pos token.Pos, offset *token.Pos, indent int) {
@@ -178,6 +176,9 @@ func RecalcPoses(node ast.Node, pos token.Pos, offset *token.Pos, indent int) {
 	case *ast.SelectorExpr:
 		RecalcPoses(typedNode.X, pos, offset, indent)
 		RecalcPoses(typedNode.Sel, typedNode.X.End()+1, offset, indent)
+	case *ast.InterfaceType:
+		typedNode.Interface = pos
+		RecalcPoses(typedNode.Methods, pos+9, offset, indent)
 	case *ast.ArrayType:
 		typedNode.Lbrack = pos
 		pos += 2
@@ -262,6 +263,12 @@ func getPosesForNode(node ast.Node) []*token.Pos {
 		return []*token.Pos{&typedNode.If}
 	case *ast.TypeSwitchStmt:
 		return []*token.Pos{&typedNode.Switch}
+	case *ast.SwitchStmt:
+		return []*token.Pos{&typedNode.Switch}
+	case *ast.InterfaceType:
+		return []*token.Pos{&typedNode.Interface}
+	case *ast.IncDecStmt:
+		return []*token.Pos{&typedNode.TokPos}
 	case *ast.TypeAssertExpr:
 		return []*token.Pos{&typedNode.Lparen, &typedNode.Rparen}
 	case *ast.CaseClause:
@@ -274,6 +281,10 @@ func getPosesForNode(node ast.Node) []*token.Pos {
 		return []*token.Pos{&typedNode.Colon}
 	case *ast.BranchStmt:
 		return []*token.Pos{&typedNode.TokPos}
+	case *ast.DeferStmt:
+		return []*token.Pos{&typedNode.Defer}
+	case *ast.GoStmt:
+		return []*token.Pos{&typedNode.Go}
 	case *ast.CommentGroup:
 		return []*token.Pos{}
 	case *ast.Comment:
@@ -306,8 +317,8 @@ func resetPoses(node ast.Node) {
 	})
 }
 
-func lineLengthsFrom(fileSet *token.FileSet) []int {
-	return lineLengthsFromLines(strings.Split(util.ReadFileAsStringOrPanic(fileSet.File(1).Name()), "\n"))
+func lineLengthsFrom(src string) []int {
+	return lineLengthsFromLines(strings.Split(src, "\n"))
 }
 
 func lineLengthsFromLines(lines []string) []int {
@@ -403,10 +414,21 @@ func insertionModificationsForStmts(astFile *ast.File, funcDecl *ast.FuncDecl, a
 }
 
 // TODO this moves all comments instead of just correct ones.
-func moveComments(astFile *ast.File, moveOffset token.Pos) {
+// moveComments moves the comments of the extracted area between begin and end
+// into the new function and shifts the comments between the extracted area and
+// the end of the last declaration like the nodes there. Comments in front of
+// the extracted area stay where they are. All positions are the ones before
+// the extraction.
+func moveComments(astFile *ast.File, begin, end, lastDeclEnd token.Pos, moveOffset, shift token.Pos) {
 	for _, commentGroup := range astFile.Comments {
 		for _, comment := range commentGroup.List {
-			comment.Slash += moveOffset
+			switch {
+			case comment.Slash < begin:
+			case comment.Slash < end || comment.Slash >= lastDeclEnd:
+				comment.Slash += moveOffset
+			default:
+				comment.Slash += shift
+			}
 		}
 	}
 }
@@ -415,8 +437,7 @@ type Range struct {
 	begin, end int
 }
 
-func areaRemoved(fileSet *token.FileSet, pos, end token.Pos) []Range {
-	lineLengths := lineLengthsFrom(fileSet)
+func areaRemoved(fileSet *token.FileSet, lineLengths []int, pos, end token.Pos) []Range {
 	b := fileSet.Position(pos)
 	e := fileSet.Position(end)
 	result := make([]Range, e.Line-b.Line+1)
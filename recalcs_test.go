@@ -1,4 +1,4 @@
-package main_test
+package goextract_test
 
 import (
 	"go/ast"
@@ -0,0 +1,302 @@
+package goextract
+
+import (
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/petergtz/goextract/util"
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// packageRefactoring holds the type-checked package of a file and collects
+// the text edits of a refactoring in all files of the package.
+type packageRefactoring struct {
+	fileSet  *token.FileSet
+	filename string
+	astFile  *ast.File
+	files    []*ast.File
+	info     *types.Info
+	pkg      *types.Package
+	overlay  Overlay
+	sources  map[string]string
+	// created holds the files the refactoring creates. Their sources only
+	// consist of a package clause, and their original is empty.
+	created  map[string]bool
+	edits    map[string][]lazyEdit
+	imports  map[string][]importChange
+	rule     string
+	problems []Problem
+}
+
+// lazyEdit replaces the text between begin and end. Its text is computed
+// when applied, so it can contain the changed text of edits within it.
+type lazyEdit struct {
+	begin, end int
+	text       func() string
+}
+
+func newPackageRefactoring(filename string, overlay Overlay, rule string) (*packageRefactoring, error) {
+	return newPackageRefactoringOf(filename, overlay.ReadFile(filename), overlay, rule)
+}
+
+// newPackageRefactoringOf is like newPackageRefactoring, but with src as the
+// content of filename.
+func newPackageRefactoringOf(filename string, src string, overlay Overlay, rule string) (*packageRefactoring, error) {
+	refactoring := &packageRefactoring{
+		fileSet:  token.NewFileSet(),
+		filename: filename,
+		info: &types.Info{
+			Defs:       make(map[*ast.Ident]types.Object),
+			Uses:       make(map[*ast.Ident]types.Object),
+			Types:      make(map[ast.Expr]types.TypeAndValue),
+			Selections: make(map[*ast.SelectorExpr]*types.Selection),
+		},
+		overlay: overlay,
+		sources: map[string]string{filename: src},
+		created: make(map[string]bool),
+		edits:   make(map[string][]lazyEdit),
+		imports: make(map[string][]importChange),
+		rule:    rule,
+	}
+	var err error
+	refactoring.astFile, err = parser.ParseFile(refactoring.fileSet, filename, src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+	// The test files of the package use it like its other files, so they
+	// are refactored along.
+	refactoring.files = append([]*ast.File{refactoring.astFile}, packageFilesOf(refactoring.fileSet, filename, src, overlay)...)
+	for _, file := range refactoring.files[1:] {
+		refactoring.sources[refactoring.filenameOf(file.Pos())] = overlay.ReadFile(refactoring.filenameOf(file.Pos()))
+	}
+	config := types.Config{Importer: newSourceImporter(refactoring.fileSet, overlay), Error: func(error) {}}
+	refactoring.pkg, _ = config.Check(refactoring.astFile.Name.Name, refactoring.fileSet, refactoring.files, refactoring.info)
+	return refactoring, nil
+}
+
+func (refactoring *packageRefactoring) filenameOf(pos token.Pos) string {
+	return refactoring.fileSet.Position(pos).Filename
+}
+
+func (refactoring *packageRefactoring) offsetOf(pos token.Pos) int {
+	return refactoring.fileSet.Position(pos).Offset
+}
+
+func (refactoring *packageRefactoring) problem(pos token.Pos, format string, args ...interface{}) {
+	refactoring.problems = append(refactoring.problems, Problem{Rule: refactoring.rule, Position: refactoring.fileSet.Position(pos), Message: fmt.Sprintf(format, args...)})
+}
+
+// checkOnlyUsedInPackage reports funcDecl if packages importing the package
+// can use it, because their uses are not rewritten.
+func (refactoring *packageRefactoring) checkOnlyUsedInPackage(funcDecl *ast.FuncDecl) {
+	if funcDecl.Name.IsExported() && refactoring.pkg.Name() != "main" {
+		refactoring.problem(funcDecl.Name.Pos(), "%v is exported, so its uses in other packages could not be updated", qualifiedNameOf(funcDecl))
+	}
+	refactoring.checkNotUsedByExternalTests(funcDecl)
+}
+
+// checkNotUsedByExternalTests reports the uses of funcDecl in the external
+// test package, which are not rewritten.
+func (refactoring *packageRefactoring) checkNotUsedByExternalTests(funcDecl *ast.FuncDecl) {
+	object := refactoring.info.Defs[funcDecl.Name]
+	files := externalTestFilesOf(refactoring.fileSet, refactoring.filename, refactoring.sources[refactoring.filename], refactoring.overlay)
+	if object == nil || len(files) == 0 {
+		return
+	}
+	info := &types.Info{Uses: make(map[*ast.Ident]types.Object)}
+	importer := &refactoredPackageImporter{
+		sourceImporter: newSourceImporter(refactoring.fileSet, refactoring.overlay),
+		dir:            absPath(filepath.Dir(refactoring.filename)),
+		pkg:            refactoring.pkg,
+	}
+	config := types.Config{Importer: importer, Error: func(error) {}}
+	config.Check(files[0].Name.Name, refactoring.fileSet, files, info)
+	for _, file := range files {
+		ast.Inspect(file, func(node ast.Node) bool {
+			if ident, isIdent := node.(*ast.Ident); isIdent && info.Uses[ident] == object {
+				refactoring.problem(ident.Pos(), "%v is used by the external test package %v, whose uses could not be updated", qualifiedNameOf(funcDecl), file.Name.Name)
+			}
+			return true
+		})
+	}
+}
+
+// refactoredPackageImporter imports the package in dir as the type-checked
+// package of the refactoring, so that its objects can be found in its uses.
+type refactoredPackageImporter struct {
+	*sourceImporter
+	dir string
+	pkg *types.Package
+}
+
+func (importer *refactoredPackageImporter) ImportFrom(path string, srcDir string, mode types.ImportMode) (*types.Package, error) {
+	if dir, err := dirOfImportPath(path, srcDir, importer.overlay); err == nil && absPath(dir) == importer.dir {
+		return importer.pkg, nil
+	}
+	return importer.sourceImporter.ImportFrom(path, srcDir, mode)
+}
+
+// checkNotRequiredByInterface reports the method funcDecl if its type
+// implements an interface of the package or of its imports that has the
+// method, as a changed signature would not satisfy the interface anymore.
+func (refactoring *packageRefactoring) checkNotRequiredByInterface(funcDecl *ast.FuncDecl) {
+	method, isFunc := refactoring.info.Defs[funcDecl.Name].(*types.Func)
+	if funcDecl.Recv == nil || !isFunc {
+		return
+	}
+	recvType := method.Type().(*types.Signature).Recv().Type()
+	if pointer, isPointer := recvType.(*types.Pointer); isPointer {
+		recvType = pointer.Elem()
+	}
+	for _, pkg := range append([]*types.Package{refactoring.pkg}, refactoring.pkg.Imports()...) {
+		for _, name := range pkg.Scope().Names() {
+			typeName, isTypeName := pkg.Scope().Lookup(name).(*types.TypeName)
+			if !isTypeName {
+				continue
+			}
+			iface, isInterface := typeName.Type().Underlying().(*types.Interface)
+			if !isInterface || iface.Empty() {
+				continue
+			}
+			for i := 0; i < iface.NumMethods(); i++ {
+				if iface.Method(i).Id() == method.Id() {
+					if types.Implements(recvType, iface) || types.Implements(types.NewPointer(recvType), iface) {
+						refactoring.problem(funcDecl.Name.Pos(), "%v implements %v, which requires the signature of %v", types.TypeString(recvType, types.RelativeTo(refactoring.pkg)), types.TypeString(typeName.Type(), types.RelativeTo(refactoring.pkg)), method.Name())
+					}
+				}
+			}
+		}
+	}
+}
+
+func (refactoring *packageRefactoring) edit(begin token.Pos, end token.Pos, text func() string) {
+	filename := refactoring.filenameOf(begin)
+	refactoring.edits[filename] = append(refactoring.edits[filename], lazyEdit{refactoring.offsetOf(begin), refactoring.offsetOf(end), text})
+}
+
+// importChange adds the import of path named name to a file, or removes it
+// if the file does not use it anymore.
+type importChange struct {
+	name, path string
+	remove     bool
+}
+
+// addImport imports the package path in filename when the result is built.
+// An empty name imports the package under its own name.
+func (refactoring *packageRefactoring) addImport(filename string, name string, path string) {
+	refactoring.imports[filename] = append(refactoring.imports[filename], importChange{name: name, path: path})
+}
+
+// removeImportIfUnused removes the import of path named name from filename if
+// the result does not use it anymore.
+func (refactoring *packageRefactoring) removeImportIfUnused(filename string, name string, path string) {
+	refactoring.imports[filename] = append(refactoring.imports[filename], importChange{name: name, path: path, remove: true})
+}
+
+// textOf returns the text between begin and end of filename with all edits
+// within it applied.
+func (refactoring *packageRefactoring) textOf(filename string, begin int, end int) string {
+	var inner []lazyEdit
+	for _, edit := range refactoring.edits[filename] {
+		if begin <= edit.begin && edit.end <= end {
+			inner = append(inner, edit)
+		}
+	}
+	sort.SliceStable(inner, func(i, j int) bool {
+		return inner[i].begin < inner[j].begin || inner[i].begin == inner[j].begin && inner[i].end > inner[j].end
+	})
+	src := refactoring.sources[filename]
+	var text strings.Builder
+	offset := begin
+	for _, edit := range inner {
+		if edit.begin < offset {
+			// Contained in the previous edit, which already applied it.
+			continue
+		}
+		text.WriteString(src[offset:edit.begin])
+		text.WriteString(edit.text())
+		offset = edit.end
+	}
+	text.WriteString(src[offset:end])
+	return text.String()
+}
+
+// nodeText returns the text of node with all edits within it applied.
+func (refactoring *packageRefactoring) nodeText(node ast.Node) string {
+	return refactoring.textOf(refactoring.filenameOf(node.Pos()), refactoring.offsetOf(node.Pos()), refactoring.offsetOf(node.End()))
+}
+
+func (refactoring *packageRefactoring) originalText(node ast.Node) string {
+	return refactoring.sources[refactoring.filenameOf(node.Pos())][refactoring.offsetOf(node.Pos()):refactoring.offsetOf(node.End())]
+}
+
+// result applies all edits and returns the changed files, starting with the
+// refactored file. The result must type-check unless options.Force is set.
+func (refactoring *packageRefactoring) result(options Options) (*Result, error) {
+	if len(refactoring.problems) != 0 {
+		return &Result{}, &ValidationError{Problems: refactoring.problems}
+	}
+	changes := refactoring.changes()
+	typeErrors := checkChangedPackage(changes, options.Overlay)
+	if len(typeErrors) != 0 && !options.Force {
+		return &Result{}, &TypeCheckError{Problems: typeErrors}
+	}
+	return &Result{Changes: changes, Warnings: typeErrors}, nil
+}
+
+// changes applies all edits and import changes and returns the changed
+// files, starting with the refactored file.
+func (refactoring *packageRefactoring) changes() []FileChange {
+	changes := []FileChange{{Filename: refactoring.filename, Original: refactoring.sources[refactoring.filename]}}
+	var otherFilenames []string
+	for changedFilename := range refactoring.edits {
+		if changedFilename != refactoring.filename {
+			otherFilenames = append(otherFilenames, changedFilename)
+		}
+	}
+	sort.Strings(otherFilenames)
+	for _, otherFilename := range otherFilenames {
+		original := refactoring.sources[otherFilename]
+		if refactoring.created[otherFilename] {
+			original = ""
+		}
+		changes = append(changes, FileChange{Filename: otherFilename, Original: original})
+	}
+	for i := range changes {
+		modified := refactoring.textOf(changes[i].Filename, 0, len(refactoring.sources[changes[i].Filename]))
+		if imports := refactoring.imports[changes[i].Filename]; len(imports) != 0 {
+			modified = withImportChanges(modified, imports)
+		}
+		formatted, err := format.Source([]byte(modified))
+		util.PanicOnError(err)
+		changes[i].Modified = string(formatted)
+	}
+	return changes
+}
+
+func withImportChanges(src string, imports []importChange) string {
+	fileSet := token.NewFileSet()
+	astFile, err := parser.ParseFile(fileSet, "", src, parser.ParseComments)
+	util.PanicOnError(err)
+	for _, change := range imports {
+		if !change.remove {
+			astutil.AddNamedImport(fileSet, astFile, change.name, change.path)
+			continue
+		}
+		name := change.name
+		if name == "" {
+			name = assumedPackageName(change.path)
+		}
+		if !usesPackageName(astFile, name) {
+			astutil.DeleteNamedImport(fileSet, astFile, change.name, change.path)
+		}
+	}
+	return nodeSource(fileSet, astFile)
+}
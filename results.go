@@ -0,0 +1,218 @@
+package goextract
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strings"
+	"text/template"
+
+	"github.com/petergtz/goextract/util"
+)
+
+// DefaultDocTemplate is the template for doc comments used by --doc. Its
+// data are the Name of the extracted function, the names of its Params and
+// Results, and the name of the function it was extracted from as Enclosing.
+// Unnamed results are named like the local variables the function returns.
+// Every line of the output becomes a line of the comment.
+const DefaultDocTemplate = `{{.Name}} {{if .Results}}computes {{join .Results ", "}}{{else}}was extracted from {{.Enclosing}}{{end}}{{if .Params}} using {{join .Params ", "}}{{end}}.`
+
+// nameResults turns the results of the extracted function funcName in src
+// into named results, named like the local variables of its body it returns.
+// Other results, like nil or constants, are named _. Declarations of these
+// variables at the top level of its body become assignments.
+func nameResults(checker *packageChecker, src string, funcName string) string {
+	checked := checker.check(src, parser.ParseComments)
+	fileSet, astFile, info := checked.fileSet, checked.astFile, checked.info
+
+	funcDecl := funcDeclNamed(astFile, funcName)
+	results := funcDecl.Type.Results
+	if results == nil || len(results.List) == 0 || len(results.List[0].Names) != 0 || len(funcDecl.Body.List) == 0 {
+		return src
+	}
+	returnStmt, isReturn := funcDecl.Body.List[len(funcDecl.Body.List)-1].(*ast.ReturnStmt)
+	if !isReturn || len(returnStmt.Results) != len(results.List) {
+		return src
+	}
+	resultVars := make(map[types.Object]bool)
+	var fields []*ast.Field
+	for i, result := range returnStmt.Results {
+		name := "_"
+		if variable := localVarOf(result, funcDecl.Body, info); variable != nil {
+			if resultVars[variable] {
+				return src
+			}
+			resultVars[variable] = true
+			name = variable.Name()
+		}
+		typ := results.List[i].Type
+		if i > 0 && nodeString(fileSet, typ) == nodeString(fileSet, results.List[i-1].Type) {
+			fields[len(fields)-1].Names = append(fields[len(fields)-1].Names, ast.NewIdent(name))
+		} else {
+			fields = append(fields, &ast.Field{Names: []*ast.Ident{ast.NewIdent(name)}, Type: typ})
+		}
+	}
+	if len(resultVars) == 0 {
+		return src
+	}
+
+	var stmts []ast.Stmt
+	for _, stmt := range funcDecl.Body.List {
+		switch typedStmt := stmt.(type) {
+		case *ast.AssignStmt:
+			// The results are declared already, so a short variable
+			// declaration must declare something else to stay one.
+			if typedStmt.Tok == token.DEFINE && !definesOthers(typedStmt.Lhs, resultVars, info) {
+				typedStmt.Tok = token.ASSIGN
+			}
+		case *ast.DeclStmt:
+			genDecl := typedStmt.Decl.(*ast.GenDecl)
+			if genDecl.Tok != token.VAR {
+				break
+			}
+			for _, spec := range genDecl.Specs {
+				valueSpec := spec.(*ast.ValueSpec)
+				var names []ast.Expr
+				for _, name := range valueSpec.Names {
+					names = append(names, name)
+				}
+				if definesOthers(names, resultVars, info) {
+					if definesAny(names, resultVars, info) {
+						return src
+					}
+					continue
+				}
+				if len(genDecl.Specs) != 1 {
+					return src
+				}
+				if len(valueSpec.Values) != 0 {
+					stmts = append(stmts, &ast.AssignStmt{Lhs: names, TokPos: valueSpec.Names[len(valueSpec.Names)-1].End(), Tok: token.ASSIGN, Rhs: valueSpec.Values})
+				}
+				stmt = nil
+			}
+		}
+		if stmt != nil {
+			stmts = append(stmts, stmt)
+		}
+	}
+	funcDecl.Body.List = stmts
+	results.List = fields
+	return nodeSource(fileSet, astFile)
+}
+
+// localVarOf returns the variable declared in body that expr refers to, or
+// nil if expr is no such variable.
+func localVarOf(expr ast.Expr, body *ast.BlockStmt, info *types.Info) *types.Var {
+	ident, isIdent := expr.(*ast.Ident)
+	if !isIdent {
+		return nil
+	}
+	variable, isVar := info.Uses[ident].(*types.Var)
+	if !isVar || variable.Pos() < body.Pos() || variable.Pos() >= body.End() {
+		return nil
+	}
+	return variable
+}
+
+// definesOthers reports whether any of exprs declares a variable other than
+// one out of vars or a blank one.
+func definesOthers(exprs []ast.Expr, vars map[types.Object]bool, info *types.Info) bool {
+	for _, expr := range exprs {
+		if ident, isIdent := expr.(*ast.Ident); isIdent && ident.Name != "_" && info.Defs[ident] != nil && !vars[info.Defs[ident]] {
+			return true
+		}
+	}
+	return false
+}
+
+// definesAny reports whether any of exprs declares one of vars.
+func definesAny(exprs []ast.Expr, vars map[types.Object]bool, info *types.Info) bool {
+	for _, expr := range exprs {
+		if ident, isIdent := expr.(*ast.Ident); isIdent && vars[info.Defs[ident]] {
+			return true
+		}
+	}
+	return false
+}
+
+type docData struct {
+	Name      string
+	Params    []string
+	Results   []string
+	Enclosing string
+}
+
+// addDocComment documents the extracted function funcName in src with the
+// output of docTemplate.
+func addDocComment(src string, funcName string, docTemplate string) (string, error) {
+	tmpl, err := template.New("doc").Funcs(template.FuncMap{"join": strings.Join}).Parse(docTemplate)
+	if err != nil {
+		return "", err
+	}
+	fileSet := token.NewFileSet()
+	astFile, err := parser.ParseFile(fileSet, "", src, parser.ParseComments)
+	util.PanicOnError(err)
+	funcDecl := funcDeclNamed(astFile, funcName)
+
+	data := docData{Name: funcName}
+	for _, field := range funcDecl.Type.Params.List {
+		for _, name := range field.Names {
+			data.Params = append(data.Params, name.Name)
+		}
+	}
+	data.Results = resultNamesOf(funcDecl)
+	if call := callOf(astFile, funcDecl, funcName); call != nil {
+		for _, decl := range astFile.Decls {
+			if enclosing, isFuncDecl := decl.(*ast.FuncDecl); isFuncDecl && enclosing.Pos() <= call.Pos() && call.End() <= enclosing.End() {
+				data.Enclosing = enclosing.Name.Name
+			}
+		}
+	}
+	var doc bytes.Buffer
+	if err := tmpl.Execute(&doc, data); err != nil {
+		return "", err
+	}
+	var comment string
+	for _, line := range strings.Split(strings.TrimSpace(doc.String()), "\n") {
+		comment += strings.TrimRight("// "+line, " ") + "\n"
+	}
+	insertAt := lineBeginOf(src, fileSet.Position(funcDecl.Pos()).Offset)
+	return src[:insertAt] + comment + src[insertAt:], nil
+}
+
+// resultNamesOf returns the names of the named results of funcDecl except
+// _, or else the names of the local variables of its body its final return
+// returns.
+func resultNamesOf(funcDecl *ast.FuncDecl) (names []string) {
+	results := funcDecl.Type.Results
+	if results == nil || len(results.List) == 0 {
+		return
+	}
+	if len(results.List[0].Names) != 0 {
+		for _, field := range results.List {
+			for _, name := range field.Names {
+				if name.Name != "_" {
+					names = append(names, name.Name)
+				}
+			}
+		}
+		return
+	}
+	body := funcDecl.Body.List
+	if len(body) == 0 {
+		return
+	}
+	returnStmt, isReturn := body[len(body)-1].(*ast.ReturnStmt)
+	if !isReturn {
+		return
+	}
+	for _, result := range returnStmt.Results {
+		if ident, isIdent := result.(*ast.Ident); isIdent && ident.Obj != nil && ident.Obj.Kind == ast.Var &&
+			funcDecl.Body.Pos() <= ident.Obj.Pos() && ident.Obj.Pos() < funcDecl.Body.End() {
+			names = append(names, ident.Name)
+		}
+	}
+	return
+}
@@ -0,0 +1,97 @@
+package goextract_test
+
+import (
+	. "github.com/petergtz/goextract"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Results and doc comments", func() {
+	const src = "package p\n\nfunc f(n int) {\n\ta := n\n\tvar b = 2\n\tprintln(a, b)\n}\n"
+	selection := Selection{Position{4, 2}, Position{5, 11}}
+
+	It("returns all variables used afterwards", func() {
+		output, _, err := ExtractStringToString(src, selection, "g", Options{})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(output).To(ContainSubstring("\ta, b := g(n)\n"))
+		Expect(output).To(ContainSubstring("func g(n int) (int, int) {"))
+	})
+
+	It("names the results like the returned variables", func() {
+		output, _, err := ExtractStringToString(src, selection, "g", Options{NamedResults: true})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(output).To(ContainSubstring("func g(n int) (a, b int) {\n\ta = n\n\tb = 2\n\treturn a, b\n}\n"))
+	})
+
+	It("generates a doc comment", func() {
+		output, _, err := ExtractStringToString(src, selection, "g", Options{NamedResults: true, DocTemplate: DefaultDocTemplate})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(output).To(ContainSubstring("\n// g computes a, b using n.\nfunc g("))
+	})
+
+	It("generates a doc comment naming the returned variables of unnamed results", func() {
+		output, _, err := ExtractStringToString(src, selection, "g", Options{DocTemplate: DefaultDocTemplate})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(output).To(ContainSubstring("\n// g computes a, b using n.\nfunc g(n int) (int, int) {"))
+	})
+
+	It("generates a doc comment from a custom template", func() {
+		output, _, err := ExtractStringToString(src, selection, "g", Options{DocTemplate: "{{.Name}} is part of {{.Enclosing}}.\n\nTODO: document"})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(output).To(ContainSubstring("\n// g is part of f.\n//\n// TODO: document\nfunc g("))
+	})
+
+	It("names the results and documents the function placed before the enclosing one", func() {
+		output, _, err := ExtractStringToString(src, selection, "g", Options{NamedResults: true, DocTemplate: DefaultDocTemplate, Placement: PlaceBeforeEnclosingDecl})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(output).To(HavePrefix("package p\n\n// g computes a, b using n.\nfunc g(n int) (a, b int) {\n\ta = n\n\tb = 2\n\treturn a, b\n}\n\nfunc f(n int) {"))
+	})
+
+	Context("when the extracted code contains error guards", func() {
+		const guardedSrc = `package p
+
+func atoi(s string) (int, error) { return 0, nil }
+
+func parse(a string, b string) (int, error) {
+	x, err := atoi(a)
+	if err != nil {
+		return 0, err
+	}
+	y, err := atoi(b)
+	if err != nil {
+		return 0, err
+	}
+	sum := x + y
+	return sum * 2, nil
+}
+`
+
+		It("names only the results returning local variables", func() {
+			output, _, err := ExtractStringToString(guardedSrc, Selection{Position{6, 2}, Position{14, 14}}, "g", Options{NamedResults: true, DocTemplate: DefaultDocTemplate})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).To(ContainSubstring("// g computes sum using a, b.\nfunc g(a, b string) (sum int, _ error) {\n"))
+			Expect(output).To(ContainSubstring("\tsum = x + y\n\treturn sum, nil\n}\n"))
+		})
+
+		It("keeps short variable declarations that declare other variables too", func() {
+			output, _, err := ExtractStringToString(guardedSrc, Selection{Position{6, 2}, Position{13, 3}}, "g", Options{NamedResults: true})
+
+			Expect(err).NotTo(HaveOccurred())
+			Expect(output).To(ContainSubstring(`func g(a, b string) (x, y int, _ error) {
+	x, err := atoi(a)
+	if err != nil {
+		return 0, 0, err
+	}
+	y, err = atoi(b)
+`))
+		})
+	})
+})
@@ -0,0 +1,128 @@
+package goextract
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+
+	"github.com/petergtz/goextract/util"
+)
+
+// The subset of SARIF 2.1.0 needed to report suggestions to code scanning
+// dashboards.
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID     string          `json:"ruleId"`
+	Level      string          `json:"level"`
+	Message    sarifMessage    `json:"message"`
+	Locations  []sarifLocation `json:"locations"`
+	Properties sarifProperties `json:"properties"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn"`
+	EndLine     int `json:"endLine"`
+	EndColumn   int `json:"endColumn"`
+}
+
+type sarifProperties struct {
+	Name       string `json:"name"`
+	Signature  string `json:"signature"`
+	Complexity int    `json:"complexity"`
+	Score      int    `json:"score"`
+}
+
+const sarifRuleID = "extract-function"
+
+// SARIFFromSuggestions converts the suggestions of goextract suggest into a
+// SARIF log. File URIs are relative to baseDir where possible.
+func SARIFFromSuggestions(suggestions []Suggestion, baseDir string) []byte {
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "goextract",
+			InformationURI: "https://github.com/petergtz/goextract",
+			Rules: []sarifRule{{
+				ID:               sarifRuleID,
+				ShortDescription: sarifMessage{Text: "Code that can be extracted into a function of its own"},
+			}},
+		}},
+		Results: []sarifResult{},
+	}
+	for _, suggestion := range suggestions {
+		uri := suggestion.Filename
+		if relativePath, err := filepath.Rel(absPath(baseDir), absPath(suggestion.Filename)); err == nil {
+			uri = relativePath
+		}
+		run.Results = append(run.Results, sarifResult{
+			RuleID: sarifRuleID,
+			Level:  "note",
+			Message: sarifMessage{Text: fmt.Sprintf("%v has %v lines and nesting depth %v. Extracting this code as %v%v removes complexity %v.",
+				suggestion.Function, suggestion.Lines, suggestion.Nesting, suggestion.Name, suggestion.Signature, suggestion.Complexity)},
+			Locations: []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactLocation{URI: filepath.ToSlash(uri)},
+				Region: sarifRegion{
+					StartLine:   suggestion.Selection.Begin.Line,
+					StartColumn: suggestion.Selection.Begin.Column,
+					EndLine:     suggestion.Selection.End.Line,
+					EndColumn:   suggestion.Selection.End.Column,
+				},
+			}}},
+			Properties: sarifProperties{
+				Name:       suggestion.Name,
+				Signature:  suggestion.Signature,
+				Complexity: suggestion.Complexity,
+				Score:      suggestion.Score,
+			},
+		})
+	}
+	content, err := json.MarshalIndent(sarifLog{
+		Version: "2.1.0",
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Runs:    []sarifRun{run},
+	}, "", "  ")
+	util.PanicOnError(err)
+	return content
+}
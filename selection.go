@@ -1,9 +1,8 @@
-package main
+package goextract
 
 import (
 	"strings"
 
-	"github.com/petergtz/goextract/util"
 	"github.com/pkg/math"
 )
 
@@ -33,9 +32,10 @@ func ShrinkToNonWhiteSpace(selection Selection, sourceCode string) Selection {
 }
 
 func makeValid(pos Position, lines []string) Position {
+	line := math.Min(math.Max(pos.Line, 1), len(lines))
 	return Position{
-		Line:   math.Min(math.Max(pos.Line, 1), len(lines)),
-		Column: math.Min(math.Max(pos.Column, 1), len(lines[len(lines)-1])+1),
+		Line:   line,
+		Column: math.Min(math.Max(pos.Column, 1), len(lines[line-1])+1),
 	}
 }
 
@@ -56,6 +56,10 @@ func endOfLine(lines []string, pos Position) bool {
 	return pos.Column == len(lines[pos.Line-1])+1
 }
 
+func (pos Position) isBefore(other Position) bool {
+	return pos.Line < other.Line || (pos.Line == other.Line && pos.Column < other.Column)
+}
+
 func emptySelection(selection Selection) bool {
 	return selection.Begin == selection.End
 }
@@ -81,18 +85,3 @@ func leftOf(pos Position, lines []string) Position {
 		return Position{pos.Line - 1, len(lines[pos.Line-2]) + 1}
 	}
 }
-
-// TODO: error handling. Do this with regex
-func selectionFromString(s string) Selection {
-	s = strings.Replace(s, " ", "", -1)
-	beginEnd := strings.Split(s, "-")
-	beginString := beginEnd[0]
-	endString := beginEnd[1]
-	begin := strings.Split(beginString, ":")
-	end := strings.Split(endString, ":")
-
-	return Selection{
-		Begin: Position{util.ToInt(begin[0]), util.ToInt(begin[1])},
-		End:   Position{util.ToInt(end[0]), util.ToInt(end[1])},
-	}
-}
@@ -1,4 +1,4 @@
-package main_test
+package goextract_test
 
 import (
 	. "github.com/petergtz/goextract"
@@ -15,4 +15,11 @@ var _ = Describe("Selection", func() {
 			util.ReadFileAsStringOrPanic("test_data/shrink_selection"))).
 			To(Equal(Selection{Begin: Position{5, 2}, End: Position{5, 8}}))
 	})
+
+	It("Keeps columns beyond the length of the last line", func() {
+		Expect(ShrinkToNonWhiteSpace(
+			Selection{Begin: Position{2, 5}, End: Position{2, 8}},
+			"package p\nvar x = 1\n")).
+			To(Equal(Selection{Begin: Position{2, 5}, End: Position{2, 8}}))
+	})
 })
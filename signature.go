@@ -0,0 +1,363 @@
+package goextract
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// ParamChange describes a parameter of a changed signature.
+type ParamChange struct {
+	// From is the name of the existing parameter, empty for a new one.
+	From string
+	// Name is the new name of the parameter. It defaults to From.
+	Name string
+	// Type is the type of a new parameter.
+	Type string
+	// Default is the argument passed for a new parameter at all calls.
+	Default string
+}
+
+// ChangeSignature changes the parameters of the function funcName, declared
+// in filename, to params, in this order. Parameters not listed are removed.
+// All calls in the package pass the arguments accordingly, with the default
+// argument for new parameters. Where the function is used as value, it is
+// wrapped in a function literal with the old signature. Methods are given as
+// Type.Method. Exported functions and methods are refused outside of main
+// packages, as their uses in other packages would break. The first change is
+// the one of filename.
+func ChangeSignature(filename string, funcName string, params []ParamChange, options Options) (*Result, error) {
+	refactoring, err := newPackageRefactoring(filename, options.Overlay, "signature")
+	if err != nil {
+		return &Result{}, err
+	}
+	funcDecl := funcOrMethodDeclNamed(refactoring.astFile, funcName)
+	if funcDecl == nil {
+		return &Result{}, fmt.Errorf("There is no function %v in %v", funcName, filename)
+	}
+	refactoring.checkOnlyUsedInPackage(funcDecl)
+	changer := &signatureChanger{packageRefactoring: refactoring, funcDecl: funcDecl}
+	if err := changer.resolveParams(params); err != nil {
+		return &Result{}, err
+	}
+	changer.changeDeclaration()
+	for _, file := range refactoring.files {
+		changer.changeUses(file)
+	}
+	return refactoring.result(options)
+}
+
+type oldParam struct {
+	name     string
+	object   types.Object
+	typeText string
+	variadic bool
+	newName  string
+	kept     bool
+}
+
+type newParam struct {
+	old         *oldParam
+	name        string
+	typeText    string
+	defaultText string
+}
+
+// signatureChanger changes the parameters of funcDecl.
+type signatureChanger struct {
+	*packageRefactoring
+	funcDecl  *ast.FuncDecl
+	oldParams []*oldParam
+	newParams []*newParam
+}
+
+func (changer *signatureChanger) resolveParams(params []ParamChange) error {
+	funcName := changer.funcDecl.Name.Name
+	byName := make(map[string]*oldParam)
+	for _, field := range changer.funcDecl.Type.Params.List {
+		if len(field.Names) == 0 {
+			return fmt.Errorf("The parameters of %v must be named", funcName)
+		}
+		_, isEllipsis := field.Type.(*ast.Ellipsis)
+		for _, name := range field.Names {
+			param := &oldParam{name: name.Name, object: changer.info.Defs[name], typeText: changer.originalText(field.Type), variadic: isEllipsis}
+			changer.oldParams = append(changer.oldParams, param)
+			byName[name.Name] = param
+		}
+	}
+	names := make(map[string]bool)
+	for i, change := range params {
+		param := &newParam{name: change.Name, typeText: change.Type, defaultText: change.Default}
+		if change.From != "" {
+			param.old = byName[change.From]
+			switch {
+			case param.old == nil || param.old.name == "_":
+				return fmt.Errorf("%v has no parameter %v", funcName, change.From)
+			case param.old.kept:
+				return fmt.Errorf("Parameter %v is listed twice", change.From)
+			case param.old.variadic && i != len(params)-1:
+				return fmt.Errorf("The variadic parameter %v must stay last", change.From)
+			}
+			param.old.kept = true
+			if param.name == "" {
+				param.name = change.From
+			}
+			param.old.newName = param.name
+			param.typeText = param.old.typeText
+		} else if param.name == "" || param.typeText == "" || param.defaultText == "" {
+			return fmt.Errorf("New parameters need a name, a type and a default argument")
+		}
+		if !token.IsIdentifier(param.name) {
+			return fmt.Errorf("%v is not a valid identifier", param.name)
+		}
+		if names[param.name] && param.name != "_" {
+			return fmt.Errorf("Two parameters are named %v", param.name)
+		}
+		names[param.name] = true
+		changer.newParams = append(changer.newParams, param)
+	}
+	return nil
+}
+
+// changeDeclaration rewrites the parameter list of the function and renames
+// the parameters in its body.
+func (changer *signatureChanger) changeDeclaration() {
+	renamed := make(map[types.Object]*oldParam)
+	for _, param := range changer.oldParams {
+		if !param.kept {
+			if param.variadic {
+				changer.problem(changer.funcDecl.Type.Params.Pos(), "The variadic parameter %v cannot be removed", param.name)
+			}
+			if changer.isUsedInBody(param.object) {
+				changer.problem(param.object.Pos(), "%v is used in the body of %v and cannot be removed", param.name, changer.funcDecl.Name.Name)
+			}
+		} else if param.newName != param.name {
+			renamed[param.object] = param
+		}
+	}
+	for _, param := range changer.newParams {
+		if param.old != nil && param.old.newName == param.old.name {
+			continue
+		}
+		// The new name must not refer to anything else in the function
+		// already, except to parameters that are renamed themselves.
+		ast.Inspect(changer.funcDecl, func(node ast.Node) bool {
+			ident, isIdent := node.(*ast.Ident)
+			if !isIdent || ident.Name != param.name || ident == changer.funcDecl.Name {
+				return true
+			}
+			object := changer.info.ObjectOf(ident)
+			if param.old != nil && object == param.old.object {
+				return true
+			}
+			for _, old := range changer.oldParams {
+				if old.object == object && (old.newName != old.name || !old.kept) {
+					return true
+				}
+			}
+			changer.problem(ident.Pos(), "%v already refers to something else in %v", param.name, changer.funcDecl.Name.Name)
+			return false
+		})
+	}
+
+	changer.edit(changer.funcDecl.Type.Params.Opening+1, changer.funcDecl.Type.Params.Closing, func() string {
+		var fields []string
+		for i, param := range changer.newParams {
+			if i > 0 && param.typeText == changer.newParams[i-1].typeText {
+				fields[len(fields)-1] = strings.TrimSuffix(fields[len(fields)-1], " "+param.typeText) + ", " + param.name + " " + param.typeText
+			} else {
+				fields = append(fields, param.name+" "+param.typeText)
+			}
+		}
+		return strings.Join(fields, ", ")
+	})
+	if changer.funcDecl.Body != nil {
+		ast.Inspect(changer.funcDecl.Body, func(node ast.Node) bool {
+			if ident, isIdent := node.(*ast.Ident); isIdent {
+				if param, isRenamed := renamed[changer.info.Uses[ident]]; isRenamed {
+					changer.edit(ident.Pos(), ident.End(), func() string { return param.newName })
+				}
+			}
+			return true
+		})
+	}
+}
+
+func (changer *signatureChanger) isUsedInBody(object types.Object) bool {
+	used := false
+	if changer.funcDecl.Body != nil {
+		ast.Inspect(changer.funcDecl.Body, func(node ast.Node) bool {
+			if ident, isIdent := node.(*ast.Ident); isIdent && changer.info.Uses[ident] == object {
+				used = true
+			}
+			return !used
+		})
+	}
+	return used
+}
+
+// changeUses changes the arguments of all calls of the function in file and
+// wraps all other uses in a function literal with the old signature.
+func (changer *signatureChanger) changeUses(file *ast.File) {
+	funcObject := changer.info.Defs[changer.funcDecl.Name]
+	called := make(map[*ast.Ident]bool)
+	ast.Inspect(file, func(node ast.Node) bool {
+		call, isCall := node.(*ast.CallExpr)
+		if !isCall {
+			return true
+		}
+		var ident *ast.Ident
+		switch fun := astutil.Unparen(call.Fun).(type) {
+		case *ast.Ident:
+			ident = fun
+		case *ast.SelectorExpr:
+			if selection := changer.info.Selections[fun]; selection == nil || selection.Kind() != types.MethodExpr {
+				ident = fun.Sel
+			}
+		}
+		if ident != nil && changer.info.Uses[ident] == funcObject {
+			called[ident] = true
+			changer.changeCall(call)
+		}
+		return true
+	})
+	ast.Inspect(file, func(node ast.Node) bool {
+		ident, isIdent := node.(*ast.Ident)
+		if !isIdent || changer.info.Uses[ident] != funcObject || called[ident] {
+			return true
+		}
+		path, _ := astutil.PathEnclosingInterval(file, ident.Pos(), ident.End())
+		var value ast.Expr = ident
+		if selector, isSelector := path[1].(*ast.SelectorExpr); isSelector && selector.Sel == ident {
+			if selection := changer.info.Selections[selector]; selection != nil && selection.Kind() == types.MethodExpr {
+				changer.problem(selector.Pos(), "Method expressions of %v are not supported", changer.funcDecl.Name.Name)
+				return true
+			}
+			if selection := changer.info.Selections[selector]; selection != nil && len(selection.Index()) > 1 {
+				changer.problem(selector.Pos(), "Method values of the promoted method %v are not supported", changer.funcDecl.Name.Name)
+				return true
+			}
+			value = selector
+		}
+		changer.edit(value.Pos(), value.End(), func() string { return changer.adapterFor(value) })
+		return true
+	})
+}
+
+func (changer *signatureChanger) changeCall(call *ast.CallExpr) {
+	numParams := len(changer.oldParams)
+	variadic := numParams > 0 && changer.oldParams[numParams-1].variadic
+	if !variadic && len(call.Args) != numParams || variadic && len(call.Args) < numParams-1 {
+		changer.problem(call.Pos(), "The arguments of the call cannot be assigned to the parameters")
+		return
+	}
+	args := make(map[*oldParam][]ast.Expr)
+	for i, arg := range call.Args {
+		if i >= numParams-1 && variadic {
+			args[changer.oldParams[numParams-1]] = append(args[changer.oldParams[numParams-1]], arg)
+		} else {
+			args[changer.oldParams[i]] = []ast.Expr{arg}
+		}
+	}
+	for _, param := range changer.oldParams {
+		if !param.kept && len(args[param]) != 0 && callsFunction(args[param][0], changer.info) {
+			changer.problem(args[param][0].Pos(), "The argument for the removed parameter %v has side effects", param.name)
+		}
+	}
+	lastCall := token.NoPos
+	for _, param := range changer.newParams {
+		if param.old == nil || len(args[param.old]) == 0 || !callsFunction(args[param.old][0], changer.info) {
+			continue
+		}
+		if args[param.old][0].Pos() < lastCall {
+			changer.problem(args[param.old][0].Pos(), "Reordering the arguments changes the order of the calls in them")
+		}
+		lastCall = args[param.old][0].Pos()
+	}
+	changer.edit(call.Lparen+1, call.Rparen, func() string {
+		var texts []string
+		for _, param := range changer.newParams {
+			if param.old == nil {
+				texts = append(texts, param.defaultText)
+				continue
+			}
+			for _, arg := range args[param.old] {
+				texts = append(texts, changer.nodeText(arg))
+			}
+		}
+		text := strings.Join(texts, ", ")
+		if call.Ellipsis.IsValid() {
+			text += "..."
+		}
+		return text
+	})
+}
+
+// adapterFor returns a function literal with the old signature that calls
+// value with the new one. The receiver of a method value is evaluated where
+// the method value was, so it is passed to an enclosing function literal.
+func (changer *signatureChanger) adapterFor(value ast.Expr) string {
+	recvName := "recv"
+	for i := 2; changer.hasOldParamNamed(recvName); i++ {
+		recvName = "recv" + strconv.Itoa(i)
+	}
+	var params []string
+	for _, param := range changer.oldParams {
+		name := param.name
+		if !param.kept {
+			name = "_"
+		}
+		params = append(params, name+" "+param.typeText)
+	}
+	var args []string
+	for _, param := range changer.newParams {
+		switch {
+		case param.old == nil:
+			args = append(args, param.defaultText)
+		case param.old.variadic:
+			args = append(args, param.old.name+"...")
+		default:
+			args = append(args, param.old.name)
+		}
+	}
+	results := ""
+	if changer.funcDecl.Type.Results != nil {
+		results = " " + changer.originalText(changer.funcDecl.Type.Results)
+	}
+	selector, isSelector := value.(*ast.SelectorExpr)
+	callee := changer.funcDecl.Name.Name
+	if isSelector {
+		callee = recvName + "." + callee
+	}
+	body := callee + "(" + strings.Join(args, ", ") + ")"
+	if results != "" {
+		body = "return " + body
+	}
+	funcType := "func(" + strings.Join(params, ", ") + ")" + results
+	if !isSelector {
+		return funcType + " { " + body + " }"
+	}
+	recvType := changer.funcDecl.Recv.List[0].Type
+	recvArg := changer.nodeText(selector.X)
+	switch recvIsPointer := isPointer(changer.info.TypeOf(selector.X)); {
+	case isPointer(changer.info.TypeOf(recvType)) && !recvIsPointer:
+		recvArg = "&" + recvArg
+	case !isPointer(changer.info.TypeOf(recvType)) && recvIsPointer:
+		recvArg = "*" + recvArg
+	}
+	return "func(" + recvName + " " + changer.originalText(recvType) + ") " + funcType + " {\nreturn " + funcType + " { " + body + " }\n}(" + recvArg + ")"
+}
+
+func (changer *signatureChanger) hasOldParamNamed(name string) bool {
+	for _, param := range changer.oldParams {
+		if param.name == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,201 @@
+package goextract_test
+
+import (
+	. "github.com/petergtz/goextract"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ChangeSignature", func() {
+	pkg := newTempPackage("goextract-signature", map[string]string{
+		"a.go": `package p
+
+func scale(value int, factor int, unit string) int {
+	if value > 100 {
+		return scale(value/2, factor, "") * 2
+	}
+	return value * factor
+}
+`,
+		"b.go": `package p
+
+var op func(int, int, string) int = scale
+
+func g() int {
+	return scale(1, 2, "m")
+}
+`,
+	})
+
+	It("reorders, renames, removes and adds parameters and updates all uses", func() {
+		result, err := ChangeSignature(pkg.path("a.go"), "scale", []ParamChange{
+			{From: "factor", Name: "f"},
+			{From: "value"},
+			{Name: "offset", Type: "int", Default: "0"},
+		}, Options{})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Changes).To(HaveLen(2))
+		Expect(result.Changes[0].Modified).To(Equal(`package p
+
+func scale(f, value, offset int) int {
+	if value > 100 {
+		return scale(f, value/2, 0) * 2
+	}
+	return value * f
+}
+`))
+		Expect(result.Changes[1].Modified).To(Equal(`package p
+
+var op func(int, int, string) int = func(value int, factor int, _ string) int { return scale(factor, value, 0) }
+
+func g() int {
+	return scale(2, 1, 0)
+}
+`))
+	})
+
+	It("refuses to remove parameters still used", func() {
+		_, err := ChangeSignature(pkg.path("a.go"), "scale", []ParamChange{{From: "value"}}, Options{})
+
+		Expect(err).To(MatchError(ContainSubstring("factor is used in the body of scale and cannot be removed")))
+	})
+
+	It("refuses new names already referring to something else", func() {
+		_, err := ChangeSignature(pkg.path("a.go"), "scale", []ParamChange{{From: "value", Name: "scale"}, {From: "factor"}}, Options{})
+
+		Expect(err).To(MatchError(ContainSubstring("scale already refers to something else in scale")))
+	})
+
+	It("binds the receiver of method values where they are taken", func() {
+		pkg.writeFile("c.go", `package p
+
+type counter struct{ n int }
+
+func (c counter) add(delta int, label string) int { return c.n + delta }
+
+func h() int {
+	c := counter{1}
+	f := c.add
+	c = counter{100}
+	return f(1, "x")
+}
+`)
+
+		result, err := ChangeSignature(pkg.path("c.go"), "counter.add", []ParamChange{{From: "delta"}}, Options{})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Changes[0].Modified).To(ContainSubstring(`	f := func(recv counter) func(delta int, _ string) int {
+		return func(delta int, _ string) int { return recv.add(delta) }
+	}(c)
+	c = counter{100}
+`))
+	})
+
+	It("refuses exported functions, whose uses in other packages would break", func() {
+		pkg.writeFile("c.go", `package p
+
+func Scale(value int, factor int) int { return value * factor }
+`)
+
+		_, err := ChangeSignature(pkg.path("c.go"), "Scale", []ParamChange{{From: "factor"}, {From: "value"}}, Options{})
+
+		Expect(err).To(MatchError(ContainSubstring("Scale is exported, so its uses in other packages could not be updated")))
+	})
+
+	It("refuses method expressions, which cannot be wrapped", func() {
+		pkg.writeFile("c.go", `package p
+
+type counter struct{ n int }
+
+func (c counter) add(delta int, label string) int { return c.n + delta }
+
+var add = counter.add
+`)
+
+		_, err := ChangeSignature(pkg.path("c.go"), "counter.add", []ParamChange{{From: "delta"}}, Options{})
+
+		Expect(err).To(MatchError(ContainSubstring("Method expressions of add are not supported")))
+	})
+
+	It("refuses method values of promoted methods", func() {
+		pkg.writeFile("c.go", `package p
+
+type counter struct{ n int }
+
+func (c counter) add(delta int, label string) int { return c.n + delta }
+
+type labeled struct{ counter }
+
+func h(l labeled) func(int, string) int {
+	return l.add
+}
+`)
+
+		_, err := ChangeSignature(pkg.path("c.go"), "counter.add", []ParamChange{{From: "delta"}}, Options{})
+
+		Expect(err).To(MatchError(ContainSubstring("Method values of the promoted method add are not supported")))
+	})
+
+	It("refuses calls passing the results of another call", func() {
+		pkg.writeFile("c.go", `package p
+
+func triple() (int, int, string) { return 1, 2, "m" }
+
+func h() int {
+	return scale(triple())
+}
+`)
+
+		_, err := ChangeSignature(pkg.path("a.go"), "scale", []ParamChange{{From: "factor"}, {From: "value"}}, Options{})
+
+		Expect(err).To(MatchError(ContainSubstring("The arguments of the call cannot be assigned to the parameters")))
+	})
+
+	It("updates the calls in the test files of the package", func() {
+		pkg.writeFile("a_test.go", `package p
+
+import "testing"
+
+func TestScale(t *testing.T) {
+	if scale(1, 2, "m") != 2 {
+		t.Fail()
+	}
+}
+`)
+
+		result, err := ChangeSignature(pkg.path("a.go"), "scale", []ParamChange{{From: "factor"}, {From: "value"}}, Options{})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Changes).To(HaveLen(3))
+		Expect(result.Changes[1].Filename).To(Equal(pkg.path("a_test.go")))
+		Expect(result.Changes[1].Modified).To(ContainSubstring(`if scale(2, 1) != 2 {`))
+	})
+
+	It("refuses functions used by the external test package", func() {
+		pkg.writeFile("go.mod", "module example.com/p\n")
+		pkg.writeFile("c.go", `package p
+
+func Scale(value int, factor int) int { return value * factor }
+`)
+		pkg.writeFile("c_test.go", `package p_test
+
+import (
+	"testing"
+
+	"example.com/p"
+)
+
+func TestScale(t *testing.T) {
+	if p.Scale(1, 2) != 2 {
+		t.Fail()
+	}
+}
+`)
+
+		_, err := ChangeSignature(pkg.path("c.go"), "Scale", []ParamChange{{From: "factor"}, {From: "value"}}, Options{})
+
+		Expect(err).To(MatchError(ContainSubstring("Scale is used by the external test package p_test, whose uses could not be updated")))
+	})
+})
@@ -0,0 +1,430 @@
+package goextract
+
+import (
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"sort"
+	"strings"
+
+	"github.com/petergtz/goextract/util"
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// ExtractSlice extracts the statements computing the value of the variable at
+// position into a function returning it. These statements, the backward slice
+// of the variable, need not be contiguous: statements in between that don't
+// contribute to the value stay where they are.
+func ExtractSlice(filename string, src string, position Position, funcName string, options Options) (*Result, error) {
+	if _, err := parser.ParseFile(token.NewFileSet(), filename, src, parser.ParseComments); err != nil {
+		return &Result{}, err
+	}
+	checker := newPackageChecker(filename, options)
+	checked := checker.check(src, parser.ParseComments)
+	fileSet, astFile := checked.fileSet, checked.astFile
+
+	slicer, err := newSlicer(fileSet, astFile, checked.info, checked.pkg, position)
+	if err != nil {
+		return &Result{}, err
+	}
+	slicer.computeSlice()
+	if problems := slicer.problems(); len(problems) != 0 {
+		return &Result{}, &ValidationError{Problems: problems}
+	}
+	selection := slicer.selection()
+	if funcName == "" {
+		funcName = "compute" + exported(slicer.target.Name())
+		if !options.ExportSuggestedName {
+			funcName = unexported(funcName)
+		}
+		options.UniqueName = true
+	}
+	funcName, err = uniqueFunctionName(checker, src, selection, funcName, options)
+	if err != nil {
+		return &Result{}, err
+	}
+	formatted, err := format.Source([]byte(slicer.extract(src, funcName)))
+	util.PanicOnError(err)
+	arranged, warnings := arrangeParams(filename, string(formatted), funcName, options.ParamOrder)
+	if options.NamedResults {
+		arranged = nameResults(checker, arranged, funcName)
+	}
+	if options.DocTemplate != "" {
+		arranged, err = addDocComment(arranged, funcName, options.DocTemplate)
+		if err != nil {
+			return &Result{Warnings: warnings}, err
+		}
+	}
+	changes, placedFuncName, err := place(filename, src, arranged, selection, enclosingDeclIndex(fileSet, astFile, selection), funcName, options)
+	if err != nil {
+		return &Result{Warnings: warnings}, err
+	}
+	funcChange := changes[len(changes)-1]
+	typeErrors := checkTypes(checker, src, changes[0].Modified, selection, changes[1:])
+	if len(typeErrors) != 0 && !options.Force {
+		return &Result{Warnings: warnings}, &TypeCheckError{Problems: typeErrors}
+	}
+	return &Result{
+		Changes:  changes,
+		Warnings: append(warnings, typeErrors...),
+		Function: functionInfoFrom(funcChange.Filename, funcChange.Modified, placedFuncName),
+	}, nil
+}
+
+// slicer computes the backward slice of target in the statement list that
+// declares it, up to the statement at index use.
+type slicer struct {
+	fileSet *token.FileSet
+	info    *types.Info
+	pkg     *types.Package
+	target  *types.Var
+	body    *ast.BlockStmt
+	stmts   []ast.Stmt
+	use     int
+	sliced  []bool
+}
+
+func newSlicer(fileSet *token.FileSet, astFile *ast.File, info *types.Info, pkg *types.Package, position Position) (*slicer, error) {
+	tokenFile := fileSet.File(astFile.Pos())
+	if position.Line < 1 || position.Line > tokenFile.LineCount() {
+		return nil, fmt.Errorf("Line %v is outside of the file", position.Line)
+	}
+	pos := tokenFile.LineStart(position.Line) + token.Pos(position.Column-1)
+	path, _ := astutil.PathEnclosingInterval(astFile, pos, pos)
+	ident, isIdent := path[0].(*ast.Ident)
+	if !isIdent {
+		return nil, fmt.Errorf("There is no variable at %v", fileSet.Position(pos))
+	}
+	target, isVar := info.ObjectOf(ident).(*types.Var)
+	if !isVar || target.IsField() || target.Parent() == nil || target.Parent() == pkg.Scope() {
+		return nil, fmt.Errorf("%v is not a local variable", ident.Name)
+	}
+	slicer := &slicer{fileSet: fileSet, info: info, pkg: pkg, target: target}
+	for i, node := range path {
+		switch typedNode := node.(type) {
+		case *ast.FuncDecl:
+			slicer.body = typedNode.Body
+		case *ast.FuncLit:
+			slicer.body = typedNode.Body
+		}
+		if slicer.body != nil {
+			break
+		}
+		// The slice is taken from the innermost statement list that
+		// declares the target or, for parameters, from the function body.
+		if stmts := stmtListOf(node); slicer.stmts == nil && stmts != nil && i > 0 &&
+			(node.Pos() <= target.Pos() && target.Pos() < node.End() || isFuncBody(node, path[i+1:])) {
+			slicer.stmts = stmts
+			for j, stmt := range stmts {
+				if stmt == path[i-1] {
+					slicer.use = j
+				}
+			}
+		}
+	}
+	if slicer.body == nil || slicer.stmts == nil {
+		return nil, fmt.Errorf("%v is not declared in the function using it", ident.Name)
+	}
+	return slicer, nil
+}
+
+func isFuncBody(node ast.Node, parents []ast.Node) bool {
+	if len(parents) == 0 {
+		return false
+	}
+	switch parent := parents[0].(type) {
+	case *ast.FuncDecl:
+		return parent.Body == node
+	case *ast.FuncLit:
+		return parent.Body == node
+	}
+	return false
+}
+
+// computeSlice marks every statement before the use that writes a variable
+// the target depends on. The variables such a statement reads become
+// dependencies themselves.
+func (slicer *slicer) computeSlice() {
+	relevant := map[types.Object]bool{slicer.target: true}
+	slicer.sliced = make([]bool, slicer.use)
+	for i := slicer.use - 1; i >= 0; i-- {
+		for object := range slicer.writtenBy(slicer.stmts[i]) {
+			if relevant[object] {
+				slicer.sliced[i] = true
+			}
+		}
+		if slicer.sliced[i] {
+			for object := range slicer.readBy(slicer.stmts[i]) {
+				relevant[object] = true
+			}
+		}
+	}
+}
+
+// localVarOf returns the local variable expr is rooted in, e.g. v for v.f[i].
+func (slicer *slicer) localVarOf(expr ast.Expr) *types.Var {
+	for {
+		switch typedExpr := expr.(type) {
+		case *ast.Ident:
+			variable, isVar := slicer.info.ObjectOf(typedExpr).(*types.Var)
+			if isVar && !variable.IsField() && variable.Parent() != nil && variable.Parent() != slicer.pkg.Scope() {
+				return variable
+			}
+			return nil
+		case *ast.SelectorExpr:
+			expr = typedExpr.X
+		case *ast.IndexExpr:
+			expr = typedExpr.X
+		case *ast.StarExpr:
+			expr = typedExpr.X
+		case *ast.ParenExpr:
+			expr = typedExpr.X
+		default:
+			return nil
+		}
+	}
+}
+
+// writtenBy returns the local variables node assigns or might change through
+// a method call or by passing a reference to them.
+func (slicer *slicer) writtenBy(node ast.Node) map[types.Object]bool {
+	written := make(map[types.Object]bool)
+	write := func(expr ast.Expr) {
+		if variable := slicer.localVarOf(expr); variable != nil {
+			written[variable] = true
+		}
+	}
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch typedNode := n.(type) {
+		case *ast.AssignStmt:
+			for _, lhs := range typedNode.Lhs {
+				write(lhs)
+			}
+		case *ast.IncDecStmt:
+			write(typedNode.X)
+		case *ast.RangeStmt:
+			if typedNode.Key != nil {
+				write(typedNode.Key)
+			}
+			if typedNode.Value != nil {
+				write(typedNode.Value)
+			}
+		case *ast.ValueSpec:
+			for _, name := range typedNode.Names {
+				write(name)
+			}
+		case *ast.UnaryExpr:
+			if typedNode.Op == token.AND {
+				write(typedNode.X)
+			}
+		case *ast.CallExpr:
+			if selector, isSelector := typedNode.Fun.(*ast.SelectorExpr); isSelector {
+				if selection := slicer.info.Selections[selector]; selection != nil && selection.Kind() == types.MethodVal {
+					write(selector.X)
+				}
+			}
+			for _, arg := range typedNode.Args {
+				if isReference(slicer.info.TypeOf(arg)) {
+					write(arg)
+				}
+			}
+		}
+		return true
+	})
+	return written
+}
+
+func isReference(typ types.Type) bool {
+	if typ == nil {
+		return false
+	}
+	switch typ.Underlying().(type) {
+	case *types.Pointer, *types.Slice, *types.Map, *types.Chan:
+		return true
+	}
+	return false
+}
+
+// readBy returns the local variables node uses.
+func (slicer *slicer) readBy(node ast.Node) map[types.Object]bool {
+	read := make(map[types.Object]bool)
+	ast.Inspect(node, func(n ast.Node) bool {
+		if ident, isIdent := n.(*ast.Ident); isIdent {
+			if variable := slicer.localVarOf(ident); variable != nil && slicer.info.Uses[ident] != nil {
+				read[variable] = true
+			}
+		}
+		return true
+	})
+	return read
+}
+
+func (slicer *slicer) slicedStmts() (stmts []ast.Stmt) {
+	for i, sliced := range slicer.sliced {
+		if sliced {
+			stmts = append(stmts, slicer.stmts[i])
+		}
+	}
+	return
+}
+
+func (slicer *slicer) isInSlice(pos token.Pos) bool {
+	for _, stmt := range slicer.slicedStmts() {
+		if stmt.Pos() <= pos && pos < stmt.End() {
+			return true
+		}
+	}
+	return false
+}
+
+// problems returns the reasons why the slice cannot be moved into a function
+// that is called where its last statement is.
+func (slicer *slicer) problems() (problems []Problem) {
+	problem := func(pos token.Pos, format string, args ...interface{}) {
+		problems = append(problems, Problem{Rule: "slice", Position: slicer.fileSet.Position(pos), Message: fmt.Sprintf(format, args...)})
+	}
+	stmts := slicer.slicedStmts()
+	if len(stmts) == 0 {
+		problem(slicer.stmts[slicer.use].Pos(), "No statement computes %v before it is used here", slicer.target.Name())
+		return
+	}
+	callPos := stmts[len(stmts)-1].Pos()
+	written := make(map[types.Object]bool)
+	lineOf := func(pos token.Pos) int { return slicer.fileSet.Position(pos).Line }
+	for i, sliced := range slicer.sliced {
+		if sliced && (i > 0 && lineOf(slicer.stmts[i-1].End()) == lineOf(slicer.stmts[i].Pos()) ||
+			lineOf(slicer.stmts[i].End()) == lineOf(slicer.stmts[i+1].Pos())) {
+			problem(slicer.stmts[i].Pos(), "The statement shares its line with another one")
+		}
+	}
+	for _, stmt := range stmts {
+		if !leavesOnlyAtEnd([]ast.Node{stmt}) {
+			problem(stmt.Pos(), "Control can leave the statement early, so it cannot be moved into a function")
+		}
+		ast.Inspect(stmt, func(n ast.Node) bool {
+			switch n.(type) {
+			case *ast.FuncLit:
+				return false
+			case *ast.DeferStmt:
+				problem(n.Pos(), "The deferred call would run when the extracted function returns")
+			case *ast.GoStmt:
+				problem(n.Pos(), "The go statement cannot be moved into a function")
+			}
+			return true
+		})
+		for object := range slicer.writtenBy(stmt) {
+			written[object] = true
+		}
+	}
+	ast.Inspect(slicer.body, func(n ast.Node) bool {
+		ident, isIdent := n.(*ast.Ident)
+		if !isIdent || slicer.isInSlice(ident.Pos()) {
+			return true
+		}
+		if object := slicer.info.Uses[ident]; written[object] && (object != slicer.target || ident.Pos() < callPos) {
+			problem(ident.Pos(), "%v is also changed by the statements computing %v", ident.Name, slicer.target.Name())
+		}
+		return true
+	})
+	for i, sliced := range slicer.sliced {
+		if !sliced {
+			continue
+		}
+		read := slicer.readBy(slicer.stmts[i])
+		for j := i + 1; j < len(slicer.sliced) && slicer.stmts[j].Pos() < callPos; j++ {
+			if slicer.sliced[j] {
+				continue
+			}
+			for object := range slicer.writtenBy(slicer.stmts[j]) {
+				if read[object] {
+					problem(slicer.stmts[j].Pos(), "%v is changed after the statement at line %v uses it", object.Name(), slicer.fileSet.Position(slicer.stmts[i].Pos()).Line)
+				}
+			}
+			if callsFunction(slicer.stmts[i], slicer.info) && callsFunction(slicer.stmts[j], slicer.info) {
+				problem(slicer.stmts[j].Pos(), "Moving the statement at line %v past this one changes the order of function calls", slicer.fileSet.Position(slicer.stmts[i].Pos()).Line)
+			}
+		}
+	}
+	return
+}
+
+// callsFunction reports whether node calls anything but builtins and
+// conversions, which might have side effects.
+func callsFunction(node ast.Node, info *types.Info) bool {
+	calls := false
+	ast.Inspect(node, func(n ast.Node) bool {
+		if call, isCall := n.(*ast.CallExpr); isCall {
+			typeAndValue := info.Types[call.Fun]
+			calls = calls || !(typeAndValue.IsBuiltin() || typeAndValue.IsType())
+		}
+		return !calls
+	})
+	return calls
+}
+
+func (slicer *slicer) selection() Selection {
+	stmts := slicer.slicedStmts()
+	begin, end := slicer.fileSet.Position(stmts[0].Pos()), slicer.fileSet.Position(stmts[len(stmts)-1].End())
+	return Selection{Position{begin.Line, begin.Column}, Position{end.Line, end.Column}}
+}
+
+// extract removes the sliced statements from src, calls funcName in place of
+// the last one and appends funcName to src.
+func (slicer *slicer) extract(src string, funcName string) string {
+	stmts := slicer.slicedStmts()
+	declaredInSlice := make(map[types.Object]bool)
+	for _, stmt := range stmts {
+		ast.Inspect(stmt, func(n ast.Node) bool {
+			if ident, isIdent := n.(*ast.Ident); isIdent && slicer.info.Defs[ident] != nil {
+				declaredInSlice[slicer.info.Defs[ident]] = true
+			}
+			return true
+		})
+	}
+	params := make(map[string]types.Type)
+	for _, stmt := range stmts {
+		for object := range slicer.readBy(stmt) {
+			if !declaredInSlice[object] {
+				params[object.Name()] = object.Type()
+			}
+		}
+	}
+	qualifier := func(other *types.Package) string {
+		if other == slicer.pkg {
+			return ""
+		}
+		return other.Name()
+	}
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	paramList := make([]string, len(names))
+	for i, name := range names {
+		paramList[i] = name + " " + types.TypeString(params[name], qualifier)
+	}
+
+	assign := " = "
+	if declaredInSlice[slicer.target] {
+		assign = " := "
+	}
+	call := slicer.target.Name() + assign + funcName + "(" + strings.Join(names, ", ") + ")"
+	var body []string
+	modified := src
+	for i := len(stmts) - 1; i >= 0; i-- {
+		begin := lineBeginOf(src, slicer.fileSet.Position(stmts[i].Pos()).Offset)
+		end := lineEndOf(src, slicer.fileSet.Position(stmts[i].End()).Offset)
+		body = append([]string{src[begin:end]}, body...)
+		if i == len(stmts)-1 {
+			modified = modified[:begin] + call + "\n" + modified[end:]
+		} else {
+			modified = modified[:begin] + modified[end:]
+		}
+	}
+	return strings.TrimRight(modified, "\n") + "\n\nfunc " + funcName + "(" + strings.Join(paramList, ", ") + ") " +
+		types.TypeString(slicer.target.Type(), qualifier) + " {\n" + strings.Join(body, "") + "return " + slicer.target.Name() + "\n}\n"
+}
@@ -0,0 +1,118 @@
+package goextract_test
+
+import (
+	. "github.com/petergtz/goextract"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("ExtractSlice", func() {
+	src := `package p
+
+import "fmt"
+
+func report(items []int, names []string) {
+	total := 0
+	var labels []string
+	for _, item := range items {
+		total += item
+	}
+	for _, name := range names {
+		labels = append(labels, "<"+name+">")
+	}
+	average := total / len(items)
+	fmt.Println(labels)
+	fmt.Println(average)
+}
+`
+
+	It("extracts only the statements computing the variable", func() {
+		result, err := ExtractSlice("", src, Position{16, 14}, "", Options{})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Function.Name).To(Equal("computeAverage"))
+		Expect(result.Changes[0].Modified).To(Equal(`package p
+
+import "fmt"
+
+func report(items []int, names []string) {
+	var labels []string
+	for _, name := range names {
+		labels = append(labels, "<"+name+">")
+	}
+	average := computeAverage(items)
+	fmt.Println(labels)
+	fmt.Println(average)
+}
+
+func computeAverage(items []int) int {
+	total := 0
+	for _, item := range items {
+		total += item
+	}
+	average := total / len(items)
+	return average
+}
+`))
+	})
+
+	It("separates interleaved computations", func() {
+		result, err := ExtractSlice("", src, Position{15, 14}, "decorate", Options{})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(result.Changes[0].Modified).To(ContainSubstring(`	for _, item := range items {
+		total += item
+	}
+	labels := decorate(names)
+	average := total / len(items)
+`))
+	})
+
+	It("refuses to move statements whose other effects are used elsewhere", func() {
+		_, err := ExtractSlice("", `package p
+
+func f(items []int) {
+	count := 0
+	total := 0
+	for _, item := range items {
+		total += item
+		count++
+	}
+	println(count)
+	println(total)
+}
+`, Position{11, 10}, "", Options{})
+
+		Expect(err).To(MatchError(ContainSubstring("count is also changed by the statements computing total")))
+	})
+
+	It("refuses to reorder function calls", func() {
+		_, err := ExtractSlice("", `package p
+
+func f(read func() int) {
+	a := read()
+	b := read()
+	c := a * 2
+	println(c, b)
+}
+`, Position{7, 10}, "", Options{})
+
+		Expect(err).To(MatchError(ContainSubstring("changes the order of function calls")))
+	})
+
+	It("refuses to move deferred calls", func() {
+		_, err := ExtractSlice("", `package p
+
+func f(items []int) {
+	total := 0
+	for _, item := range items {
+		defer func() { total += item }()
+	}
+	println(total)
+}
+`, Position{8, 10}, "", Options{})
+
+		Expect(err).To(MatchError(ContainSubstring("The deferred call would run when the extracted function returns")))
+	})
+})
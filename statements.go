@@ -1,6 +1,7 @@
-package main
+package goextract
 
 import (
+	"errors"
 	"fmt"
 	"go/ast"
 	"go/token"
@@ -40,7 +41,8 @@ func (visitor *astNodeVisitorForMultipleStatements) Visit(node ast.Node) (w ast.
 		if visitor.context.shouldRecord && visitor.context.posParent == visitor.parentNode {
 			visitor.context.nodesToExtract = append(visitor.context.nodesToExtract, node)
 		}
-		if visitor.context.fset.Position(node.End()).Line == visitor.context.selection.End.Line &&
+		if visitor.context.shouldRecord &&
+			visitor.context.fset.Position(node.End()).Line == visitor.context.selection.End.Line &&
 			visitor.context.fset.Position(node.End()).Column == visitor.context.selection.End.Column {
 			// fmt.Println("Ending with node at pos", visitor.context.fset.Position(node.Pos()), "and end", visitor.context.fset.Position(node.End()))
 			// ast.Print(visitor.context.fset, node)
@@ -57,23 +59,19 @@ func (visitor *astNodeVisitorForMultipleStatements) Visit(node ast.Node) (w ast.
 	}
 }
 
-func matchMultipleStmts(fileSet *token.FileSet, astFile *ast.File, selection Selection) ([]ast.Node, ast.Node) {
+func matchMultipleStmts(fileSet *token.FileSet, astFile *ast.File, selection Selection) ([]ast.Node, ast.Node, error) {
 	v := &astNodeVisitorForMultipleStatements{parentNode: nil, context: &multipleStatementVisitorContext{fset: fileSet, selection: selection}}
 	ast.Walk(v, astFile)
-	if v.context.posParent != v.context.endParent {
-		panic(fmt.Sprintf("Selection is not valid. posParent: %v; endParent: %v",
-			v.context.posParent, v.context.endParent))
+	if v.context.posParent == nil || v.context.posParent != v.context.endParent {
+		return nil, nil, errors.New("Selection is not valid: it must be an expression or consist of complete statements of the same block")
 	}
-	if v.context.posParent == nil {
-		panic(fmt.Sprintf("Selection is not valid. posParent: %v; endParent: %v",
-			v.context.posParent, v.context.endParent))
-	}
-	return v.context.nodesToExtract, v.context.posParent
+	return v.context.nodesToExtract, v.context.posParent, nil
 }
 
 func extractMultipleStatementsAsFunc(
 	astFile *ast.File,
 	fileSet *token.FileSet,
+	lineLengths []int,
 	stmtsToExtract []ast.Node,
 	parentNode ast.Node,
 	extractedFuncName string) {
@@ -91,10 +89,10 @@ func extractMultipleStatementsAsFunc(
 		allStmts,
 		indexOfExtractedStmt, len(stmtsToExtract))
 
-	areaRemoved := areaRemoved(fileSet, (stmtsToExtract)[0].Pos(), (stmtsToExtract)[len(stmtsToExtract)-1].End())
-	lineLengths := lineLengthsFrom(fileSet)
+	areaRemoved := areaRemoved(fileSet, lineLengths, (stmtsToExtract)[0].Pos(), (stmtsToExtract)[len(stmtsToExtract)-1].End())
 	lineNum, numLinesToCut, newLineLength := replacementModifications(fileSet, (stmtsToExtract)[0].Pos(), (stmtsToExtract)[len(stmtsToExtract)-1].End(), newStmt.End(), lineLengths, areaRemoved)
 
+	lastDeclEnd := astFile.End()
 	shiftPosesAfterPos(astFile, newStmt, (stmtsToExtract)[len(stmtsToExtract)-1].End(), newStmt.End()-stmtsToExtract[len(stmtsToExtract)-1].End())
 
 	multipleStmtFuncDecl := CopyNode(multipleStmtFuncDeclWith(
@@ -120,7 +118,8 @@ func extractMultipleStatementsAsFunc(
 	newFileSet.File(1).SetLines(ConvertLineLengthsToLineOffsets(lineLengths))
 	*fileSet = *newFileSet
 
-	moveComments(astFile, moveOffset /*, needs a range to restict which comments to move*/)
+	moveComments(astFile, stmtsToExtract[0].Pos(), stmtsToExtract[len(stmtsToExtract)-1].End(), lastDeclEnd,
+		moveOffset, newStmt.End()-stmtsToExtract[len(stmtsToExtract)-1].End())
 
 }
 
@@ -147,7 +146,7 @@ func funcCallStmt(varsUsedAfterwards map[string]*ast.Ident, extractedFuncName st
 		result = CopyNode(&ast.ExprStmt{X: callExprWith(extractedFuncName, params)}).(ast.Stmt)
 	} else {
 		result = CopyNode(&ast.AssignStmt{
-			Lhs: []ast.Expr{ast.NewIdent(namesOf(varsUsedAfterwards)[0])},
+			Lhs: exprsFrom(varsUsedAfterwards),
 			Tok: token.DEFINE,
 			Rhs: []ast.Expr{callExprWith(extractedFuncName, params)},
 		}).(ast.Stmt)
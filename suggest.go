@@ -0,0 +1,484 @@
+package goextract
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SuggestOptions determine which functions get extraction suggestions and
+// which extractions are suggested.
+type SuggestOptions struct {
+	// MaxLines is the number of lines from which on a function is too long.
+	MaxLines int
+	// MaxNesting is the depth of nested control statements from which on a
+	// function is too deeply nested.
+	MaxNesting int
+	// MaxParams is the maximum number of parameters of a suggested function.
+	MaxParams int
+}
+
+// DefaultSuggestOptions are the options used by goextract suggest by default.
+var DefaultSuggestOptions = SuggestOptions{MaxLines: 40, MaxNesting: 3, MaxParams: 4}
+
+// maxSuggestedResults is the maximum number of results of a suggested function.
+const maxSuggestedResults = 2
+
+// maxSuggestionsPerFunction limits the suggestions for a single function to
+// the best non-overlapping ones.
+const maxSuggestionsPerFunction = 3
+
+// Suggestion proposes to extract Selection from Function in Filename as a
+// function called Name with the given Signature.
+type Suggestion struct {
+	Filename  string
+	Function  string
+	Selection Selection
+	Name      string
+	// Signature is the parameter and result list, e.g. "(a, b int) error".
+	Signature string
+	// Lines and Nesting describe the function the selection is part of.
+	Lines   int
+	Nesting int
+	// Complexity is the cognitive complexity the extraction removes from
+	// Function.
+	Complexity int
+	// Score ranks the suggestion. It grows with the complexity and size of
+	// the selection and shrinks with the number of inputs and outputs.
+	Score int
+}
+
+func (suggestion Suggestion) String() string {
+	begin, end := suggestion.Selection.Begin, suggestion.Selection.End
+	return fmt.Sprintf("%v:%v:%v: %v has %v lines and nesting depth %v: extract %v:%v-%v:%v as %v%v, removing complexity %v",
+		suggestion.Filename, begin.Line, begin.Column,
+		suggestion.Function, suggestion.Lines, suggestion.Nesting,
+		begin.Line, begin.Column, end.Line, end.Column,
+		suggestion.Name, suggestion.Signature, suggestion.Complexity)
+}
+
+// Suggest finds extraction candidates in too long or too deeply nested
+// functions of the packages matched by patterns. Patterns are directories,
+// directories followed by "/..." for all packages below them, or Go files.
+// The suggestions are ordered from the best to the worst.
+func Suggest(patterns []string, options SuggestOptions) ([]Suggestion, error) {
+	dirs, onlyFiles, err := expandPatterns(patterns)
+	if err != nil {
+		return nil, err
+	}
+	var suggestions []Suggestion
+	for _, dir := range dirs {
+		buildPackage, err := build.ImportDir(dir, 0)
+		if _, noGo := err.(*build.NoGoError); noGo {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		fileSet := token.NewFileSet()
+		var files []*ast.File
+		for _, filename := range append(buildPackage.GoFiles, buildPackage.TestGoFiles...) {
+			file, err := parser.ParseFile(fileSet, filepath.Join(dir, filename), nil, 0)
+			if err != nil {
+				return nil, err
+			}
+			files = append(files, file)
+		}
+		info := &types.Info{
+			Defs: make(map[*ast.Ident]types.Object),
+			Uses: make(map[*ast.Ident]types.Object),
+		}
+		config := types.Config{Importer: newSourceImporter(fileSet, nil), Error: func(error) {}}
+		pkg, _ := config.Check(buildPackage.ImportPath, fileSet, files, info)
+		for _, file := range files {
+			filename := fileSet.Position(file.Pos()).Filename
+			if onlyFiles == nil || onlyFiles[absPath(filename)] {
+				suggestions = append(suggestions, suggestionsIn(fileSet, file, info, pkg, options)...)
+			}
+		}
+	}
+	sort.SliceStable(suggestions, func(i, j int) bool { return suggestions[i].Score > suggestions[j].Score })
+	return suggestions, nil
+}
+
+// expandPatterns returns the directories matched by patterns and, if
+// patterns contain files, those files.
+func expandPatterns(patterns []string) (dirs []string, onlyFiles map[string]bool, err error) {
+	seen := make(map[string]bool)
+	addDir := func(dir string) {
+		if !seen[dir] {
+			seen[dir] = true
+			dirs = append(dirs, dir)
+		}
+	}
+	for _, pattern := range patterns {
+		switch {
+		case strings.HasSuffix(pattern, ".go"):
+			if onlyFiles == nil {
+				onlyFiles = make(map[string]bool)
+			}
+			onlyFiles[absPath(pattern)] = true
+			addDir(filepath.Dir(pattern))
+		case pattern == "..." || strings.HasSuffix(pattern, "/..."):
+			root := strings.TrimSuffix(strings.TrimSuffix(pattern, "..."), "/")
+			if root == "" {
+				root = "."
+			}
+			err = filepath.Walk(root, func(path string, fileInfo os.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+				if !fileInfo.IsDir() {
+					return nil
+				}
+				name := fileInfo.Name()
+				if path != root && (strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "testdata" || name == "vendor") {
+					return filepath.SkipDir
+				}
+				addDir(path)
+				return nil
+			})
+			if err != nil {
+				return nil, nil, err
+			}
+		default:
+			addDir(pattern)
+		}
+	}
+	if onlyFiles != nil && len(onlyFiles) != len(patterns) {
+		return nil, nil, fmt.Errorf("Cannot mix files and packages")
+	}
+	return
+}
+
+// suggestionsIn finds extraction candidates in the functions of astFile.
+func suggestionsIn(fileSet *token.FileSet, astFile *ast.File, info *types.Info, pkg *types.Package, options SuggestOptions) (suggestions []Suggestion) {
+	for _, decl := range astFile.Decls {
+		funcDecl, isFuncDecl := decl.(*ast.FuncDecl)
+		if !isFuncDecl || funcDecl.Body == nil {
+			continue
+		}
+		lines := fileSet.Position(funcDecl.End()).Line - fileSet.Position(funcDecl.Pos()).Line + 1
+		nesting := 0
+		stmtListsIn(funcDecl.Body, 0, func(parent ast.Node, stmts []ast.Stmt, level int) {
+			if level > nesting {
+				nesting = level
+			}
+		})
+		if lines <= options.MaxLines && nesting <= options.MaxNesting {
+			continue
+		}
+		var candidates []Suggestion
+		stmtListsIn(funcDecl.Body, 0, func(parent ast.Node, stmts []ast.Stmt, level int) {
+			for begin := range stmts {
+				for end := begin + 1; end <= len(stmts); end++ {
+					if parent == funcDecl.Body && begin == 0 && end == len(stmts) {
+						continue
+					}
+					candidate, ok := candidateFor(fileSet, astFile, info, pkg, parent, stmts, begin, end, level, options)
+					if ok {
+						candidate.Function = funcDecl.Name.Name
+						candidate.Lines = lines
+						candidate.Nesting = nesting
+						candidates = append(candidates, candidate)
+					}
+				}
+			}
+		})
+		suggestions = append(suggestions, bestNonOverlapping(candidates)...)
+	}
+	return
+}
+
+// candidateFor checks whether stmts[begin:end] can be extracted and describes
+// the extraction.
+func candidateFor(fileSet *token.FileSet, astFile *ast.File, info *types.Info, pkg *types.Package, parent ast.Node, stmts []ast.Stmt, begin int, end int, level int, options SuggestOptions) (Suggestion, bool) {
+	nodes := make([]ast.Node, end-begin)
+	for i := range nodes {
+		nodes[i] = stmts[begin+i]
+		if _, isClause := nodes[i].(*ast.CaseClause); isClause {
+			return Suggestion{}, false
+		}
+		if _, isClause := nodes[i].(*ast.CommClause); isClause {
+			return Suggestion{}, false
+		}
+	}
+	beginPos, endPos := fileSet.Position(nodes[0].Pos()), fileSet.Position(nodes[len(nodes)-1].End())
+	lines := endPos.Line - beginPos.Line + 1
+	if lines < 3 || !leavesOnlyAtEnd(nodes) || assignsOuterLocal(nodes, info) {
+		return Suggestion{}, false
+	}
+	context := &selectionContext{fileSet: fileSet, astFile: astFile, nodes: nodes, parent: parent}
+	if len(problemsIn(context)) != 0 {
+		return Suggestion{}, false
+	}
+	params := localsUsedIn(nodes, info)
+	declared := varIdentsDeclaredWithin(nodes)
+	delete(declared, "_")
+	results := overlappingVarsIdentsUsedIn(stmts[end:], declared)
+	if len(params) > options.MaxParams || len(results) > maxSuggestedResults {
+		return Suggestion{}, false
+	}
+	signature, ok := signatureOf(params, results, info, pkg)
+	if !ok {
+		return Suggestion{}, false
+	}
+	complexity := 0
+	for _, node := range nodes {
+		complexity += complexityOf(node, level)
+	}
+	score := complexity + lines/5 - len(params) - len(results)
+	if score <= 0 {
+		return Suggestion{}, false
+	}
+	return Suggestion{
+		Filename:   beginPos.Filename,
+		Selection:  Selection{Position{beginPos.Line, beginPos.Column}, Position{endPos.Line, endPos.Column}},
+		Name:       nameSuggestedFor(context, false),
+		Signature:  signature,
+		Complexity: complexity,
+		Score:      score,
+	}, true
+}
+
+func signatureOf(params map[string]*ast.Ident, results map[string]*ast.Ident, info *types.Info, pkg *types.Package) (string, bool) {
+	typeOf := func(ident *ast.Ident) (string, bool) {
+		object := info.ObjectOf(ident)
+		if object == nil || object.Type() == nil || object.Type() == types.Typ[types.Invalid] {
+			return "", false
+		}
+		return types.TypeString(object.Type(), func(other *types.Package) string {
+			if other == pkg {
+				return ""
+			}
+			return other.Name()
+		}), true
+	}
+	var paramList, resultList []string
+	for _, name := range sortedKeysFrom(params) {
+		typeName, ok := typeOf(params[name])
+		if !ok {
+			return "", false
+		}
+		paramList = append(paramList, name+" "+typeName)
+	}
+	for _, name := range sortedKeysFrom(results) {
+		typeName, ok := typeOf(results[name])
+		if !ok {
+			return "", false
+		}
+		resultList = append(resultList, typeName)
+	}
+	signature := "(" + strings.Join(paramList, ", ") + ")"
+	switch len(resultList) {
+	case 0:
+	case 1:
+		signature += " " + resultList[0]
+	default:
+		signature += " (" + strings.Join(resultList, ", ") + ")"
+	}
+	return signature, true
+}
+
+// localsUsedIn finds the local variables nodes use, but which are declared
+// before them.
+func localsUsedIn(nodes []ast.Node, info *types.Info) map[string]*ast.Ident {
+	begin, end := nodes[0].Pos(), nodes[len(nodes)-1].End()
+	result := make(map[string]*ast.Ident)
+	for _, node := range nodes {
+		ast.Inspect(node, func(n ast.Node) bool {
+			if ident, isIdent := n.(*ast.Ident); isIdent {
+				if variable, isVar := info.Uses[ident].(*types.Var); isVar && !variable.IsField() && variable.Parent() != nil &&
+					variable.Parent() != variable.Pkg().Scope() && (variable.Pos() < begin || variable.Pos() >= end) {
+					result[ident.Name] = ident
+				}
+			}
+			return true
+		})
+	}
+	return result
+}
+
+// leavesOnlyAtEnd reports whether control can only leave nodes at their end,
+// i.e. there are no returns and no branches to targets outside of them.
+func leavesOnlyAtEnd(nodes []ast.Node) bool {
+	ok := true
+	var visit func(node ast.Node, inLoop bool, inBreakable bool)
+	visit = func(node ast.Node, inLoop bool, inBreakable bool) {
+		ast.Inspect(node, func(n ast.Node) bool {
+			if !ok || n == nil {
+				return false
+			}
+			switch typedNode := n.(type) {
+			case *ast.FuncLit:
+				return false
+			case *ast.ReturnStmt:
+				ok = false
+			case *ast.BranchStmt:
+				switch {
+				case typedNode.Label != nil || typedNode.Tok == token.GOTO || typedNode.Tok == token.FALLTHROUGH:
+					ok = false
+				case typedNode.Tok == token.CONTINUE:
+					ok = inLoop
+				case typedNode.Tok == token.BREAK:
+					ok = inBreakable
+				}
+			case *ast.ForStmt, *ast.RangeStmt:
+				if n != node {
+					visit(n, true, true)
+					return false
+				}
+			case *ast.SwitchStmt, *ast.TypeSwitchStmt, *ast.SelectStmt:
+				if n != node {
+					visit(n, inLoop, true)
+					return false
+				}
+			}
+			return true
+		})
+	}
+	for _, node := range nodes {
+		visit(node, false, false)
+	}
+	return ok
+}
+
+// assignsOuterLocal reports whether nodes assign to local variables declared
+// before them. The extracted function would only change its copy of them.
+func assignsOuterLocal(nodes []ast.Node, info *types.Info) bool {
+	begin, end := nodes[0].Pos(), nodes[len(nodes)-1].End()
+	isOuterLocal := func(expr ast.Expr) bool {
+		ident, isIdent := expr.(*ast.Ident)
+		if !isIdent {
+			return false
+		}
+		variable, isVar := info.Uses[ident].(*types.Var)
+		return isVar && !variable.IsField() && variable.Parent() != nil &&
+			variable.Parent() != variable.Pkg().Scope() && (variable.Pos() < begin || variable.Pos() >= end)
+	}
+	assigns := false
+	for _, node := range nodes {
+		ast.Inspect(node, func(n ast.Node) bool {
+			switch typedNode := n.(type) {
+			case *ast.AssignStmt:
+				for _, lhs := range typedNode.Lhs {
+					assigns = assigns || isOuterLocal(lhs)
+				}
+			case *ast.IncDecStmt:
+				assigns = assigns || isOuterLocal(typedNode.X)
+			case *ast.RangeStmt:
+				if typedNode.Tok == token.ASSIGN {
+					assigns = assigns || (typedNode.Key != nil && isOuterLocal(typedNode.Key)) || (typedNode.Value != nil && isOuterLocal(typedNode.Value))
+				}
+			case *ast.UnaryExpr:
+				assigns = assigns || (typedNode.Op == token.AND && isOuterLocal(typedNode.X))
+			}
+			return !assigns
+		})
+	}
+	return assigns
+}
+
+// stmtListsIn calls visit for every statement list in node with the nesting
+// depth of control statements it is in, starting at level.
+func stmtListsIn(node ast.Node, level int, visit func(parent ast.Node, stmts []ast.Stmt, level int)) {
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch typedNode := n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.BlockStmt:
+			visit(typedNode, typedNode.List, level)
+		case *ast.CaseClause:
+			visit(typedNode, typedNode.Body, level)
+		case *ast.CommClause:
+			visit(typedNode, typedNode.Body, level)
+		}
+		if children := controlStmtChildren(n); n != node && children != nil {
+			for _, child := range children {
+				stmtListsIn(child, level+1, visit)
+			}
+			return false
+		}
+		return true
+	})
+}
+
+// complexityOf computes the cognitive complexity of node at nesting depth
+// level: every control statement costs one plus its nesting depth, every
+// boolean operator one.
+func complexityOf(node ast.Node, level int) (complexity int) {
+	ast.Inspect(node, func(n ast.Node) bool {
+		switch typedNode := n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.BinaryExpr:
+			if typedNode.Op == token.LAND || typedNode.Op == token.LOR {
+				complexity++
+			}
+		}
+		if children := controlStmtChildren(n); children != nil {
+			complexity += 1 + level
+			for _, child := range children {
+				complexity += complexityOf(child, level+1)
+			}
+			return false
+		}
+		return true
+	})
+	return
+}
+
+// controlStmtChildren returns the children of control statements, and nil for
+// all other nodes.
+func controlStmtChildren(node ast.Node) (children []ast.Node) {
+	add := func(nodes ...ast.Node) []ast.Node {
+		children = []ast.Node{}
+		for _, child := range nodes {
+			if child != nil {
+				children = append(children, child)
+			}
+		}
+		return children
+	}
+	switch typedNode := node.(type) {
+	case *ast.IfStmt:
+		return add(typedNode.Init, typedNode.Cond, typedNode.Body, typedNode.Else)
+	case *ast.ForStmt:
+		return add(typedNode.Init, typedNode.Cond, typedNode.Post, typedNode.Body)
+	case *ast.RangeStmt:
+		return add(typedNode.X, typedNode.Body)
+	case *ast.SwitchStmt:
+		return add(typedNode.Init, typedNode.Tag, typedNode.Body)
+	case *ast.TypeSwitchStmt:
+		return add(typedNode.Init, typedNode.Assign, typedNode.Body)
+	case *ast.SelectStmt:
+		return add(typedNode.Body)
+	}
+	return nil
+}
+
+// bestNonOverlapping picks the candidates with the highest scores that do not
+// overlap.
+func bestNonOverlapping(candidates []Suggestion) (best []Suggestion) {
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].Score > candidates[j].Score })
+	for _, candidate := range candidates {
+		overlaps := false
+		for _, chosen := range best {
+			overlaps = overlaps || (!candidate.Selection.End.isBefore(chosen.Selection.Begin) && !chosen.Selection.End.isBefore(candidate.Selection.Begin))
+		}
+		if !overlaps {
+			best = append(best, candidate)
+		}
+		if len(best) == maxSuggestionsPerFunction {
+			break
+		}
+	}
+	return
+}
@@ -0,0 +1,81 @@
+package goextract_test
+
+import (
+	"encoding/json"
+
+	. "github.com/petergtz/goextract"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Suggest", func() {
+	pkg := newTempPackage("goextract-suggest", map[string]string{
+		"sub/a.go": `package sub
+
+func short() {}
+
+func nested(items [][]int, limit int) int {
+	total := 0
+	for _, row := range items {
+		for _, item := range row {
+			if item > limit {
+				if item%2 == 0 {
+					println(item)
+				}
+			}
+		}
+	}
+	return total
+}
+`,
+	})
+
+	It("suggests extracting the deeply nested code of a function", func() {
+		suggestions, err := Suggest([]string{pkg.dir + "/..."}, DefaultSuggestOptions)
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(suggestions).NotTo(BeEmpty())
+		Expect(suggestions[0].Filename).To(Equal(pkg.path("sub", "a.go")))
+		Expect(suggestions[0].Function).To(Equal("nested"))
+		Expect(suggestions[0].Selection).To(Equal(Selection{Position{6, 2}, Position{15, 3}}))
+		Expect(suggestions[0].Signature).To(Equal("(items [][]int, limit int) int"))
+		Expect(suggestions[0].Name).To(Equal("computeTotal"))
+		Expect(suggestions[0].Nesting).To(Equal(4))
+		Expect(suggestions[0].Complexity).To(Equal(10))
+	})
+
+	It("leaves functions below the thresholds alone", func() {
+		suggestions, err := Suggest([]string{pkg.path("sub")}, SuggestOptions{MaxLines: 40, MaxNesting: 4, MaxParams: 4})
+
+		Expect(err).NotTo(HaveOccurred())
+		Expect(suggestions).To(BeEmpty())
+	})
+
+	It("reports suggestions as JSON and SARIF", func() {
+		suggestions, err := Suggest([]string{pkg.path("sub", "a.go")}, DefaultSuggestOptions)
+		Expect(err).NotTo(HaveOccurred())
+
+		var jsonSuggestions []map[string]interface{}
+		Expect(json.Unmarshal(JSONFromSuggestions(suggestions), &jsonSuggestions)).To(Succeed())
+		Expect(jsonSuggestions[0]).To(HaveKeyWithValue("beginLine", 6.0))
+
+		var sarif struct {
+			Version string
+			Runs    []struct {
+				Results []struct {
+					RuleID    string
+					Locations []struct {
+						PhysicalLocation struct {
+							ArtifactLocation struct{ URI string }
+						}
+					}
+				}
+			}
+		}
+		Expect(json.Unmarshal(SARIFFromSuggestions(suggestions, pkg.dir), &sarif)).To(Succeed())
+		Expect(sarif.Version).To(Equal("2.1.0"))
+		Expect(sarif.Runs[0].Results[0].RuleID).To(Equal("extract-function"))
+		Expect(sarif.Runs[0].Results[0].Locations[0].PhysicalLocation.ArtifactLocation.URI).To(Equal("sub/a.go"))
+	})
+})
@@ -0,0 +1,296 @@
+package goextract
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"strings"
+
+	"github.com/petergtz/goextract/util"
+)
+
+type TypeCheckError struct {
+	Problems []Problem
+}
+
+func (err *TypeCheckError) Error() string {
+	messages := make([]string, len(err.Problems))
+	for i, problem := range err.Problems {
+		messages[i] = problem.String()
+	}
+	return "Extraction result does not type-check:\n" + strings.Join(messages, "\n")
+}
+
+// packageChecker type-checks versions of a file along with the other files of
+// its package. All its checks share the imported packages, so the stages of
+// an extraction only type-check the dependencies once.
+type packageChecker struct {
+	filename string
+	overlay  Overlay
+	importer *sourceImporter
+}
+
+// newPackageChecker returns a checker for filename that reads the other files
+// through options.Overlay and shares the imported packages with other
+// extractions if options.importer is set.
+func newPackageChecker(filename string, options Options) *packageChecker {
+	importer := options.importer
+	if importer == nil {
+		importer = newSourceImporter(token.NewFileSet(), options.Overlay)
+	}
+	return &packageChecker{filename: filename, overlay: options.Overlay, importer: importer}
+}
+
+// with returns a checker that sees changes in addition. Changes of other
+// packages may change the dependencies, so only changes within the package
+// keep the imported packages.
+func (checker *packageChecker) with(changes []FileChange) *packageChecker {
+	overlay := checker.overlay.with(changes)
+	for _, change := range changes {
+		if !sameFile(filepath.Dir(change.Filename), filepath.Dir(checker.filename)) {
+			return &packageChecker{filename: checker.filename, overlay: overlay, importer: newSourceImporter(token.NewFileSet(), overlay)}
+		}
+	}
+	return &packageChecker{filename: checker.filename, overlay: overlay, importer: checker.importer}
+}
+
+// checkedFile is a version of a file type-checked by a packageChecker.
+type checkedFile struct {
+	fileSet *token.FileSet
+	astFile *ast.File
+	// files are astFile and the other files of its package.
+	files []*ast.File
+	pkg   *types.Package
+	info  *types.Info
+}
+
+// check parses src with mode as content of the file and type-checks it. src
+// must parse, but type errors are ignored.
+func (checker *packageChecker) check(src string, mode parser.Mode) *checkedFile {
+	fileSet := checker.importer.fileSet
+	astFile, err := parser.ParseFile(fileSet, checker.filename, src, mode)
+	util.PanicOnError(err)
+	checked := &checkedFile{
+		fileSet: fileSet,
+		astFile: astFile,
+		files:   append([]*ast.File{astFile}, siblingFilesOf(fileSet, checker.filename, src, checker.overlay)...),
+		info: &types.Info{
+			Defs:       make(map[*ast.Ident]types.Object),
+			Uses:       make(map[*ast.Ident]types.Object),
+			Types:      make(map[ast.Expr]types.TypeAndValue),
+			Scopes:     make(map[ast.Node]*types.Scope),
+			Selections: make(map[*ast.SelectorExpr]*types.Selection),
+		},
+	}
+	config := types.Config{Importer: checker.importer, Error: func(error) {}}
+	checked.pkg, _ = config.Check(astFile.Name.Name, fileSet, checked.files, checked.info)
+	return checked
+}
+
+// typeErrorsIn type-checks src as content of the file and returns all type
+// errors, or the error if src does not parse.
+func (checker *packageChecker) typeErrorsIn(src string) []types.Error {
+	fileSet := checker.importer.fileSet
+	return typeErrorsIn(fileSet, &types.Config{Importer: checker.importer}, checker.filename, src, siblingFilesOf(fileSet, checker.filename, src, checker.overlay))
+}
+
+// checkTypes type-checks the package of the file of checker once with the
+// original and once with the extracted content of the file, both along with
+// otherChanges. All type errors that only occur with the extracted content are
+// returned, with positions mapped back to the original source where possible.
+func checkTypes(checker *packageChecker, original string, extracted string, selection Selection, otherChanges []FileChange) []Problem {
+	checker = checker.with(otherChanges)
+	originalErrors := make(map[string]int)
+	for _, typeError := range checker.typeErrorsIn(original) {
+		originalErrors[typeError.Msg]++
+	}
+	mapper := newPositionMapper(original, extracted, selection)
+	var problems []Problem
+	for _, typeError := range checker.typeErrorsIn(extracted) {
+		if originalErrors[typeError.Msg] > 0 {
+			originalErrors[typeError.Msg]--
+			continue
+		}
+		problem := Problem{Rule: "typecheck", Position: typeError.Fset.Position(typeError.Pos), Message: typeError.Msg}
+		if problem.Position.Filename == checker.filename {
+			problem = mapper.mapToOriginal(problem)
+		}
+		problems = append(problems, problem)
+	}
+	return problems
+}
+
+// checkChangedPackage type-checks the package of the first change, including
+// its test files, before and after all changes and returns the type errors
+// that only occur afterwards.
+func checkChangedPackage(changes []FileChange, overlay Overlay) []Problem {
+	filename := changes[0].Filename
+	original := changes[0].Original
+	if original == "" {
+		// The file is new, so only its package clause is checked along with
+		// the other files before.
+		packageClause, err := parser.ParseFile(token.NewFileSet(), filename, changes[0].Modified, parser.PackageClauseOnly)
+		if err == nil {
+			original = "package " + packageClause.Name.Name + "\n"
+		}
+	}
+	errorsBefore := make(map[string]int)
+	fileSet := token.NewFileSet()
+	typesConfig := &types.Config{Importer: newSourceImporter(fileSet, overlay)}
+	for _, typeError := range typeErrorsIn(fileSet, typesConfig, filename, original, packageFilesOf(fileSet, filename, original, overlay)) {
+		errorsBefore[typeError.Msg]++
+	}
+	fileSet = token.NewFileSet()
+	changedOverlay := overlay.with(changes[1:])
+	typesConfig = &types.Config{Importer: newSourceImporter(fileSet, changedOverlay)}
+	var problems []Problem
+	for _, typeError := range typeErrorsIn(fileSet, typesConfig, filename, changes[0].Modified, packageFilesOf(fileSet, filename, changes[0].Modified, changedOverlay)) {
+		if errorsBefore[typeError.Msg] > 0 {
+			errorsBefore[typeError.Msg]--
+			continue
+		}
+		problems = append(problems, Problem{Rule: "typecheck", Position: typeError.Fset.Position(typeError.Pos), Message: typeError.Msg})
+	}
+	return problems
+}
+
+func typeErrorsIn(fileSet *token.FileSet, typesConfig *types.Config, filename string, src string, siblings []*ast.File) (typeErrors []types.Error) {
+	astFile, err := parser.ParseFile(fileSet, filename, src, 0)
+	if err != nil {
+		return []types.Error{{Fset: fileSet, Pos: token.NoPos, Msg: err.Error()}}
+	}
+	config := *typesConfig
+	config.Error = func(err error) {
+		typeErrors = append(typeErrors, err.(types.Error))
+	}
+	config.Check(astFile.Name.Name, fileSet, append([]*ast.File{astFile}, siblings...), nil)
+	return
+}
+
+// siblingFilesOf parses all files in the directory of filename that belong to
+// the same package.
+func siblingFilesOf(fileSet *token.FileSet, filename string, src string, overlay Overlay) []*ast.File {
+	isTest := strings.HasSuffix(filename, "_test.go")
+	return filesBesides(fileSet, filename, src, overlay, func(name string, packageName string, filePackageName string) bool {
+		return strings.HasSuffix(name, "_test.go") == isTest && filePackageName == packageName
+	})
+}
+
+// packageFilesOf is like siblingFilesOf, but also includes the test files
+// of the package, or its other files if filename is a test file. Files of an
+// external test package are not included.
+func packageFilesOf(fileSet *token.FileSet, filename string, src string, overlay Overlay) []*ast.File {
+	return filesBesides(fileSet, filename, src, overlay, func(name string, packageName string, filePackageName string) bool {
+		return filePackageName == packageName
+	})
+}
+
+// externalTestFilesOf parses the files of the external test package of the
+// package of filename, i.e. the package with the _test suffix.
+func externalTestFilesOf(fileSet *token.FileSet, filename string, src string, overlay Overlay) []*ast.File {
+	return filesBesides(fileSet, filename, src, overlay, func(name string, packageName string, filePackageName string) bool {
+		return strings.HasSuffix(name, "_test.go") && filePackageName == packageName+"_test"
+	})
+}
+
+// filesBesides parses the Go files in the directory of filename, except
+// filename itself, that match the build context and that accept accepts,
+// given their name, the name of the package of filename and their package name.
+func filesBesides(fileSet *token.FileSet, filename string, src string, overlay Overlay, accept func(name string, packageName string, filePackageName string) bool) (files []*ast.File) {
+	if filename == "" {
+		return
+	}
+	packageClause, err := parser.ParseFile(token.NewFileSet(), filename, src, parser.PackageClauseOnly)
+	if err != nil {
+		return
+	}
+	dir := filepath.Dir(filename)
+	fileInfos, err := overlay.readDir(dir)
+	util.PanicOnError(err)
+	buildContext := overlay.buildContext()
+	for _, fileInfo := range fileInfos {
+		otherFilename := filepath.Join(dir, fileInfo.Name())
+		if fileInfo.IsDir() || !strings.HasSuffix(fileInfo.Name(), ".go") || sameFile(otherFilename, filename) {
+			continue
+		}
+		if match, err := buildContext.MatchFile(dir, fileInfo.Name()); err != nil || !match {
+			continue
+		}
+		file, err := parser.ParseFile(fileSet, otherFilename, overlay.ReadFile(otherFilename), 0)
+		if err != nil || !accept(fileInfo.Name(), packageClause.Name.Name, file.Name.Name) {
+			continue
+		}
+		files = append(files, file)
+	}
+	return
+}
+
+func sameFile(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
+
+// positionMapper maps positions in the extracted source back to the original source.
+type positionMapper struct {
+	originalLines  []string
+	extractedLines []string
+	originalLine   map[int]int
+	selection      Selection
+}
+
+func newPositionMapper(original string, extracted string, selection Selection) *positionMapper {
+	mapper := &positionMapper{
+		originalLines:  splitLines(original),
+		extractedLines: splitLines(extracted),
+		originalLine:   make(map[int]int),
+		selection:      selection,
+	}
+	var deletedLines []int
+	var insertedLines []int
+	for _, edit := range lineDiff(mapper.originalLines, mapper.extractedLines) {
+		switch edit.op {
+		case lineEqual:
+			mapper.originalLine[edit.newLine] = edit.oldLine
+		case lineDeleted:
+			deletedLines = append(deletedLines, edit.oldLine)
+		case lineInserted:
+			insertedLines = append(insertedLines, edit.newLine)
+		}
+	}
+	// Lines moved into the new function only differ in their indentation.
+	for _, insertedLine := range insertedLines {
+		for _, deletedLine := range deletedLines {
+			if strings.TrimSpace(mapper.extractedLines[insertedLine]) != "" &&
+				strings.TrimSpace(mapper.extractedLines[insertedLine]) == strings.TrimSpace(mapper.originalLines[deletedLine]) {
+				mapper.originalLine[insertedLine] = deletedLine
+				break
+			}
+		}
+	}
+	return mapper
+}
+
+// mapToOriginal moves problem to the corresponding position in the original source.
+// Problems in generated code, e.g. in the signature of the new function, are
+// reported at the beginning of the selection.
+func (mapper *positionMapper) mapToOriginal(problem Problem) Problem {
+	originalLine, found := mapper.originalLine[problem.Position.Line-1]
+	if !found {
+		problem.Position.Line = mapper.selection.Begin.Line
+		problem.Position.Column = mapper.selection.Begin.Column
+		problem.Message += " (in generated code)"
+		problem.Position.Offset = 0
+		return problem
+	}
+	problem.Position.Column += indentationOf(mapper.originalLines[originalLine]) - indentationOf(mapper.extractedLines[problem.Position.Line-1])
+	problem.Position.Line = originalLine + 1
+	problem.Position.Offset = 0
+	return problem
+}
+
+func indentationOf(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " \t"))
+}
@@ -0,0 +1,236 @@
+package goextract
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"strings"
+
+	"github.com/petergtz/goextract/util"
+)
+
+// Problem describes why a selection cannot safely be extracted.
+type Problem struct {
+	Rule     string
+	Position token.Position
+	Message  string
+}
+
+func (problem Problem) String() string {
+	return fmt.Sprintf("%v: %v (%v)", problem.Position, problem.Message, problem.Rule)
+}
+
+type ValidationError struct {
+	Problems []Problem
+}
+
+func (err *ValidationError) Error() string {
+	messages := make([]string, len(err.Problems))
+	for i, problem := range err.Problems {
+		messages[i] = problem.String()
+	}
+	return "Cannot extract selection:\n" + strings.Join(messages, "\n")
+}
+
+type selectionContext struct {
+	fileSet *token.FileSet
+	astFile *ast.File
+	nodes   []ast.Node
+	parent  ast.Node
+	// expression is only set when the selection is a single expression
+	expression ast.Expr
+}
+
+func (context *selectionContext) problem(pos token.Pos, format string, args ...interface{}) Problem {
+	return Problem{
+		Position: context.fileSet.Position(pos),
+		Message:  fmt.Sprintf(format, args...),
+	}
+}
+
+func (context *selectionContext) contains(node ast.Node) bool {
+	return node.Pos() >= context.nodes[0].Pos() && node.End() <= context.nodes[len(context.nodes)-1].End()
+}
+
+type validationRule struct {
+	name  string
+	check func(context *selectionContext) []Problem
+}
+
+var validationRules = []validationRule{
+	{"fallthrough", checkFallthrough},
+	{"recover", checkRecover},
+	{"defer", checkDefer},
+	{"label", checkLabels},
+	{"shadow", checkShadowedDeclarations},
+}
+
+func ValidationRuleNames() []string {
+	names := make([]string, len(validationRules))
+	for i, rule := range validationRules {
+		names[i] = rule.name
+	}
+	return names
+}
+
+func problemsIn(context *selectionContext) (problems []Problem) {
+	for _, rule := range validationRules {
+		for _, problem := range rule.check(context) {
+			problem.Rule = rule.name
+			problems = append(problems, problem)
+		}
+	}
+	return
+}
+
+// validate runs all validation rules on the selected nodes. Violations of rules
+// listed in warnOnly are returned as warnings, all others make up the error.
+func validate(context *selectionContext, warnOnly map[string]bool) (warnings []Problem, err error) {
+	var errors []Problem
+	for _, problem := range problemsIn(context) {
+		if warnOnly[problem.Rule] {
+			warnings = append(warnings, problem)
+		} else {
+			errors = append(errors, problem)
+		}
+	}
+	if len(errors) != 0 {
+		return warnings, &ValidationError{Problems: errors}
+	}
+	return warnings, nil
+}
+
+// Validate checks whether the selection in input can be extracted without changing
+// the behavior of the program and returns all problems found.
+func Validate(input string, selection Selection) []Problem {
+	fileSet, astFile, err := astFromInput(input)
+	util.PanicOnError(err)
+	context, err := matchSelection(fileSet, astFile, selection)
+	util.PanicOnError(err)
+	return problemsIn(context)
+}
+
+func matchSelection(fileSet *token.FileSet, astFile *ast.File, selection Selection) (*selectionContext, error) {
+	context := &selectionContext{fileSet: fileSet, astFile: astFile}
+	expression, parentNode := matchExpression(fileSet, astFile, selection)
+	if expression != nil {
+		context.nodes, context.parent, context.expression = []ast.Node{expression}, parentNode, expression
+		return context, nil
+	}
+	var err error
+	context.nodes, context.parent, err = matchMultipleStmts(fileSet, astFile, selection)
+	return context, err
+}
+
+// inspectOutsideFuncLits is like ast.Inspect on all selected nodes, but does not
+// descend into function literals, because their bodies keep their semantics when moved.
+func inspectOutsideFuncLits(nodes []ast.Node, f func(node ast.Node) bool) {
+	for _, node := range nodes {
+		ast.Inspect(node, func(node ast.Node) bool {
+			if _, isFuncLit := node.(*ast.FuncLit); isFuncLit {
+				return false
+			}
+			return f(node)
+		})
+	}
+}
+
+func checkFallthrough(context *selectionContext) (problems []Problem) {
+	for _, node := range context.nodes {
+		if branchStmt, ok := node.(*ast.BranchStmt); ok && branchStmt.Tok == token.FALLTHROUGH {
+			problems = append(problems, context.problem(branchStmt.Pos(),
+				"fallthrough must stay the last statement of its case clause"))
+		}
+	}
+	return
+}
+
+func checkRecover(context *selectionContext) (problems []Problem) {
+	inspectOutsideFuncLits(context.nodes, func(node ast.Node) bool {
+		if callExpr, ok := node.(*ast.CallExpr); ok {
+			if ident, ok := callExpr.Fun.(*ast.Ident); ok && ident.Name == "recover" && ident.Obj == nil {
+				problems = append(problems, context.problem(callExpr.Pos(),
+					"recover() stops working when it is no longer called directly by a deferred function"))
+			}
+		}
+		return true
+	})
+	return
+}
+
+func checkDefer(context *selectionContext) (problems []Problem) {
+	inspectOutsideFuncLits(context.nodes, func(node ast.Node) bool {
+		if deferStmt, ok := node.(*ast.DeferStmt); ok {
+			problems = append(problems, context.problem(deferStmt.Pos(),
+				"deferred call would run at the end of the extracted function instead of the enclosing one"))
+		}
+		return true
+	})
+	return
+}
+
+func checkLabels(context *selectionContext) (problems []Problem) {
+	labels := make(map[*ast.Object]*ast.LabeledStmt)
+	inspectOutsideFuncLits(context.nodes, func(node ast.Node) bool {
+		if labeledStmt, ok := node.(*ast.LabeledStmt); ok && labeledStmt.Label.Obj != nil {
+			labels[labeledStmt.Label.Obj] = labeledStmt
+		}
+		return true
+	})
+	if len(labels) == 0 {
+		return
+	}
+	ast.Inspect(enclosingFuncBody(context.astFile, context.nodes[0].Pos()), func(node ast.Node) bool {
+		if branchStmt, ok := node.(*ast.BranchStmt); ok && branchStmt.Label != nil && !context.contains(branchStmt) {
+			if labeledStmt := labels[branchStmt.Label.Obj]; labeledStmt != nil {
+				problems = append(problems, context.problem(labeledStmt.Pos(),
+					"label %v is targeted by %v at %v outside of the selection",
+					labeledStmt.Label.Name, branchStmt.Tok, context.fileSet.Position(branchStmt.Pos())))
+			}
+		}
+		return true
+	})
+	return
+}
+
+func checkShadowedDeclarations(context *selectionContext) (problems []Problem) {
+	if context.expression != nil {
+		return
+	}
+	allStmts := *stmtsFromBlockStmt(context.parent)
+	indexAfterSelection := indexOf(context.nodes[len(context.nodes)-1].(ast.Stmt), allStmts) + 1
+	var laterNodes []ast.Node
+	for _, stmt := range allStmts[indexAfterSelection:] {
+		laterNodes = append(laterNodes, stmt)
+	}
+	laterDecls := varIdentsDeclaredWithin(laterNodes)
+	for _, node := range context.nodes {
+		if assignStmt, ok := node.(*ast.AssignStmt); ok && assignStmt.Tok == token.DEFINE {
+			for _, lhs := range assignStmt.Lhs {
+				ident := lhs.(*ast.Ident)
+				if laterDecl := laterDecls[ident.Name]; laterDecl != nil && ident.Name != "_" {
+					problems = append(problems, context.problem(ident.Pos(),
+						"%v is declared again at %v and both variables can no longer be told apart",
+						ident.Name, context.fileSet.Position(laterDecl.Pos())))
+				}
+			}
+		}
+	}
+	return
+}
+
+func enclosingFuncBody(astFile *ast.File, pos token.Pos) (body *ast.BlockStmt) {
+	ast.Inspect(astFile, func(node ast.Node) bool {
+		if node == nil || pos < node.Pos() || pos >= node.End() {
+			return false
+		}
+		switch typedNode := node.(type) {
+		case *ast.FuncDecl:
+			body = typedNode.Body
+		case *ast.FuncLit:
+			body = typedNode.Body
+		}
+		return true
+	})
+	return
+}
@@ -0,0 +1,170 @@
+package goextract_test
+
+import (
+	"io/ioutil"
+	"os"
+
+	. "github.com/petergtz/goextract"
+	"github.com/petergtz/goextract/util"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+func rulesOf(problems []Problem) []string {
+	var rules []string
+	for _, problem := range problems {
+		rules = append(rules, problem.Rule)
+	}
+	return rules
+}
+
+var _ = Describe("Validation", func() {
+	It("refuses fallthrough", func() {
+		Expect(rulesOf(Validate(`package p
+
+func f(i int) {
+	switch i {
+	case 1:
+		g()
+		fallthrough
+	case 2:
+	}
+}
+`, Selection{Position{6, 3}, Position{7, 14}}))).To(ConsistOf("fallthrough"))
+	})
+
+	It("accepts fallthrough in a switch that is extracted completely", func() {
+		Expect(Validate(`package p
+
+func f(i int) {
+	switch i {
+	case 1:
+		fallthrough
+	case 2:
+	}
+}
+`, Selection{Position{4, 2}, Position{8, 3}})).To(BeEmpty())
+	})
+
+	It("refuses recover", func() {
+		Expect(rulesOf(Validate(`package p
+
+func f() {
+	g()
+	recover()
+}
+`, Selection{Position{4, 2}, Position{5, 11}}))).To(ConsistOf("recover"))
+	})
+
+	It("accepts recover within a function literal", func() {
+		Expect(Validate(`package p
+
+func f() {
+	g()
+	run(func() { recover() })
+}
+`, Selection{Position{4, 2}, Position{5, 27}})).To(BeEmpty())
+	})
+
+	It("refuses defer", func() {
+		Expect(rulesOf(Validate(`package p
+
+func f() {
+	defer g()
+	h()
+}
+`, Selection{Position{4, 2}, Position{5, 5}}))).To(ConsistOf("defer"))
+	})
+
+	It("refuses labels targeted from outside", func() {
+		Expect(rulesOf(Validate(`package p
+
+func f() {
+	g()
+loop:
+	for {
+	}
+	goto loop
+}
+`, Selection{Position{4, 2}, Position{7, 3}}))).To(ConsistOf("label"))
+	})
+
+	It("accepts labels only targeted from inside", func() {
+		Expect(Validate(`package p
+
+func f() {
+loop:
+	for {
+		break loop
+	}
+	g()
+}
+`, Selection{Position{4, 1}, Position{7, 3}})).To(BeEmpty())
+	})
+
+	It("refuses := declarations declared again later", func() {
+		Expect(rulesOf(Validate(`package p
+
+func f() {
+	a := 1
+	g(a)
+	if true {
+		a := 2
+		g(a)
+	}
+}
+`, Selection{Position{4, 2}, Position{5, 6}}))).To(ConsistOf("shadow"))
+	})
+
+	It("reports the position of the problem", func() {
+		problems := Validate(`package p
+
+func f() {
+	defer g()
+}
+`, Selection{Position{4, 2}, Position{4, 11}})
+		Expect(problems).To(HaveLen(1))
+		Expect(problems[0].Position.Line).To(Equal(4))
+		Expect(problems[0].Position.Column).To(Equal(2))
+	})
+
+	It("turns violations of rules into warnings on request", func() {
+		tmpfile, err := ioutil.TempFile("", "goextract")
+		util.PanicOnError(err)
+		defer os.Remove(tmpfile.Name())
+		util.WriteFileAsStringOrPanic(tmpfile.Name(), `package p
+
+func f() {
+	defer g()
+	h()
+}
+`)
+		selection := Selection{Position{4, 2}, Position{5, 5}}
+
+		_, _, err = ExtractFileToString(tmpfile.Name(), selection, "MyExtractedFunc", Options{}, false)
+		Expect(err).To(BeAssignableToTypeOf(&ValidationError{}))
+
+		_, warnings, err := ExtractFileToString(tmpfile.Name(), selection, "MyExtractedFunc", Options{WarnOnly: map[string]bool{"defer": true}}, false)
+		Expect(err).NotTo(HaveOccurred())
+		Expect(rulesOf(warnings)).To(ConsistOf("defer"))
+	})
+
+	It("returns an error for selections of partial statements", func() {
+		_, _, err := ExtractStringToString(`package p
+
+func f() {
+	g()
+	if true {
+		h()
+	}
+}
+`, Selection{Position{4, 2}, Position{6, 6}}, "i", Options{})
+		Expect(err).To(MatchError(ContainSubstring("Selection is not valid")))
+	})
+
+	It("returns an error for sources that cannot be parsed", func() {
+		_, _, err := ExtractStringToString("package p\n\nfunc f() {\n\tg(\n}\n", Selection{Position{4, 2}, Position{4, 4}}, "h", Options{})
+		Expect(err).To(HaveOccurred())
+	})
+})
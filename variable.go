@@ -0,0 +1,126 @@
+package goextract
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/token"
+	"strings"
+)
+
+// ExtractVariableFromSource introduces a variable for the expression in selection.
+// The variable is declared right before the statement containing the expression.
+func ExtractVariableFromSource(inputFileName string, src string, selection Selection, varName string, options Options) (*Result, error) {
+	fileSet, astFile, err := astFromSource(inputFileName, src)
+	if err != nil {
+		return &Result{}, err
+	}
+	expr, stmt, err := matchVariableExtraction(fileSet, astFile, selection)
+	if err != nil {
+		return &Result{}, err
+	}
+	exprBegin, exprEnd := fileSet.Position(expr.Pos()).Offset, fileSet.Position(expr.End()).Offset
+	stmtBegin := fileSet.Position(stmt.Pos()).Offset
+	lineBegin := strings.LastIndex(src[:stmtBegin], "\n") + 1
+	indentation := src[lineBegin : lineBegin+indentationOf(src[lineBegin:])]
+
+	output := src[:stmtBegin] +
+		varName + " := " + src[exprBegin:exprEnd] + "\n" + indentation +
+		src[stmtBegin:exprBegin] + varName + src[exprEnd:]
+
+	formatted, err := format.Source([]byte(output))
+	if err != nil {
+		return &Result{}, err
+	}
+	typeErrors := checkTypes(newPackageChecker(inputFileName, options), src, string(formatted), selection, nil)
+	if len(typeErrors) != 0 && !options.Force {
+		return &Result{}, &TypeCheckError{Problems: typeErrors}
+	}
+	return &Result{
+		Changes: []FileChange{{
+			Filename: inputFileName,
+			Original: src,
+			Modified: string(formatted),
+		}},
+		Warnings: typeErrors,
+	}, nil
+}
+
+// matchVariableExtraction finds the selected expression and the statement in
+// front of which the new variable can be declared without changing when, or
+// how often, the expression gets evaluated.
+func matchVariableExtraction(fileSet *token.FileSet, astFile *ast.File, selection Selection) (ast.Expr, ast.Stmt, error) {
+	expr, _ := matchExpression(fileSet, astFile, selection)
+	if expr == nil {
+		return nil, nil, errors.New("Selection is not an expression")
+	}
+	path := pathTo(astFile, expr)
+	for i := len(path) - 2; i >= 0; i-- {
+		child := path[i+1]
+		switch parent := path[i].(type) {
+		case *ast.BlockStmt:
+			if i > 0 && isSwitchOrSelect(path[i-1]) {
+				continue
+			}
+			return expr, child.(ast.Stmt), nil
+		case *ast.CaseClause:
+			if stmt, isStmt := child.(ast.Stmt); isStmt {
+				return expr, stmt, nil
+			}
+			return nil, nil, errors.New("Case expressions are evaluated conditionally")
+		case *ast.CommClause:
+			if stmt, isStmt := child.(ast.Stmt); isStmt && child != parent.Comm {
+				return expr, stmt, nil
+			}
+			return nil, nil, errors.New("Communication clauses cannot be moved")
+		case *ast.FuncLit:
+			return nil, nil, errors.New("Expression is part of a function literal")
+		case *ast.ForStmt:
+			if child == parent.Cond || child == parent.Post {
+				return nil, nil, errors.New("Loop conditions are evaluated repeatedly")
+			}
+		case *ast.IfStmt:
+			if child == parent.Else {
+				return nil, nil, errors.New("Else branches are evaluated conditionally")
+			}
+			if child == parent.Cond && parent.Init != nil {
+				return nil, nil, errors.New("The condition must be evaluated after the init statement")
+			}
+		case *ast.SwitchStmt:
+			if child == parent.Tag && parent.Init != nil {
+				return nil, nil, errors.New("The tag must be evaluated after the init statement")
+			}
+		case *ast.BinaryExpr:
+			if child == parent.Y && (parent.Op == token.LAND || parent.Op == token.LOR) {
+				return nil, nil, fmt.Errorf("Right operand of %v is evaluated conditionally", parent.Op)
+			}
+		case *ast.UnaryExpr:
+			if child == expr && parent.Op == token.AND {
+				return nil, nil, errors.New("Cannot take the address of a copy")
+			}
+		case *ast.AssignStmt:
+			for _, lhs := range parent.Lhs {
+				if lhs == child {
+					return nil, nil, errors.New("Cannot assign to a copy")
+				}
+			}
+		case *ast.IncDecStmt:
+			return nil, nil, errors.New("Cannot assign to a copy")
+		case *ast.RangeStmt:
+			if child != parent.X {
+				return nil, nil, errors.New("Cannot assign to a copy")
+			}
+		}
+	}
+	return nil, nil, errors.New("Expression is not part of a function body")
+}
+
+func isSwitchOrSelect(node ast.Node) bool {
+	switch node.(type) {
+	case *ast.SwitchStmt, *ast.TypeSwitchStmt, *ast.SelectStmt:
+		return true
+	default:
+		return false
+	}
+}